@@ -3,7 +3,8 @@ import axios from 'axios';
 import { Button, Container, Paper, Typography, TextField, InputLabel, FormControl, Select, MenuItem, CircularProgress } from '@mui/material';
 import { CloudUpload, Image } from '@mui/icons-material';
 
-type Operation = 'compress' | 'resize' | 'jpg-to-png' | 'png-to-jpg'  | 'image-to-pdf' | 'transparent-background';
+type Operation = 'compress' | 'resize' | 'convert' | 'image-to-pdf' | 'transparent-background';
+type TargetFormat = 'png' | 'jpeg' | 'gif' | 'bmp' | 'tiff' | 'webp';
 
 const ImageProcessor: React.FC = () => {
   const [selectedFile, setSelectedFile] = useState<File | null>(null);
@@ -11,6 +12,7 @@ const ImageProcessor: React.FC = () => {
   const [quality, setQuality] = useState(50);
   const [width, setWidth] = useState('');
   const [height, setHeight] = useState('');
+  const [targetFormat, setTargetFormat] = useState<TargetFormat>('png');
   const [resultImage, setResultImage] = useState<string | null>(null);
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
@@ -43,11 +45,8 @@ const ImageProcessor: React.FC = () => {
         formData.append('width', width);
         formData.append('height', height);
         break;
-      case 'jpg-to-png':
-        url += 'convert/jpg-to-png';
-        break;
-      case 'png-to-jpg':
-        url += 'convert/png-to-jpg';
+      case 'convert':
+        url += `convert/image?to=${targetFormat}`;
         break;
       case 'image-to-pdf':
         url += 'convert/to-pdf';
@@ -106,7 +105,7 @@ const ImageProcessor: React.FC = () => {
               <input
                 type="file"
                 hidden
-                accept="image/jpeg, image/png"
+                accept="image/*"
                 onChange={handleFileChange}
               />
             </Button>
@@ -126,8 +125,7 @@ const ImageProcessor: React.FC = () => {
             >
               <MenuItem value="compress">Compress</MenuItem>
               <MenuItem value="resize">Resize</MenuItem>
-              <MenuItem value="jpg-to-png">Convert JPG to PNG</MenuItem>
-              <MenuItem value="png-to-jpg">Convert PNG to JPG</MenuItem>
+              <MenuItem value="convert">Convert Format</MenuItem>
               <MenuItem value="image-to-pdf">Convert to PDF</MenuItem>
               <MenuItem value="transparent-background">Make Background Transparent</MenuItem>
             </Select>
@@ -148,6 +146,24 @@ const ImageProcessor: React.FC = () => {
             />
           )}
 
+          {operation === 'convert' && (
+            <FormControl fullWidth margin="normal">
+              <InputLabel>Target Format</InputLabel>
+              <Select
+                value={targetFormat}
+                label="Target Format"
+                onChange={(e) => setTargetFormat(e.target.value as TargetFormat)}
+              >
+                <MenuItem value="png">PNG</MenuItem>
+                <MenuItem value="jpeg">JPG</MenuItem>
+                <MenuItem value="gif">GIF</MenuItem>
+                <MenuItem value="bmp">BMP</MenuItem>
+                <MenuItem value="tiff">TIFF</MenuItem>
+                <MenuItem value="webp">WebP (lossless)</MenuItem>
+              </Select>
+            </FormControl>
+          )}
+
           {operation === 'resize' && (
             <div style={{ display: 'flex', gap: '1rem' }}>
               <TextField
@@ -21,16 +21,44 @@ import axios from 'axios';
 
 type PdfOperation = 'merge' | 'split' | 'compress';
 
+const API_URL = 'http://localhost:3000';
+
+interface ProgressEvent {
+  stage: string;
+  current?: number;
+  total?: number;
+  message?: string;
+}
+
+const describeProgress = (e: ProgressEvent): string => {
+  const counter = e.total ? ` ${e.current ?? 0} of ${e.total}` : '';
+  switch (e.stage) {
+    case 'uploaded':
+      return 'Uploaded, waiting for a worker...';
+    case 'parsing':
+      return e.total ? `Parsing ${e.total} files...` : 'Parsing PDF...';
+    case 'page':
+      return `Processing page${counter}...`;
+    case 'encoding':
+      return 'Writing output...';
+    case 'zipping':
+      return `Zipping file${counter}...`;
+    default:
+      return `${e.stage}${counter}...`;
+  }
+};
+
 const PdfProcessor: React.FC = () => {
   const [operation, setOperation] = useState<PdfOperation>('merge');
   const [mergeFiles, setMergeFiles] = useState<File[]>([]);
   const [splitFile, setSplitFile] = useState<File | null>(null);
   const [compressFile, setCompressFile] = useState<File | null>(null);
-  const [splitMode, setSplitMode] = useState<'pages' | 'count'>('pages');
+  const [splitMode, setSplitMode] = useState<'pages' | 'extract' | 'count'>('pages');
   const [pages, setPages] = useState('');
   const [count, setCount] = useState('');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
+  const [progress, setProgress] = useState('');
 
   // Common file upload handler
   const handleFileUpload = (files: FileList | null) => {
@@ -47,6 +75,32 @@ const PdfProcessor: React.FC = () => {
     setError('');
   };
 
+  // Runs an endpoint as a background job, reporting progress until the result is ready
+  const runJob = async (target: string, formData: FormData): Promise<Blob> => {
+    const { data: job } = await axios.post(`${API_URL}/jobs?target=${encodeURIComponent(target)}`, formData);
+
+    await new Promise<void>((resolve, reject) => {
+      const events = new EventSource(`${API_URL}/jobs/${job.id}/events`);
+      events.addEventListener('progress', (e) => {
+        setProgress(describeProgress(JSON.parse((e as MessageEvent).data)));
+      });
+      events.addEventListener('done', () => {
+        events.close();
+        resolve();
+      });
+      events.addEventListener('error', (e) => {
+        events.close();
+        const data = (e as MessageEvent).data;
+        reject(new Error(data ? JSON.parse(data).message : 'Lost connection to the server'));
+      });
+    });
+
+    const response = await axios.get(`${API_URL}/jobs/${job.id}/result`, {
+      responseType: 'blob',
+    });
+    return response.data;
+  };
+
   // Merge handlers
   const handleRemoveMergeFile = (index: number) => {
     setMergeFiles(prev => prev.filter((_, i) => i !== index));
@@ -63,16 +117,15 @@ const PdfProcessor: React.FC = () => {
 
     try {
       setLoading(true);
-      const response = await axios.post('http://localhost:3000/merge-pdfs', formData, {
-        responseType: 'blob',
-      });
+      const result = await runJob('/merge-pdfs', formData);
 
-      downloadFile(response.data, 'merged.pdf');
+      downloadFile(result, 'merged.pdf');
     } catch (err) {
       console.log(err);
       setError('Error merging PDFs. Please try again.');
     } finally {
       setLoading(false);
+      setProgress('');
     }
   };
 
@@ -87,7 +140,7 @@ const PdfProcessor: React.FC = () => {
     formData.append('pdf', splitFile);
     formData.append('mode', splitMode);
 
-    if (splitMode === 'pages') {
+    if (splitMode !== 'count') {
       if (!pages) {
         setError('Please enter page ranges');
         return;
@@ -103,16 +156,15 @@ const PdfProcessor: React.FC = () => {
 
     try {
       setLoading(true);
-      const response = await axios.post('http://localhost:3000/split-pdf', formData, {
-        responseType: 'blob',
-      });
+      const result = await runJob('/split-pdf', formData);
 
-      downloadFile(response.data, 'split_pdfs.zip');
+      downloadFile(result, 'split_pdfs.zip');
     } catch (err) {
       console.log(err);
       setError('Error splitting PDF. Please try again.');
     } finally {
       setLoading(false);
+      setProgress('');
     }
   };
 
@@ -128,16 +180,15 @@ const PdfProcessor: React.FC = () => {
 
     try {
       setLoading(true);
-      const response = await axios.post('http://localhost:3000/compress-pdf', formData, {
-        responseType: 'blob',
-      });
+      const result = await runJob('/compress-pdf', formData);
 
-      downloadFile(response.data, `compressed_${compressFile.name}`);
+      downloadFile(result, `compressed_${compressFile.name}`);
     } catch (err) {
       console.log(err);
       setError('Error compressing PDF. Please try again.');
     } finally {
       setLoading(false);
+      setProgress('');
     }
   };
 
@@ -239,12 +290,17 @@ const PdfProcessor: React.FC = () => {
             <FormControl component="fieldset" fullWidth sx={{ mb: 2 }}>
               <RadioGroup
                 value={splitMode}
-                onChange={(e) => setSplitMode(e.target.value as 'pages' | 'count')}
+                onChange={(e) => setSplitMode(e.target.value as 'pages' | 'extract' | 'count')}
               >
-                <FormControlLabel 
-                  value="pages" 
-                  control={<Radio />} 
-                  label="Split by Page Ranges (e.g., 1-3,5,7-9)" 
+                <FormControlLabel
+                  value="pages"
+                  control={<Radio />}
+                  label="Split Before Pages (e.g., 3,6)"
+                />
+                <FormControlLabel
+                  value="extract"
+                  control={<Radio />}
+                  label="Extract Page Ranges, One File per Range (e.g., 1-3,7,10-)"
                 />
                 <FormControlLabel
                   value="count"
@@ -254,14 +310,14 @@ const PdfProcessor: React.FC = () => {
               </RadioGroup>
             </FormControl>
 
-            {splitMode === 'pages' ? (
+            {splitMode !== 'count' ? (
               <TextField
                 fullWidth
                 label="Page Ranges"
                 value={pages}
                 onChange={(e) => setPages(e.target.value)}
                 sx={{ mb: 2 }}
-                placeholder="Example: 1-3,5,7-9"
+                placeholder="Example: 1-3,7,10-,odd,!5,last"
               />
             ) : (
               <TextField
@@ -317,6 +373,13 @@ const PdfProcessor: React.FC = () => {
           </Box>
         )}
 
+        {/* Progress Display */}
+        {loading && progress && (
+          <Typography variant="body2" color="text.secondary" sx={{ mt: 2 }}>
+            {progress}
+          </Typography>
+        )}
+
         {/* Error Display */}
         {error && (
           <Typography color="error" sx={{ mt: 2 }}>
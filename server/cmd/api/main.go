@@ -2,6 +2,9 @@ package main
 
 import (
 	"file-conv/internal/routes"
+
+	// Converter packages register themselves with the default registry
+	_ "file-conv/internal/converters/imageconv"
 )
 
 func main() {
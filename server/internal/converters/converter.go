@@ -0,0 +1,163 @@
+// Package converters defines the Converter interface and the registry that
+// mounts every registered converter as an HTTP endpoint.
+//
+// A converter package registers itself from an init function, the same way
+// image formats register with image.RegisterFormat, and is linked in with a
+// blank import in cmd/api/main.go.
+package converters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Converter turns one uploaded file into one output file
+type Converter interface {
+	// Name is the URL slug the converter is mounted under
+	Name() string
+	// InputTypes lists the MIME types the converter accepts
+	InputTypes() []string
+	// OutputTypes lists the MIME types the converter can produce
+	OutputTypes() []string
+	// Options describes the form fields the converter understands
+	Options() []Option
+	// Convert reads the input and returns the converted output. Returning a
+	// *Result lets the converter pick the response content type and filename.
+	Convert(ctx context.Context, in io.Reader, opts Options) (io.Reader, error)
+}
+
+// Option describes a single converter option
+type Option struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"` // "string", "int", "bool" or "enum"
+	Description string   `json:"description,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Values      []string `json:"values,omitempty"` // allowed values for "enum"
+	Required    bool     `json:"required,omitempty"`
+}
+
+// Options holds the option values of one conversion, with defaults applied
+type Options map[string]string
+
+// String returns the option value or an empty string
+func (o Options) String(name string) string {
+	return o[name]
+}
+
+// Int returns the option value as an integer, or def if it is not set
+func (o Options) Int(name string, def int) int {
+	v, err := strconv.Atoi(o[name])
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Bool returns the option value as a boolean, or false if it is not set
+func (o Options) Bool(name string) bool {
+	v, _ := strconv.ParseBool(o[name])
+	return v
+}
+
+// Result is an io.Reader carrying the metadata of the converted file
+type Result struct {
+	io.Reader
+	ContentType string
+	Filename    string
+}
+
+// NewResult wraps r with the content type and filename of the output
+func NewResult(r io.Reader, contentType, filename string) *Result {
+	return &Result{Reader: r, ContentType: contentType, Filename: filename}
+}
+
+// RequestError marks a conversion failure caused by the client's input
+type RequestError struct {
+	Msg string
+}
+
+func (e *RequestError) Error() string {
+	return e.Msg
+}
+
+// BadRequest returns an error that is reported to the client with status 400
+func BadRequest(format string, args ...any) error {
+	return &RequestError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// IsBadRequest reports whether err was caused by the client's input
+func IsBadRequest(err error) bool {
+	var re *RequestError
+	return errors.As(err, &re)
+}
+
+// validate fills in defaults and checks the values of the declared options.
+// Enum values match regardless of case and are stored as declared. With
+// lenient set, malformed numbers fall back to the default instead of
+// failing the request, as the original image endpoints did.
+func validate(c Converter, values func(string) string, lenient bool) (Options, error) {
+	opts := Options{}
+	for _, o := range c.Options() {
+		v := values(o.Name)
+		if v == "" {
+			if o.Required {
+				return nil, BadRequest("Missing option %s", o.Name)
+			}
+			v = o.Default
+		}
+		if v == "" {
+			continue
+		}
+		switch o.Type {
+		case "int":
+			if _, err := strconv.Atoi(v); err != nil {
+				if !lenient {
+					return nil, BadRequest("Invalid %s", o.Name)
+				}
+				if v = o.Default; v == "" {
+					continue
+				}
+			}
+		case "bool":
+			if _, err := strconv.ParseBool(v); err != nil {
+				return nil, BadRequest("Invalid %s", o.Name)
+			}
+		case "enum":
+			found := false
+			for _, allowed := range o.Values {
+				if strings.EqualFold(v, allowed) {
+					v, found = allowed, true
+					break
+				}
+			}
+			if !found {
+				return nil, BadRequest("Invalid %s", o.Name)
+			}
+		}
+		opts[o.Name] = v
+	}
+	return opts, nil
+}
+
+// Spec implements Converter from a description and a conversion function,
+// for converters that need no state of their own
+type Spec struct {
+	Slug    string
+	Inputs  []string
+	Outputs []string
+	Opts    []Option
+	Func    func(ctx context.Context, in io.Reader, opts Options) (io.Reader, error)
+}
+
+func (s *Spec) Name() string          { return s.Slug }
+func (s *Spec) InputTypes() []string  { return s.Inputs }
+func (s *Spec) OutputTypes() []string { return s.Outputs }
+func (s *Spec) Options() []Option     { return s.Opts }
+
+func (s *Spec) Convert(ctx context.Context, in io.Reader, opts Options) (io.Reader, error) {
+	return s.Func(ctx, in, opts)
+}
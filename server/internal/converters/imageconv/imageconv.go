@@ -0,0 +1,166 @@
+// Package imageconv registers the raster image converters
+package imageconv
+
+import (
+	"bytes"
+	"context"
+	"file-conv/internal/converters"
+	"file-conv/internal/utils"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/nfnt/resize"
+)
+
+func init() {
+	formats := append(utils.ImageFormatNames(), "jpg", "tif")
+	types := utils.ImageContentTypes()
+
+	converters.Register(&converters.Spec{
+		Slug:    "image",
+		Inputs:  types,
+		Outputs: types,
+		Opts: []converters.Option{
+			{Name: "to", Type: "enum", Values: formats, Required: true, Description: "Output format"},
+			{Name: "quality", Type: "int", Description: "JPEG quality (1-100)"},
+		},
+		Func: convertImage,
+	})
+	converters.Register(&converters.Spec{
+		Slug:    "compress",
+		Inputs:  types,
+		Outputs: types,
+		Opts: []converters.Option{
+			{Name: "quality", Type: "int", Default: "50", Description: "JPEG quality (1-100)"},
+			{Name: "format", Type: "enum", Values: formats, Description: "Output format, defaults to the input format"},
+		},
+		Func: compressImage,
+	})
+	converters.Register(&converters.Spec{
+		Slug:    "resize",
+		Inputs:  types,
+		Outputs: types,
+		Opts: []converters.Option{
+			{Name: "width", Type: "int", Description: "Target width, 0 keeps the aspect ratio"},
+			{Name: "height", Type: "int", Description: "Target height, 0 keeps the aspect ratio"},
+		},
+		Func: resizeImage,
+	})
+	converters.Register(&converters.Spec{
+		Slug:    "transparent",
+		Inputs:  types,
+		Outputs: []string{"image/png"},
+		Func:    backgroundTransparent,
+	})
+}
+
+func decode(in io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(in)
+	if err != nil {
+		return nil, "", converters.BadRequest("Failed to decode image")
+	}
+	return img, format, nil
+}
+
+func encode(img image.Image, format utils.ImageFormat, quality int, name string) (io.Reader, error) {
+	var buf bytes.Buffer
+	if err := utils.EncodeImage(&buf, img, format, quality); err != nil {
+		return nil, err
+	}
+	return converters.NewResult(&buf, format.ContentType, name+"."+format.Extension), nil
+}
+
+func convertImage(ctx context.Context, in io.Reader, opts converters.Options) (io.Reader, error) {
+	format, err := utils.LookupImageFormat(opts.String("to"))
+	if err != nil {
+		return nil, converters.BadRequest("Invalid output format")
+	}
+
+	// Input format is sniffed by the registered decoders
+	img, _, err := decode(in)
+	if err != nil {
+		return nil, err
+	}
+
+	quality := opts.Int("quality", 0)
+	if quality < 1 || quality > 100 {
+		quality = 0 // encoder default
+	}
+	return encode(img, format, quality, "converted")
+}
+
+func compressImage(ctx context.Context, in io.Reader, opts converters.Options) (io.Reader, error) {
+	img, format, err := decode(in)
+	if err != nil {
+		return nil, err
+	}
+
+	quality := opts.Int("quality", 50)
+	if quality < 1 || quality > 100 {
+		quality = 50 // default value
+	}
+
+	// Output keeps the input format unless another one is requested.
+	// Only JPEG uses the quality, the other encoders are lossless.
+	if to := opts.String("format"); to != "" {
+		format = to
+	}
+	outFormat, err := utils.LookupImageFormat(format)
+	if err != nil {
+		return nil, converters.BadRequest("Unsupported image format")
+	}
+	return encode(img, outFormat, quality, "compressed")
+}
+
+func resizeImage(ctx context.Context, in io.Reader, opts converters.Options) (io.Reader, error) {
+	img, format, err := decode(in)
+	if err != nil {
+		return nil, err
+	}
+
+	width := max(opts.Int("width", 0), 0)
+	height := max(opts.Int("height", 0), 0)
+	if width == 0 && height == 0 {
+		return nil, converters.BadRequest("At least one of width or height must be a positive integer")
+	}
+
+	// Resize image using Lanczos3 algorithm
+	resizedImg := resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
+
+	outFormat, err := utils.LookupImageFormat(format)
+	if err != nil {
+		return nil, converters.BadRequest("Unsupported image format")
+	}
+	return encode(resizedImg, outFormat, 0, "resized")
+}
+
+func backgroundTransparent(ctx context.Context, in io.Reader, opts converters.Options) (io.Reader, error) {
+	img, _, err := decode(in)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(bounds)
+
+	// Detect background color by sampling edges
+	backgroundColor := utils.DetectBackgroundColor(img)
+
+	// Iterate over each pixel
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			currentColor := img.At(x, y)
+			if utils.IsColorMatch(currentColor, backgroundColor) {
+				// Set transparent
+				rgba.Set(x, y, color.Transparent)
+			} else {
+				// Copy original color
+				rgba.Set(x, y, currentColor)
+			}
+		}
+	}
+
+	png, _ := utils.LookupImageFormat("png")
+	return encode(rgba, png, 0, "transparent")
+}
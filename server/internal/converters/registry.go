@@ -0,0 +1,180 @@
+package converters
+
+import (
+	"encoding/json"
+	"file-conv/internal/progress"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Uploads are read from the "file" field, falling back to the "image" field
+// used by the original image endpoints
+var fileFields = []string{"file", "image"}
+
+// Registry holds the available converters by name
+type Registry struct {
+	mu         sync.RWMutex
+	converters map[string]Converter
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{converters: make(map[string]Converter)}
+}
+
+// Register adds c to the registry. It fails if the name is already taken.
+func (reg *Registry) Register(c Converter) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.converters[c.Name()]; ok {
+		return fmt.Errorf("converter %q already registered", c.Name())
+	}
+	reg.converters[c.Name()] = c
+	return nil
+}
+
+// Lookup returns the converter registered under name
+func (reg *Registry) Lookup(name string) (Converter, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	c, ok := reg.converters[name]
+	return c, ok
+}
+
+// All returns the registered converters sorted by name
+func (reg *Registry) All() []Converter {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	list := make([]Converter, 0, len(reg.converters))
+	for _, c := range reg.converters {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// Mount registers GET /converters and POST /convert/{name} for every
+// converter on the router
+func (reg *Registry) Mount(router *http.ServeMux) {
+	router.HandleFunc("GET /converters", reg.ListConverters)
+	for _, c := range reg.All() {
+		router.HandleFunc("POST /convert/"+c.Name(), reg.Handler(c.Name()))
+	}
+}
+
+type converterInfo struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	InputTypes  []string `json:"inputTypes"`
+	OutputTypes []string `json:"outputTypes"`
+	Options     []Option `json:"options"`
+}
+
+// ListConverters responds with a JSON description of every converter
+func (reg *Registry) ListConverters(w http.ResponseWriter, r *http.Request) {
+	list := []converterInfo{}
+	for _, c := range reg.All() {
+		opts := c.Options()
+		if opts == nil {
+			opts = []Option{}
+		}
+		list = append(list, converterInfo{
+			Name:        c.Name(),
+			Path:        "/convert/" + c.Name(),
+			InputTypes:  c.InputTypes(),
+			OutputTypes: c.OutputTypes(),
+			Options:     opts,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// Handler returns the HTTP handler running the named converter
+func (reg *Registry) Handler(name string) http.HandlerFunc {
+	return reg.handler(name, false)
+}
+
+// LenientHandler is Handler for the original image endpoints, which ignore
+// malformed numeric options rather than rejecting the request
+func (reg *Registry) LenientHandler(name string) http.HandlerFunc {
+	return reg.handler(name, true)
+}
+
+func (reg *Registry) handler(name string, lenient bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := reg.Lookup(name)
+		if !ok {
+			http.Error(w, "Unknown converter", http.StatusNotFound)
+			return
+		}
+
+		// Parse multipart form with 50MB limit
+		if err := r.ParseMultipartForm(50 << 20); err != nil {
+			http.Error(w, "Error parsing form data", http.StatusBadRequest)
+			return
+		}
+
+		var file io.ReadCloser
+		for _, field := range fileFields {
+			f, _, err := r.FormFile(field)
+			if err == nil {
+				file = f
+				break
+			}
+		}
+		if file == nil {
+			http.Error(w, "Failed to get uploaded file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		opts, err := validate(c, r.FormValue, lenient)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		progress.Report(r.Context(), progress.StageConverting, 0, 0)
+		out, err := c.Convert(r.Context(), file, opts)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if IsBadRequest(err) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		contentType, filename := "application/octet-stream", "converted"
+		if res, ok := out.(*Result); ok {
+			contentType, filename = res.ContentType, res.Filename
+		} else if types := c.OutputTypes(); len(types) > 0 {
+			contentType = types[0]
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+		_, _ = io.Copy(w, out)
+	}
+}
+
+// Default is the registry converter packages register with
+var Default = NewRegistry()
+
+// Register adds c to the default registry and panics on duplicate names,
+// since registration happens from init functions
+func Register(c Converter) {
+	if err := Default.Register(c); err != nil {
+		panic(err)
+	}
+}
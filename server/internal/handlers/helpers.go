@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"file-conv/internal/progress"
+	"file-conv/internal/textpdf"
+	"file-conv/internal/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// newPDFConfig returns a pdfcpu configuration that can open inputs protected
+// with the password from the "password" form field
+func newPDFConfig(r *http.Request) *model.Configuration {
+	config := model.NewDefaultConfiguration()
+	if pw := r.FormValue("password"); pw != "" {
+		config.UserPW = pw
+		config.OwnerPW = pw
+	}
+	return config
+}
+
+// pdfError reports a failed pdfcpu call. A missing or wrong password is the
+// client's fault and an operation forbidden by the permissions of the PDF
+// is refused, anything else is reported as a server error.
+func pdfError(w http.ResponseWriter, msg string, err error) {
+	pdfStatusError(w, msg, err, http.StatusInternalServerError)
+}
+
+// inputError reports an uploaded PDF that cannot be read or validated,
+// which is the client's fault
+func inputError(w http.ResponseWriter, msg string, err error) {
+	pdfStatusError(w, msg, err, http.StatusBadRequest)
+}
+
+func pdfStatusError(w http.ResponseWriter, msg string, err error, status int) {
+	switch {
+	case errors.Is(err, pdfcpu.ErrWrongPassword):
+		http.Error(w, msg+": incorrect or missing PDF password", http.StatusBadRequest)
+	case isRestricted(err):
+		http.Error(w, msg+": this PDF's permissions forbid the operation; supply the owner password", http.StatusForbidden)
+	default:
+		http.Error(w, msg+": "+err.Error(), status)
+	}
+}
+
+// isRestricted reports whether pdfcpu refused an operation because of the
+// permissions of a PDF opened with its user password. pdfcpu does not
+// export this error.
+func isRestricted(err error) bool {
+	return strings.Contains(err.Error(), "via pdfcpu's permission bits")
+}
+
+// generateError reports a failed PDF generation. Only images that cannot be
+// decoded or were not uploaded are the client's fault.
+func generateError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, utils.ErrInvalidImage) || errors.Is(err, textpdf.ErrMissingImage) {
+		status = http.StatusBadRequest
+	}
+	http.Error(w, "Failed to generate PDF: "+err.Error(), status)
+}
+
+// sendFile writes the file at path as an attachment
+func sendFile(w http.ResponseWriter, path, contentType, filename string) {
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Error opening output file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Error reading output file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
+	if _, err := io.Copy(w, f); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// sendZip sends the files in dir as a ZIP attachment
+func sendZip(w http.ResponseWriter, r *http.Request, dir, filename string) {
+	var buf bytes.Buffer
+	if err := writeZip(r.Context(), &buf, dir); err != nil {
+		http.Error(w, "Error creating zip archive", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	if _, err := io.Copy(w, &buf); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// writeZip writes a ZIP archive of the files directly in dir to out
+func writeZip(ctx context.Context, out io.Writer, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	zipWriter := zip.NewWriter(out)
+	for i, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		progress.Report(ctx, progress.StageZipping, i+1, len(entries))
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		// Create a zip header
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Method = zip.Deflate
+
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(writer, filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// countPages returns the page count of the PDF at path
+func countPages(path string, config *model.Configuration) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return api.PageCount(f, config)
+}
+
+// pageRangesError marks a page selection that does not parse or does not
+// fit the document, as opposed to a PDF that cannot be read
+type pageRangesError struct {
+	err error
+}
+
+func (e *pageRangesError) Error() string { return e.err.Error() }
+func (e *pageRangesError) Unwrap() error { return e.err }
+
+// selectPages resolves a page selection against the page count of a PDF
+func selectPages(pdfPath, expr string, config *model.Configuration) ([]int, error) {
+	sel, err := utils.ParsePageSelection(expr)
+	if err != nil {
+		return nil, &pageRangesError{err}
+	}
+	pageCount, err := countPages(pdfPath, config)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := sel.Pages(pageCount)
+	if err != nil {
+		return nil, &pageRangesError{err}
+	}
+	return pages, nil
+}
+
+// selectPagesError responds to an error of selectPages: 400 for the page
+// selection, otherwise as pdfError does for reading the PDF
+func selectPagesError(w http.ResponseWriter, err error) {
+	var rangesErr *pageRangesError
+	if errors.As(err, &rangesErr) {
+		http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	inputError(w, "Error reading PDF", err)
+}
+
+// readPDF reads and validates the PDF at path
+func readPDF(path string, config *model.Configuration) (*model.Context, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return api.ReadValidateAndOptimize(f, config)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func TestPDFErrorStatus(t *testing.T) {
+	// Opening with the user password leaves the permissions in force
+	config := model.NewAESConfiguration("user", "owner", 256)
+	config.Permissions = model.PermissionsNone
+	var restricted bytes.Buffer
+	if err := api.Encrypt(bytes.NewReader(testPDF(t, 2)), &restricted, config); err != nil {
+		t.Fatal(err)
+	}
+	broken := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Pages >>\nendobj\n%%EOF\n")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		data    []byte
+		fields  map[string]string
+		want    int
+	}{
+		{"wrong password", SplitPDF, restricted.Bytes(), map[string]string{"password": "wrong", "mode": "pages", "pages": "2"}, http.StatusBadRequest},
+		{"restricted", SplitPDF, restricted.Bytes(), map[string]string{"password": "user", "mode": "pages", "pages": "2"}, http.StatusForbidden},
+		{"owner password", SplitPDF, restricted.Bytes(), map[string]string{"password": "owner", "mode": "pages", "pages": "2"}, http.StatusOK},
+		{"broken", SplitPDF, broken, map[string]string{"mode": "pages", "pages": "2"}, http.StatusBadRequest},
+		{"broken info", InfoPDF, broken, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postPDF(t, tt.handler, tt.data, tt.fields); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestMergeBrokenInput(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range map[string][]byte{
+		"good.pdf":   testPDF(t, 1),
+		"broken.pdf": []byte("%PDF-1.7\n1 0 obj\n<< /Type /Pages >>\nendobj\n%%EOF\n"),
+	} {
+		part, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	MergePDFs(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// attachmentEntry is one attachment in the response of ListAttachmentsPDF
+type attachmentEntry struct {
+	attachmentInfo
+	Size int `json:"size"`
+}
+
+// AddAttachmentsPDF embeds the files uploaded in the "files" field into a
+// PDF. The optional "descriptions" field is a JSON object mapping uploaded
+// filenames to descriptions. A file replaces an attachment of the same name.
+func AddAttachmentsPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		http.Error(w, "No files to attach", http.StatusBadRequest)
+		return
+	}
+	descriptions := map[string]string{}
+	if s := r.FormValue("descriptions"); s != "" {
+		if err := json.Unmarshal([]byte(s), &descriptions); err != nil {
+			http.Error(w, "Invalid descriptions: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfattach-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := readPDF(inputPath, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	existing, err := ctx.ListAttachments()
+	if err != nil {
+		pdfError(w, "Error reading attachments", err)
+		return
+	}
+
+	now := time.Now()
+	for i, header := range files {
+		progress.Report(r.Context(), progress.StagePage, i+1, len(files))
+		name := filepath.Base(header.Filename)
+		for _, a := range existing {
+			if a.ID == name {
+				if _, err := ctx.RemoveAttachment(a); err != nil {
+					pdfError(w, "Error replacing attachment "+name, err)
+					return
+				}
+			}
+		}
+
+		f, err := header.Open()
+		if err != nil {
+			http.Error(w, "Error reading uploaded file "+name, http.StatusBadRequest)
+			return
+		}
+		a := model.Attachment{Reader: f, ID: name, FileName: name, Desc: descriptions[name], ModTime: &now}
+		err = ctx.AddAttachment(a, false)
+		f.Close()
+		if err != nil {
+			pdfError(w, "Error attaching "+name, err)
+			return
+		}
+	}
+
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
+	outputPath := filepath.Join(tempDir, "attached_"+filename)
+	if err := api.WriteContextFile(ctx, outputPath); err != nil {
+		pdfError(w, "Error writing PDF", err)
+		return
+	}
+
+	sendFile(w, outputPath, "application/pdf", "attached_"+filename)
+}
+
+// ListAttachmentsPDF returns the attachments of a PDF as JSON
+func ListAttachmentsPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfattachments-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, _, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := readPDF(inputPath, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	attachments, err := extractAttachments(ctx, nil)
+	if err != nil {
+		pdfError(w, "Error reading attachments", err)
+		return
+	}
+
+	entries := []attachmentEntry{}
+	for _, a := range attachments {
+		data, err := io.ReadAll(a)
+		if err != nil {
+			pdfError(w, "Error reading attachment "+a.FileName, err)
+			return
+		}
+		entries = append(entries, attachmentEntry{
+			attachmentInfo: attachmentInfo{FileName: a.FileName, Description: a.Desc, Modified: a.ModTime},
+			Size:           len(data),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"attachments": entries}); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// ExtractAttachmentsPDF returns the attachments of a PDF as a ZIP. The
+// optional "names" field is a JSON array of the attachments to extract.
+func ExtractAttachmentsPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	var names []string
+	if s := r.FormValue("names"); s != "" {
+		if err := json.Unmarshal([]byte(s), &names); err != nil {
+			http.Error(w, "Invalid names: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfattachments-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Attachments go to their own directory so the input is not zipped
+	outDir := filepath.Join(tempDir, "attachments")
+	if err := os.Mkdir(outDir, 0o755); err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := readPDF(inputPath, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	attachments, err := extractAttachments(ctx, names)
+	if err != nil {
+		var missing *missingAttachmentError
+		if errors.As(err, &missing) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		pdfError(w, "Error reading attachments", err)
+		return
+	}
+	if len(attachments) == 0 {
+		http.Error(w, "No attachments found", http.StatusNotFound)
+		return
+	}
+
+	// Attachments of the same name are numbered apart
+	used := map[string]bool{}
+	for i, a := range attachments {
+		progress.Report(r.Context(), progress.StageConverting, i+1, len(attachments))
+		name := utils.SafeFilename(filepath.Base(a.FileName))
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d%s", stem, n, ext)
+		}
+		used[name] = true
+
+		out, err := os.Create(filepath.Join(outDir, name))
+		if err != nil {
+			http.Error(w, "Error creating output file", http.StatusInternalServerError)
+			return
+		}
+		_, err = io.Copy(out, a)
+		out.Close()
+		if err != nil {
+			http.Error(w, "Error writing attachment "+a.FileName, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	sendZip(w, r, outDir, base+"_attachments.zip")
+}
+
+// missingAttachmentError names an attachment that was asked for but is
+// not in the PDF
+type missingAttachmentError struct{ name string }
+
+func (e *missingAttachmentError) Error() string {
+	return fmt.Sprintf("Attachment %q not found", e.name)
+}
+
+// extractAttachments returns the attachments of a PDF with their content,
+// all of them or those with the given names
+func extractAttachments(ctx *model.Context, names []string) ([]model.Attachment, error) {
+	stubs, err := ctx.ListAttachments()
+	if err != nil || len(stubs) == 0 {
+		return nil, err
+	}
+	var ids []string
+	for _, name := range names {
+		found := false
+		for _, a := range stubs {
+			if a.ID == name || a.FileName == name {
+				ids = append(ids, a.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, &missingAttachmentError{name}
+		}
+	}
+	return ctx.ExtractAttachments(ids)
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"file-conv/internal/pdfcontent"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// ExtractImagesPDF returns a ZIP of the images embedded in a PDF, each in the
+// format it is stored in. Images used on several pages are extracted once.
+func ExtractImagesPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	// Images smaller than minWidth x minHeight pixels, such as icons, are skipped
+	var minSize [2]int
+	for i, field := range []string{"minWidth", "minHeight"} {
+		if s := r.FormValue(field); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+field, http.StatusBadRequest)
+				return
+			}
+			minSize[i] = n
+		}
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfimages-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Extracted images go to their own directory so the input is not zipped
+	outDir := filepath.Join(tempDir, "images")
+	if err := os.Mkdir(outDir, 0o755); err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+
+	config := newPDFConfig(r)
+	var pageNrs []int
+	if expr := r.FormValue("pages"); expr != "" {
+		if pageNrs, err = selectPages(inputPath, expr, config); err != nil {
+			selectPagesError(w, err)
+			return
+		}
+	}
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	config.Cmd = model.EXTRACTIMAGES
+	ctx, err := readPDF(inputPath, config)
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	if pageNrs == nil {
+		for i := 1; i <= ctx.PageCount; i++ {
+			pageNrs = append(pageNrs, i)
+		}
+	}
+	pageDigits := 1
+	if len(pageNrs) > 0 {
+		pageDigits = len(strconv.Itoa(pageNrs[len(pageNrs)-1]))
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	seen := map[int]bool{}
+	extracted := 0
+	for _, pageNr := range pageNrs {
+		images, err := pdfcpu.ExtractPageImages(ctx, pageNr, false)
+		if err != nil {
+			pdfError(w, "Error extracting images", err)
+			return
+		}
+		for _, objNr := range slices.Sorted(maps.Keys(images)) {
+			if seen[objNr] {
+				continue
+			}
+			seen[objNr] = true
+			if width, height := imageSize(ctx.XRefTable, objNr); width < minSize[0] || height < minSize[1] {
+				continue
+			}
+			extracted++
+			progress.Report(r.Context(), progress.StageConverting, extracted, 0)
+
+			img := images[objNr]
+			name := fmt.Sprintf("%s_p%0*d_%s.%s", base, pageDigits, img.PageNr, utils.SafeFilename(img.Name), img.FileType)
+			if err := writeImage(filepath.Join(outDir, name), img); err != nil {
+				http.Error(w, "Error saving image", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if extracted == 0 {
+		http.Error(w, "No embedded images found", http.StatusNotFound)
+		return
+	}
+
+	sendZip(w, r, outDir, base+"_images.zip")
+}
+
+// imageSize returns the size in pixels of an image XObject. pdfcpu leaves
+// the Width and Height of model.Image unset.
+func imageSize(xRefTable *model.XRefTable, objNr int) (int, int) {
+	sd, _, err := xRefTable.DereferenceStreamDict(*types.NewIndirectRef(objNr, 0))
+	if err != nil || sd == nil {
+		return 0, 0
+	}
+	var size [2]int
+	for i, key := range []string{"Width", "Height"} {
+		if n, err := xRefTable.DereferenceInteger(sd.Dict[key]); err == nil && n != nil {
+			size[i] = n.Value()
+		}
+	}
+	return size[0], size[1]
+}
+
+func writeImage(path string, img model.Image) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = out.ReadFrom(img)
+	return err
+}
+
+// textPage is the text of one page in the JSON response of ExtractTextPDF
+type textPage struct {
+	Page   int         `json:"page"`
+	Width  float64     `json:"width"`
+	Height float64     `json:"height"`
+	Text   string      `json:"text"`
+	Blocks []textBlock `json:"blocks"`
+}
+
+// textBlock is positioned in points from the top-left corner of the page
+type textBlock struct {
+	Text     string  `json:"text"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	FontSize float64 `json:"fontSize"`
+}
+
+// ExtractTextPDF returns the text layer of a PDF, either as plain text with
+// pages separated by form feeds or as JSON with positioned text blocks.
+// Scanned pages without a text layer come back empty.
+func ExtractTextPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = "text"
+	}
+	if format != "text" && format != "json" {
+		http.Error(w, "Invalid format: must be text or json", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdftext-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		http.Error(w, "Error opening saved PDF file", http.StatusInternalServerError)
+		return
+	}
+	defer in.Close()
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := api.ReadAndValidate(in, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+
+	pages := make([]int, ctx.PageCount)
+	for i := range pages {
+		pages[i] = i + 1
+	}
+	if expr := r.FormValue("pages"); expr != "" {
+		sel, err := utils.ParsePageSelection(expr)
+		if err == nil {
+			pages, err = sel.Pages(ctx.PageCount)
+		}
+		if err != nil {
+			http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	fonts := pdfcontent.NewFonts(ctx.XRefTable)
+	result := make([]textPage, 0, len(pages))
+	for i, p := range pages {
+		progress.Report(r.Context(), progress.StageConverting, i+1, len(pages))
+		_, _, inh, err := ctx.PageDict(p, false)
+		if err != nil || inh == nil || inh.MediaBox == nil {
+			http.Error(w, fmt.Sprintf("Error reading page %d", p), http.StatusInternalServerError)
+			return
+		}
+		spans, err := pdfcontent.PageText(ctx.XRefTable, fonts, p)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading text of page %d: %v", p, err), http.StatusInternalServerError)
+			return
+		}
+
+		box := inh.MediaBox
+		page := textPage{Page: p, Width: round2(box.Width()), Height: round2(box.Height()), Blocks: []textBlock{}}
+		blocks := pdfcontent.Blocks(pdfcontent.Lines(spans))
+		page.Text = pdfcontent.PlainText(blocks)
+		for _, b := range blocks {
+			page.Blocks = append(page.Blocks, textBlock{
+				Text:     b.Text,
+				X:        round2(b.X - box.LL.X),
+				Y:        round2(box.UR.Y - b.Y - b.Height),
+				Width:    round2(b.Width),
+				Height:   round2(b.Height),
+				FontSize: round2(b.FontSize),
+			})
+		}
+		result = append(result, page)
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json\"", base))
+		if err := json.NewEncoder(w).Encode(map[string]any{"pages": result}); err != nil {
+			http.Error(w, "Error sending response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	texts := make([]string, len(result))
+	for i, page := range result {
+		texts[i] = page.Text
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.txt\"", base))
+	if _, err := io.WriteString(w, strings.Join(texts, "\f")+"\n"); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// round2 rounds a coordinate to hundredths of a point
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"file-conv/internal/utils"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// postPDF calls handler with data uploaded as "pdf" and the given form fields
+func postPDF(t *testing.T, handler http.HandlerFunc, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("pdf", "test.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// imagePDF lays out images of the given pixel sizes on pages of their own size
+func imagePDF(t *testing.T, sizes ...image.Point) []byte {
+	t.Helper()
+	var sources []utils.ImageSource
+	for _, size := range sizes {
+		img := image.NewNRGBA(image.Rectangle{Max: size})
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{uint8(x * 5), uint8(y * 5), 90, 255})
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, utils.ImageSource{Name: "image.png", Data: buf.Bytes()})
+	}
+	var pdf bytes.Buffer
+	if err := utils.ImagesToPDF(context.Background(), &pdf, sources, utils.PageLayout{Size: "fit", Orientation: "auto", Placement: "fit"}); err != nil {
+		t.Fatal(err)
+	}
+	return pdf.Bytes()
+}
+
+func TestExtractImagesMinSize(t *testing.T) {
+	data := imagePDF(t, image.Pt(40, 30), image.Pt(8, 8))
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   []image.Point
+	}{
+		{"all images", nil, []image.Point{{40, 30}, {8, 8}}},
+		{"min width", map[string]string{"minWidth": "10"}, []image.Point{{40, 30}}},
+		{"min width and height", map[string]string{"minWidth": "40", "minHeight": "30"}, []image.Point{{40, 30}}},
+		{"too small", map[string]string{"minHeight": "31"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postPDF(t, ExtractImagesPDF, data, tt.fields)
+			if tt.want == nil {
+				if rec.Code != http.StatusNotFound {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+				}
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(zr.File) != len(tt.want) {
+				t.Fatalf("got %d images, want %d", len(zr.File), len(tt.want))
+			}
+
+			// gofpdf shares image resources between pages, so the images are
+			// compared without regard to the page or order they come in
+			var got []image.Point
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				cfg, _, err := image.DecodeConfig(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatalf("%s: %v", f.Name, err)
+				}
+				got = append(got, image.Pt(cfg.Width, cfg.Height))
+			}
+			for _, want := range tt.want {
+				if !slices.Contains(got, want) {
+					t.Errorf("got images of %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"bytes"
+	"file-conv/internal/pdfcontent"
+	"file-conv/internal/pdfrender"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// formField is one field in the response of FormFieldsPDF. Values are
+// booleans for check boxes, lists for list boxes and strings otherwise.
+type formField struct {
+	Name    string   `json:"name"`
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Pages   []int    `json:"pages"`
+	Value   any      `json:"value"`
+	Default any      `json:"default,omitempty"`
+	Options []string `json:"options,omitempty"`
+	Locked  bool     `json:"locked"`
+}
+
+// fieldTypes names pdfcpu's field types in responses
+var fieldTypes = map[form.FieldType]string{
+	form.FTText:             "text",
+	form.FTDate:             "date",
+	form.FTCheckBox:         "checkbox",
+	form.FTComboBox:         "combobox",
+	form.FTListBox:          "listbox",
+	form.FTRadioButtonGroup: "radio",
+}
+
+func newFormField(f form.Field) formField {
+	field := formField{
+		Name:   f.Name,
+		ID:     f.ID,
+		Type:   fieldTypes[f.Typ],
+		Pages:  f.Pages,
+		Value:  fieldValue(f.Typ, f.V),
+		Locked: f.Locked,
+	}
+	if f.Dv != "" {
+		field.Default = fieldValue(f.Typ, f.Dv)
+	}
+	if f.Opts != "" {
+		field.Options = strings.Split(f.Opts, ",")
+	}
+	return field
+}
+
+func fieldValue(typ form.FieldType, v string) any {
+	switch typ {
+	case form.FTCheckBox:
+		return v != "" && v != "Off"
+	case form.FTListBox:
+		if v == "" {
+			return []string{}
+		}
+		return strings.Split(v, ",")
+	}
+	return v
+}
+
+// formValues maps field names or IDs to the values to fill in, as strings
+// pdfcpu understands: "true" or "false" for check boxes and one string per
+// selected entry for list boxes
+type formValues map[string][]string
+
+// parseFormValue converts a value decoded from JSON or read from a CSV cell,
+// in which list box entries are separated by commas
+func parseFormValue(f form.Field, v any) ([]string, error) {
+	var vv []string
+	switch v := v.(type) {
+	case string:
+		vv = []string{v}
+		if f.Typ == form.FTListBox {
+			vv = strings.Split(v, ",")
+		}
+	case bool:
+		vv = []string{strconv.FormatBool(v)}
+	case float64:
+		vv = []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []any:
+		if f.Typ != form.FTListBox {
+			return nil, fmt.Errorf("field %q takes a single value", f.Name)
+		}
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %q takes a list of strings", f.Name)
+			}
+			vv = append(vv, s)
+		}
+	case nil:
+		vv = []string{""}
+	default:
+		return nil, fmt.Errorf("field %q has a value of unsupported type", f.Name)
+	}
+
+	switch f.Typ {
+	case form.FTCheckBox:
+		b, err := strconv.ParseBool(vv[0])
+		if err != nil {
+			return nil, fmt.Errorf("field %q takes true or false", f.Name)
+		}
+		vv[0] = strconv.FormatBool(b)
+	case form.FTComboBox, form.FTListBox, form.FTRadioButtonGroup:
+		opts := strings.Split(f.Opts, ",")
+		for _, s := range vv {
+			if s != "" && !slices.Contains(opts, s) {
+				return nil, fmt.Errorf("field %q has no option %q", f.Name, s)
+			}
+		}
+	}
+	return vv, nil
+}
+
+// newFormValues checks values against the fields of a form
+func newFormValues(fields []form.Field, values map[string]any) (formValues, error) {
+	fv := formValues{}
+	for key, v := range values {
+		i := slices.IndexFunc(fields, func(f form.Field) bool { return f.Name == key || f.ID == key })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		vv, err := parseFormValue(fields[i], v)
+		if err != nil {
+			return nil, err
+		}
+		fv[key] = vv
+	}
+	return fv, nil
+}
+
+// fillForm fills the form of ctx, leaving fields without a value and the
+// lock state of every field as they are
+func fillForm(ctx *model.Context, fields []form.Field, values formValues) error {
+	locked := map[string]bool{}
+	for _, f := range fields {
+		locked[f.ID] = f.Locked
+	}
+	details := func(id, name string, _ form.FieldType, _ form.DataFormat) ([]string, bool, bool) {
+		if vv, ok := values[name]; ok {
+			return vv, locked[id], true
+		}
+		vv, ok := values[id]
+		return vv, locked[id], ok
+	}
+
+	// Filled in forms no longer match their signatures
+	ctx.RemoveSignature()
+	_, _, err := form.FillForm(ctx, details, nil, form.CSV)
+	return err
+}
+
+// flattenForm draws the appearance of every visible form field into its
+// page and removes the form, so the values can no longer be edited
+func flattenForm(ctx *model.Context) error {
+	xRefTable := ctx.XRefTable
+	for p := 1; p <= ctx.PageCount; p++ {
+		pageDict, _, inherited, err := xRefTable.PageDict(p, false)
+		if err != nil {
+			return err
+		}
+		o, found := pageDict.Find("Annots")
+		if !found {
+			continue
+		}
+		annots, err := xRefTable.DereferenceArray(o)
+		if err != nil {
+			return err
+		}
+
+		var kept types.Array
+		var content bytes.Buffer
+		xObjects := types.Dict{}
+		for _, o := range annots {
+			d, err := xRefTable.DereferenceDict(o)
+			if err != nil {
+				return err
+			}
+			if d == nil || d.NameEntry("Subtype") == nil || *d.NameEntry("Subtype") != "Widget" {
+				kept = append(kept, o)
+				continue
+			}
+			ap, matrix, err := widgetAppearance(xRefTable, d)
+			if err != nil {
+				return err
+			}
+			if ap == nil {
+				continue
+			}
+			name := fmt.Sprintf("Flat%d", ap.ObjectNumber)
+			xObjects[name] = *ap
+			fmt.Fprintf(&content, "q %s cm /%s Do Q\n", matrix, name)
+		}
+
+		if len(kept) > 0 {
+			pageDict["Annots"] = kept
+		} else {
+			delete(pageDict, "Annots")
+		}
+		if len(xObjects) > 0 {
+			if err := drawOverPage(xRefTable, pageDict, inherited.Resources, xObjects, content.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	delete(xRefTable.RootDict, "AcroForm")
+	xRefTable.Form = nil
+	return nil
+}
+
+// widgetAppearance returns the form XObject showing a widget in its current
+// state and the matrix placing it on the page, or nil if nothing shows
+func widgetAppearance(xRefTable *model.XRefTable, d types.Dict) (*types.IndirectRef, string, error) {
+	if f := d.IntEntry("F"); f != nil && *f&(pdfrender.AnnotHidden|pdfrender.AnnotNoView) != 0 {
+		return nil, "", nil
+	}
+	apDict, err := xRefTable.DereferenceDict(d["AP"])
+	if err != nil || apDict == nil {
+		return nil, "", err
+	}
+	normal, found := apDict.Find("N")
+	if !found {
+		return nil, "", nil
+	}
+	// Check boxes and radio buttons have an appearance per state
+	if states, err := xRefTable.DereferenceDict(normal); err == nil && states != nil {
+		as := d.NameEntry("AS")
+		if as == nil {
+			return nil, "", nil
+		}
+		if normal, found = states.Find(*as); !found {
+			return nil, "", nil
+		}
+	}
+
+	ir, ok := normal.(types.IndirectRef)
+	if !ok {
+		sd, ok := normal.(types.StreamDict)
+		if !ok {
+			return nil, "", nil
+		}
+		newRef, err := xRefTable.IndRefForNewObject(sd)
+		if err != nil {
+			return nil, "", err
+		}
+		ir = *newRef
+	}
+	entry, found := xRefTable.FindTableEntryForIndRef(&ir)
+	if !found || entry.Object == nil {
+		return nil, "", nil
+	}
+	sd, ok := entry.Object.(types.StreamDict)
+	if !ok {
+		return nil, "", nil
+	}
+	sd.Dict["Type"] = types.Name("XObject")
+	sd.Dict["Subtype"] = types.Name("Form")
+
+	rect, err := rectEntry(xRefTable, d, "Rect")
+	if err != nil || rect == nil {
+		return nil, "", err
+	}
+	bbox, err := rectEntry(xRefTable, sd.Dict, "BBox")
+	if err != nil || bbox == nil {
+		return nil, "", err
+	}
+
+	// Map the bounding box, as transformed by the form matrix, onto the
+	// annotation rectangle
+	m := pdfcontent.Identity
+	if a, err := xRefTable.DereferenceArray(sd.Dict["Matrix"]); err == nil && len(a) == 6 {
+		for i, o := range a {
+			if m[i], err = xRefTable.DereferenceNumber(o); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	x0, y0, x1, y1 := pdfrender.TransformedBounds([]float64{bbox.LL.X, bbox.LL.Y, bbox.UR.X, bbox.UR.Y}, m)
+	if x1-x0 <= 0 || y1-y0 <= 0 {
+		return nil, "", nil
+	}
+	sx := rect.Width() / (x1 - x0)
+	sy := rect.Height() / (y1 - y0)
+	matrix := fmt.Sprintf("%s 0 0 %s %s %s", pdfNumber(sx), pdfNumber(sy),
+		pdfNumber(rect.LL.X-x0*sx), pdfNumber(rect.LL.Y-y0*sy))
+	return &ir, matrix, nil
+}
+
+func rectEntry(xRefTable *model.XRefTable, d types.Dict, key string) (*types.Rectangle, error) {
+	a, err := xRefTable.DereferenceArray(d[key])
+	if err != nil || len(a) != 4 {
+		return nil, err
+	}
+	var v [4]float64
+	for i, o := range a {
+		if v[i], err = xRefTable.DereferenceNumber(o); err != nil {
+			return nil, err
+		}
+	}
+	return types.NewRectangle(min(v[0], v[2]), min(v[1], v[3]), max(v[0], v[2]), max(v[1], v[3])), nil
+}
+
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// drawOverPage adds content drawing xObjects on top of a page. The page
+// content is wrapped in q/Q so whatever graphics state it leaves behind does
+// not affect the new content.
+func drawOverPage(xRefTable *model.XRefTable, pageDict, resources types.Dict, xObjects types.Dict, content []byte) error {
+	res := types.Dict{}
+	if resources != nil {
+		res = resources.Clone().(types.Dict)
+	}
+	xo := types.Dict{}
+	if d, err := xRefTable.DereferenceDict(res["XObject"]); err != nil {
+		return err
+	} else if d != nil {
+		xo = d.Clone().(types.Dict)
+	}
+	for name, ir := range xObjects {
+		xo[name] = ir
+	}
+	res["XObject"] = xo
+	pageDict["Resources"] = res
+
+	stream := func(bb []byte) (*types.IndirectRef, error) {
+		sd, err := xRefTable.NewStreamDictForBuf(bb)
+		if err != nil {
+			return nil, err
+		}
+		if err := sd.Encode(); err != nil {
+			return nil, err
+		}
+		return xRefTable.IndRefForNewObject(*sd)
+	}
+	begin, err := stream([]byte("q\n"))
+	if err != nil {
+		return err
+	}
+	end, err := stream(append([]byte("\nQ\n"), content...))
+	if err != nil {
+		return err
+	}
+
+	contents := types.Array{*begin}
+	if o, found := pageDict.Find("Contents"); found {
+		if ir, ok := o.(types.IndirectRef); ok {
+			if a, err := xRefTable.DereferenceArray(ir); err == nil && a != nil {
+				o = a
+			}
+		}
+		if a, ok := o.(types.Array); ok {
+			contents = append(contents, a...)
+		} else {
+			contents = append(contents, o)
+		}
+	}
+	pageDict["Contents"] = append(contents, *end)
+	return nil
+}
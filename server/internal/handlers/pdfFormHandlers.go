@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// FormFieldsPDF returns the form fields of a PDF as JSON
+func FormFieldsPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfform-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, _, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := readPDF(inputPath, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	fields := []formField{}
+	if ctx.Form != nil {
+		list, _, err := form.FormFields(ctx)
+		if err != nil {
+			pdfError(w, "Error reading form fields", err)
+			return
+		}
+		for _, f := range list {
+			fields = append(fields, newFormField(f))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"fields": fields}); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// FillFormPDF fills the form of a PDF with the "values" field, a JSON object
+// mapping field names to values. In batch mode a "csv" file is uploaded
+// instead: its header row names the fields, every further row fills one
+// copy of the form and the copies are returned as a ZIP. Empty cells leave
+// a field as it is. With flatten=true the fields are drawn into the pages
+// and can no longer be edited.
+func FillFormPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	flatten := false
+	if v := r.FormValue("flatten"); v != "" {
+		var err error
+		if flatten, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid flatten value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Rows of values, a single one unless a CSV is uploaded
+	var rows []map[string]any
+	file, _, err := r.FormFile("csv")
+	batch := err == nil
+	if batch {
+		records, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			http.Error(w, "Invalid CSV: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(records) < 2 {
+			http.Error(w, "Invalid CSV: a header row and at least one row of values are required", http.StatusBadRequest)
+			return
+		}
+		for _, record := range records[1:] {
+			row := map[string]any{}
+			for i, name := range records[0] {
+				if i < len(record) && record[i] != "" {
+					row[strings.TrimSpace(name)] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+	} else {
+		values := map[string]any{}
+		if err := json.Unmarshal([]byte(r.FormValue("values")), &values); err != nil {
+			http.Error(w, "Invalid values: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		rows = append(rows, values)
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfformfill-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	template, err := os.ReadFile(inputPath)
+	if err != nil {
+		http.Error(w, "Error reading saved PDF file", http.StatusInternalServerError)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	config := newPDFConfig(r)
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(template), config)
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	if ctx.Form == nil {
+		http.Error(w, "The PDF has no form", http.StatusBadRequest)
+		return
+	}
+	fields, _, err := form.FormFields(ctx)
+	if err != nil {
+		pdfError(w, "Error reading form fields", err)
+		return
+	}
+
+	values := make([]formValues, len(rows))
+	for i, row := range rows {
+		if values[i], err = newFormValues(fields, row); err != nil {
+			msg := "Invalid values: "
+			if batch {
+				msg = fmt.Sprintf("Invalid values in row %d: ", i+1)
+			}
+			http.Error(w, msg+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	fill := func(ctx *model.Context, values formValues, outPath string) error {
+		if err := fillForm(ctx, fields, values); err != nil {
+			return err
+		}
+		if flatten {
+			if err := flattenForm(ctx); err != nil {
+				return err
+			}
+		}
+		return api.WriteContextFile(ctx, outPath)
+	}
+
+	if !batch {
+		progress.Report(r.Context(), progress.StageConverting, 0, 0)
+		outputPath := filepath.Join(tempDir, "filled_"+filename)
+		if err := fill(ctx, values[0], outputPath); err != nil {
+			pdfError(w, "Error filling form", err)
+			return
+		}
+		sendFile(w, outputPath, "application/pdf", "filled_"+filename)
+		return
+	}
+
+	// Filled copies go to their own directory so the template is not zipped
+	outDir := filepath.Join(tempDir, "filled")
+	if err := os.Mkdir(outDir, 0o755); err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	digits := len(strconv.Itoa(len(values)))
+	for i, v := range values {
+		progress.Report(r.Context(), progress.StageConverting, i+1, len(values))
+		// Each copy is filled from a fresh read of the template
+		if i > 0 {
+			if ctx, err = api.ReadValidateAndOptimize(bytes.NewReader(template), config); err != nil {
+				inputError(w, "Error reading PDF", err)
+				return
+			}
+		}
+		outputPath := filepath.Join(outDir, fmt.Sprintf("%s_%0*d.pdf", base, digits, i+1))
+		if err := fill(ctx, v, outputPath); err != nil {
+			pdfError(w, fmt.Sprintf("Error filling form for row %d", i+1), err)
+			return
+		}
+	}
+
+	sendZip(w, r, outDir, base+"_filled.zip")
+}
@@ -1,20 +1,34 @@
 package handlers
 
 import (
-	"archive/zip"
 	"bytes"
+	"context"
+	"file-conv/internal/progress"
 	"file-conv/internal/utils"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 )
 
+// MergePDFs concatenates the uploaded PDFs and images, which become pages
+// laid out like those of ConvertToPDF. Each file gets a bookmark named after
+// it unless bookmarks=false. With mode=interleave the pages
+// of two inputs alternate, as needed for the fronts and backs of a
+// double-sided scan; reverse=true then takes the second input back to
+// front. The ranges field picks pages per input instead, e.g.
+// "file1:1-3, file2:all, file1:4-". With repair=true inputs pdfcpu cannot
+// read are repaired first, see RepairPDF. Image pages take their margin
+// from imageMargin (or margin), the page numbers of number=true from
+// numberMargin.
 func MergePDFs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
@@ -27,6 +41,69 @@ func MergePDFs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Optionally number the merged document continuously, see NumberPDF
+	var numbering *pageNumbering
+	if number, _ := strconv.ParseBool(r.FormValue("number")); number {
+		var err error
+		numberValue := func(name string) string {
+			if name == "margin" {
+				return r.FormValue("numberMargin")
+			}
+			return r.FormValue(name)
+		}
+		if numbering, err = parsePageNumbering(numberValue); err != nil {
+			http.Error(w, "Invalid numbering: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = "append"
+	}
+	if mode != "append" && mode != "interleave" {
+		http.Error(w, "Invalid mode: must be append or interleave", http.StatusBadRequest)
+		return
+	}
+	var reverse bool
+	if v := r.FormValue("reverse"); v != "" {
+		var err error
+		if reverse, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid reverse value", http.StatusBadRequest)
+			return
+		}
+	}
+	ranges := r.FormValue("ranges")
+	if mode == "interleave" && ranges != "" {
+		http.Error(w, "Page ranges cannot be combined with interleave mode", http.StatusBadRequest)
+		return
+	}
+	bookmarks := true
+	if v := r.FormValue("bookmarks"); v != "" {
+		var err error
+		if bookmarks, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid bookmarks value", http.StatusBadRequest)
+			return
+		}
+	}
+	repair, err := parseRepair(r)
+	if err != nil {
+		http.Error(w, "Invalid repair value", http.StatusBadRequest)
+		return
+	}
+	// imageMargin names the margin of image pages apart from numberMargin,
+	// margin is still accepted for it
+	layout, err := utils.ParsePageLayout(func(name string) string {
+		if v := r.FormValue("imageMargin"); name == "margin" && v != "" {
+			return v
+		}
+		return r.FormValue(name)
+	})
+	if err != nil {
+		http.Error(w, "Invalid layout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Create temporary directory
 	tempDir, err := os.MkdirTemp("", "pdfmerge-")
 	if err != nil {
@@ -36,20 +113,95 @@ func MergePDFs(w http.ResponseWriter, r *http.Request) {
 	defer os.RemoveAll(tempDir)
 
 	// Process uploaded files
-	files, err := utils.ProcessUploadedFiles(r, tempDir)
+	files, err := utils.ProcessUploadedFiles(r, tempDir, layout)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if mode == "interleave" && len(files) != 2 {
+		http.Error(w, "Interleave mode needs exactly two files", http.StatusBadRequest)
+		return
+	}
+	var terms []utils.MergeTerm
+	if ranges != "" {
+		if terms, err = utils.ParseMergeSelection(ranges, len(files)); err != nil {
+			http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Merge PDFs
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	paths := make([]string, len(files))
+	counts := make([]int, len(files))
+	config := newPDFConfig(r)
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	if repair {
+		if err := repairInputs(paths, config); err != nil {
+			inputError(w, "Error repairing PDFs", err)
+			return
+		}
+	}
+	for i, f := range files {
+		progress.Report(r.Context(), progress.StagePage, i+1, len(files))
+		if counts[i], err = countPages(f.Path, config); err != nil {
+			inputError(w, "Error reading "+f.Name, err)
+			return
+		}
+	}
 	mergedPath := filepath.Join(tempDir, "merged.pdf")
-	config := model.NewDefaultConfiguration()
-	if err := api.MergeCreateFile(files, mergedPath, false, config); err != nil {
-		http.Error(w, "Error merging PDFs: "+err.Error(), http.StatusInternalServerError)
+	// Bookmarks are added below, named after the uploads
+	config.CreateBookmarks = false
+	progress.Report(r.Context(), progress.StageConverting, 0, 0)
+	if err := api.MergeCreateFile(paths, mergedPath, false, config); err != nil {
+		pdfError(w, "Error merging PDFs", err)
 		return
 	}
 
+	// Other orders are collected from the concatenated document
+	var pages []int
+	if mode == "interleave" || terms != nil {
+		if pages, err = mergeOrder(counts, terms, mode == "interleave", reverse); err != nil {
+			http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		orderedPath := filepath.Join(tempDir, "ordered.pdf")
+		if err := api.CollectFile(mergedPath, orderedPath, utils.PageGroup{Pages: pages}.PageStrings(), config); err != nil {
+			pdfError(w, "Error arranging merged pages", err)
+			return
+		}
+		mergedPath = orderedPath
+	}
+	if bookmarks {
+		bookmarkedPath := filepath.Join(tempDir, "bookmarked.pdf")
+		bms := sourceBookmarks(files, counts, pages, newPDFConfig(r))
+		if err := api.AddBookmarksFile(mergedPath, bookmarkedPath, bms, true, config); err != nil {
+			pdfError(w, "Error adding bookmarks", err)
+			return
+		}
+		mergedPath = bookmarkedPath
+	}
+	if numbering != nil {
+		pageCount, err := countPages(mergedPath, config)
+		if err != nil {
+			pdfError(w, "Error reading merged PDF", err)
+			return
+		}
+		pages := make([]int, pageCount)
+		for i := range pages {
+			pages[i] = i + 1
+		}
+		numberedPath := filepath.Join(tempDir, "numbered.pdf")
+		if err := numbering.apply(mergedPath, numberedPath, pages, pageCount, config); err != nil {
+			pdfError(w, "Error numbering merged PDF", err)
+			return
+		}
+		mergedPath = numberedPath
+	}
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
+
 	// Read merged file
 	mergedBytes, err := os.ReadFile(mergedPath)
 	if err != nil {
@@ -64,6 +216,104 @@ func MergePDFs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// pageOffsets returns the number of pages before each input of a merge
+func pageOffsets(counts []int) []int {
+	offsets := make([]int, len(counts))
+	for i := 1; i < len(counts); i++ {
+		offsets[i] = offsets[i-1] + counts[i-1]
+	}
+	return offsets
+}
+
+// mergeOrder returns the pages of the concatenated inputs, whose page
+// counts are given, in the order they are merged: interleaved, or as
+// selected by terms
+func mergeOrder(counts []int, terms []utils.MergeTerm, interleave, reverse bool) ([]int, error) {
+	offsets := pageOffsets(counts)
+
+	var pages []int
+	if interleave {
+		// Pages left over from the longer input follow at the end
+		for i := 0; i < max(counts[0], counts[1]); i++ {
+			if i < counts[0] {
+				pages = append(pages, offsets[0]+i+1)
+			}
+			if i < counts[1] {
+				p := i + 1
+				if reverse {
+					p = counts[1] - i
+				}
+				pages = append(pages, offsets[1]+p)
+			}
+		}
+		return pages, nil
+	}
+
+	for _, t := range terms {
+		groups, err := t.Selection.Groups(counts[t.File])
+		if err != nil {
+			return nil, fmt.Errorf("file%d: %w", t.File+1, err)
+		}
+		for _, g := range groups {
+			for _, p := range g.Pages {
+				pages = append(pages, offsets[t.File]+p)
+			}
+		}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages selected")
+	}
+	return pages, nil
+}
+
+// sourceBookmarks returns a bookmark per merged file, named after the
+// upload, on the first page taken from it. order gives the concatenated
+// pages in merged order, or nil if they were not rearranged; only then do
+// the files' own bookmarks stay valid, and they are nested below.
+func sourceBookmarks(files []utils.UploadedFile, counts, order []int, config *model.Configuration) []pdfcpu.Bookmark {
+	offsets := pageOffsets(counts)
+	var bms []pdfcpu.Bookmark
+	for i, f := range files {
+		bm := pdfcpu.Bookmark{Title: f.Name, PageFrom: offsets[i] + 1}
+		if order != nil {
+			bm.PageFrom = 0
+			for pos, p := range order {
+				if p > offsets[i] && p <= offsets[i]+counts[i] {
+					bm.PageFrom = pos + 1
+					break
+				}
+			}
+		} else if in, err := os.Open(f.Path); err == nil {
+			kids, err := api.Bookmarks(in, config)
+			in.Close()
+			if err == nil {
+				bm.Kids = shiftBookmarks(kids, offsets[i])
+			}
+		}
+		// Files left out entirely get no bookmark
+		if bm.PageFrom > 0 && counts[i] > 0 {
+			bms = append(bms, bm)
+		}
+	}
+	// pdfcpu wants bookmarks in page order
+	sort.SliceStable(bms, func(i, j int) bool { return bms[i].PageFrom < bms[j].PageFrom })
+	return bms
+}
+
+// shiftBookmarks moves bookmarks down by offset pages
+func shiftBookmarks(bms []pdfcpu.Bookmark, offset int) []pdfcpu.Bookmark {
+	out := make([]pdfcpu.Bookmark, 0, len(bms))
+	for _, bm := range bms {
+		if bm.PageFrom > 0 {
+			bm.PageFrom += offset
+		}
+		bm.Parent = nil
+		bm.Kids = shiftBookmarks(bm.Kids, offset)
+		out = append(out, bm)
+	}
+	return out
+}
+
 func SplitPDF(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
@@ -76,6 +326,12 @@ func SplitPDF(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	repair, err := parseRepair(r)
+	if err != nil {
+		http.Error(w, "Invalid repair value", http.StatusBadRequest)
+		return
+	}
+
 	// Process uploaded file
 	file, header, err := r.FormFile("pdf")
 	if err != nil {
@@ -105,6 +361,13 @@ func SplitPDF(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error copying file content", http.StatusInternalServerError)
 		return
 	}
+	config := newPDFConfig(r)
+	if repair {
+		if err := repairInputs([]string{pdfPath}, config); err != nil {
+			inputError(w, "Error repairing PDF", err)
+			return
+		}
+	}
 
 	// Reopen the saved PDF file
 	pdfFile, err := os.Open(pdfPath)
@@ -114,25 +377,56 @@ func SplitPDF(w http.ResponseWriter, r *http.Request) {
 	}
 	defer pdfFile.Close()
 
-	// Get split mode (pages or count)
+	// Split files go to their own directory so the input is not zipped
+	outDir := filepath.Join(tempDir, "split")
+	if err := os.Mkdir(outDir, 0o755); err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+
+	// Get split mode (pages, extract, count, bookmarks, size or blank)
 	mode := r.FormValue("mode")
-	config := model.NewDefaultConfiguration()
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
 
 	switch mode {
 	case "pages":
-		// Split by specific page numbers
-		pageRanges := r.FormValue("pages")
-		// Convert pageRanges to a slice of integers
-		pages, err := utils.ParsePageRanges(pageRanges)
+		// Split before each selected page
+		pages, err := selectPages(pdfPath, r.FormValue("pages"), config)
 		if err != nil {
-			http.Error(w, "Invalid page ranges", http.StatusBadRequest)
+			selectPagesError(w, err)
 			return
 		}
 		// Use SplitByPageNrFile for splitting by specific pages
-		if err := api.SplitByPageNrFile(pdfPath, tempDir, pages, config); err != nil {
-			http.Error(w, "Error splitting PDF: "+err.Error(), http.StatusInternalServerError)
+		if err := api.SplitByPageNrFile(pdfPath, outDir, pages, config); err != nil {
+			pdfError(w, "Error splitting PDF", err)
 			return
 		}
+	case "extract":
+		// One PDF per comma-separated group, e.g. "2-5,7,10-"
+		sel, err := utils.ParsePageSelection(r.FormValue("pages"))
+		if err != nil {
+			http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		pageCount, err := countPages(pdfPath, config)
+		if err != nil {
+			inputError(w, "Error reading PDF", err)
+			return
+		}
+		groups, err := sel.Groups(pageCount)
+		if err != nil {
+			http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		base := strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		for i, group := range groups {
+			progress.Report(r.Context(), progress.StagePage, i+1, len(groups))
+			name := fmt.Sprintf("%s_%02d_%s.pdf", base, i+1, utils.SafeFilename(group.Label))
+			if err := api.CollectFile(pdfPath, filepath.Join(outDir, name), group.PageStrings(), config); err != nil {
+				pdfError(w, "Error extracting pages", err)
+				return
+			}
+		}
 	case "count":
 		// Split by page count
 		pageCountStr := r.FormValue("count")
@@ -142,67 +436,62 @@ func SplitPDF(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		// Use Split with the specified span
-		if err := api.Split(pdfFile, tempDir, header.Filename, pageCount, config); err != nil {
-			http.Error(w, "Error splitting PDF: "+err.Error(), http.StatusInternalServerError)
+		if err := api.Split(pdfFile, outDir, header.Filename, pageCount, config); err != nil {
+			pdfError(w, "Error splitting PDF", err)
 			return
 		}
-	default:
-		http.Error(w, "Invalid split mode", http.StatusBadRequest)
-		return
-	}
-
-	// Create zip archive of split files
-	var buf bytes.Buffer
-	zipWriter := zip.NewWriter(&buf)
-
-	err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
+	case "bookmarks", "size", "blank":
+		// Bookmarks give titled parts, size keeps parts under maxSize
+		// megabytes and blank splits at separator pages, which are dropped
+		var maxBytes int64
+		if mode == "size" {
+			mb, err := strconv.ParseFloat(r.FormValue("maxSize"), 64)
+			if err != nil || mb <= 0 {
+				http.Error(w, "Invalid maxSize: must be a positive number of megabytes", http.StatusBadRequest)
+				return
+			}
+			maxBytes = int64(mb * (1 << 20))
 		}
-		fileToZip, err := os.Open(path)
+		pdf, err := api.ReadValidateAndOptimize(pdfFile, config)
 		if err != nil {
-			return err
+			inputError(w, "Error reading PDF", err)
+			return
 		}
-		defer fileToZip.Close()
-
-		// Create a zip header
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
+		var groups []utils.PageGroup
+		switch mode {
+		case "bookmarks":
+			groups, err = bookmarkGroups(pdf)
+		case "size":
+			groups, err = sizeGroups(r.Context(), pdf, maxBytes)
+		case "blank":
+			groups, err = blankGroups(r.Context(), pdf)
+		}
+		if isSplitInputError(err) {
+			http.Error(w, "Cannot split PDF: "+err.Error(), http.StatusBadRequest)
+			return
 		}
-		header.Name = info.Name()
-		header.Method = zip.Deflate
-
-		writer, err := zipWriter.CreateHeader(header)
 		if err != nil {
-			return err
+			pdfError(w, "Error splitting PDF", err)
+			return
 		}
-
-		if _, err := io.Copy(writer, fileToZip); err != nil {
-			return err
+		base := strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		if err := writeParts(r.Context(), pdf, groups, outDir, base); err != nil {
+			pdfError(w, "Error writing split PDFs", err)
+			return
 		}
-		return nil
-	})
-	if err != nil {
-		http.Error(w, "Error creating zip archive", http.StatusInternalServerError)
-		return
-	}
-
-	if err := zipWriter.Close(); err != nil {
-		http.Error(w, "Error closing zip writer", http.StatusInternalServerError)
+	default:
+		http.Error(w, "Invalid split mode", http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", "attachment; filename=split_pdfs.zip")
-	if _, err := io.Copy(w, &buf); err != nil {
-		http.Error(w, "Error sending response", http.StatusInternalServerError)
-	}
+	sendZip(w, r, outDir, "split_pdfs.zip")
 }
 
+// CompressPDFHandler removes redundant objects from a PDF and, with a preset
+// other than lossless, downsamples embedded images drawn above the preset's
+// resolution. The sizes before and after are reported in the
+// X-Original-Size and X-Compressed-Size headers. With repair=true an input
+// pdfcpu cannot read is repaired first, see RepairPDF.
 func CompressPDFHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
@@ -215,6 +504,17 @@ func CompressPDFHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	preset, err := parseCompressPreset(r.FormValue)
+	if err != nil {
+		http.Error(w, "Invalid compression options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	repair, err := parseRepair(r)
+	if err != nil {
+		http.Error(w, "Invalid repair value", http.StatusBadRequest)
+		return
+	}
+
 	// Retrieve the uploaded PDF file
 	file, header, err := r.FormFile("pdf")
 	if err != nil {
@@ -240,7 +540,8 @@ func CompressPDFHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer outFile.Close()
 
-	if _, err := io.Copy(outFile, file); err != nil {
+	originalSize, err := io.Copy(outFile, file)
+	if err != nil {
 		http.Error(w, "Error copying file content", http.StatusInternalServerError)
 		return
 	}
@@ -249,11 +550,19 @@ func CompressPDFHandler(w http.ResponseWriter, r *http.Request) {
 	outputPath := filepath.Join(tempDir, "compressed_"+header.Filename)
 
 	// Compress the PDF using pdfcpu
-	config := model.NewDefaultConfiguration()
-	if err := api.OptimizeFile(inputPath, outputPath, config); err != nil {
-		http.Error(w, "Error compressing PDF: "+err.Error(), http.StatusInternalServerError)
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	config := newPDFConfig(r)
+	if repair {
+		if err := repairInputs([]string{inputPath}, config); err != nil {
+			inputError(w, "Error repairing PDF", err)
+			return
+		}
+	}
+	if err := compressPDF(r.Context(), inputPath, outputPath, preset, config); err != nil {
+		pdfError(w, "Error compressing PDF", err)
 		return
 	}
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
 
 	// Read the compressed PDF
 	compressedFile, err := os.Open(outputPath)
@@ -273,7 +582,32 @@ func CompressPDFHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/pdf")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", "compressed_"+header.Filename))
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.Header().Set("X-Original-Size", strconv.FormatInt(originalSize, 10))
+	w.Header().Set("X-Compressed-Size", strconv.Itoa(buf.Len()))
 	if _, err := w.Write(buf.Bytes()); err != nil {
 		http.Error(w, "Error sending compressed PDF", http.StatusInternalServerError)
 	}
 }
+
+// compressPDF optimizes the PDF at inPath and downsamples its images
+// according to preset
+func compressPDF(ctx context.Context, inPath, outPath string, preset compressPreset, config *model.Configuration) error {
+	if preset.DPI == 0 {
+		return api.OptimizeFile(inPath, outPath, config)
+	}
+
+	f, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pdf, err := api.ReadValidateAndOptimize(f, config)
+	if err != nil {
+		return err
+	}
+	if _, err := downsampleImages(ctx, pdf, preset); err != nil {
+		return err
+	}
+	return api.WriteContextFile(pdf, outPath)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"file-conv/internal/progress"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// postFiles calls handler with files uploaded as "files" and the given form
+// fields
+func postFiles(t *testing.T, handler http.HandlerFunc, files map[string][]byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, filesRequest(t, files, fields))
+	return rec
+}
+
+func filesRequest(t *testing.T, files map[string][]byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range files {
+		part, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestMergeMargins(t *testing.T) {
+	files := map[string][]byte{"a.pdf": testPDF(t, 1), "b.pdf": testPDF(t, 2)}
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   string
+	}{
+		{"numbering", map[string]string{"number": "true", "numberMargin": "x"}, "Invalid numbering"},
+		{"image", map[string]string{"imageMargin": "x"}, "Invalid layout"},
+		{"image with numbering", map[string]string{"number": "true", "margin": "x"}, "Invalid layout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postFiles(t, MergePDFs, files, tt.fields)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("got %d %q, want 400 %q", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+
+	fields := map[string]string{"number": "true", "margin": "5", "imageMargin": "8", "numberMargin": "12"}
+	if rec := postFiles(t, MergePDFs, files, fields); rec.Code != http.StatusOK {
+		t.Errorf("status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestMergeProgress(t *testing.T) {
+	var events []progress.Event
+	files := map[string][]byte{"a.pdf": testPDF(t, 1), "b.pdf": testPDF(t, 2)}
+	req := filesRequest(t, files, nil)
+	req = req.WithContext(progress.WithReporter(req.Context(), func(e progress.Event) {
+		events = append(events, e)
+	}))
+	rec := httptest.NewRecorder()
+	MergePDFs(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	for _, want := range []progress.Event{
+		{Stage: progress.StagePage, Current: 1, Total: 2},
+		{Stage: progress.StagePage, Current: 2, Total: 2},
+		{Stage: progress.StageConverting},
+	} {
+		if !slices.Contains(events, want) {
+			t.Errorf("events %v do not include %v", events, want)
+		}
+	}
+}
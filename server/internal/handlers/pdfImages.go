@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"file-conv/internal/pdfcontent"
+	"file-conv/internal/progress"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// compressPreset controls how CompressPDFHandler treats embedded images
+type compressPreset struct {
+	DPI     int // images drawn above this resolution are downsampled, 0 keeps them
+	Quality int // JPEG quality of downsampled images
+}
+
+// Presets follow the usual print-to-PDF settings
+var compressPresets = map[string]compressPreset{
+	"screen":   {DPI: 72, Quality: 50},
+	"ebook":    {DPI: 150, Quality: 70},
+	"printer":  {DPI: 300, Quality: 85},
+	"lossless": {},
+}
+
+// Images are only resampled when that saves a noticeable share of pixels
+const downsampleThreshold = 1.2
+
+// parseCompressPreset reads the preset form field and the dpi and quality
+// fields that override it. Without a preset, images are left alone.
+func parseCompressPreset(value func(string) string) (compressPreset, error) {
+	name := strings.ToLower(value("preset"))
+	if name == "" {
+		name = "lossless"
+	}
+	preset, ok := compressPresets[name]
+	if !ok {
+		return preset, fmt.Errorf("invalid preset %q, use screen, ebook, printer or lossless", name)
+	}
+
+	if v := value("dpi"); v != "" {
+		dpi, err := strconv.Atoi(v)
+		if err != nil || dpi < 36 || dpi > 1200 {
+			return preset, fmt.Errorf("invalid dpi %q, must be between 36 and 1200", v)
+		}
+		preset.DPI = dpi
+		if preset.Quality == 0 {
+			preset.Quality = compressPresets["ebook"].Quality
+		}
+	}
+	if v := value("quality"); v != "" {
+		quality, err := strconv.Atoi(v)
+		if err != nil || quality < 1 || quality > 100 {
+			return preset, fmt.Errorf("invalid quality %q, must be between 1 and 100", v)
+		}
+		preset.Quality = quality
+	}
+	return preset, nil
+}
+
+// downsampleImages re-encodes the images of a document as JPEG, scaling
+// down those drawn at more than preset.DPI. Images that cannot be decoded,
+// or would not get smaller, are kept. It returns the number of images
+// replaced.
+func downsampleImages(ctx context.Context, pdf *model.Context, preset compressPreset) (int, error) {
+	if preset.DPI == 0 {
+		return 0, nil
+	}
+
+	// An image needs the resolution of its largest placement
+	sizes := map[int][2]float64{}
+	for p := 1; p <= pdf.PageCount; p++ {
+		placements, err := pdfcontent.PageImages(pdf.XRefTable, p)
+		if err != nil {
+			return 0, err
+		}
+		for _, pl := range placements {
+			size := sizes[pl.ObjNr]
+			sizes[pl.ObjNr] = [2]float64{math.Max(size[0], pl.Width), math.Max(size[1], pl.Height)}
+		}
+	}
+
+	objNrs := make([]int, 0, len(sizes))
+	for objNr := range sizes {
+		objNrs = append(objNrs, objNr)
+	}
+	sort.Ints(objNrs)
+
+	replaced := 0
+	for i, objNr := range objNrs {
+		progress.Report(ctx, progress.StageConverting, i+1, len(objNrs))
+		entry, ok := pdf.FindTableEntryLight(objNr)
+		if !ok || entry.Object == nil {
+			continue
+		}
+		sd, ok := entry.Object.(types.StreamDict)
+		if !ok {
+			continue
+		}
+
+		// Pixels needed to show the image at the target resolution
+		size := sizes[objNr]
+		width := math.Ceil(size[0] / 72 * float64(preset.DPI))
+		height := math.Ceil(size[1] / 72 * float64(preset.DPI))
+		newSD, ok := downsampleImage(pdf.XRefTable, sd, int(width), int(height), preset.Quality)
+		if !ok {
+			continue
+		}
+		entry.Object = *newSD
+		replaced++
+	}
+	return replaced, nil
+}
+
+// downsampleImage returns a JPEG version of an image XObject scaled down to
+// at most width x height pixels, or false if the image is kept
+func downsampleImage(xRefTable *model.XRefTable, sd types.StreamDict, width, height, quality int) (*types.StreamDict, bool) {
+	// Masks and decode arrays depend on exact sample values, which JPEG
+	// does not keep
+	if mask := sd.BooleanEntry("ImageMask"); mask != nil && *mask {
+		return nil, false
+	}
+	for _, key := range []string{"Mask", "Decode"} {
+		if _, ok := sd.Find(key); ok {
+			return nil, false
+		}
+	}
+
+	w, h := sd.IntEntry("Width"), sd.IntEntry("Height")
+	if w == nil || h == nil || *w <= 0 || *h <= 0 || width <= 0 || height <= 0 {
+		return nil, false
+	}
+	// Images at the target resolution are still worth re-encoding when
+	// they are stored losslessly, but JPEGs would only lose quality
+	scale := math.Min(float64(width)/float64(*w), float64(height)/float64(*h))
+	if scale*downsampleThreshold >= 1 {
+		if len(sd.FilterPipeline) > 0 && sd.FilterPipeline[len(sd.FilterPipeline)-1].Name == filter.DCT {
+			return nil, false
+		}
+		scale = 1
+	}
+
+	img, space, ok := decodeImage(xRefTable, &sd, *w, *h)
+	if !ok {
+		return nil, false
+	}
+	newW := max(1, int(math.Round(float64(*w)*scale)))
+	newH := max(1, int(math.Round(float64(*h)*scale)))
+	if scale < 1 {
+		img = resize.Resize(uint(newW), uint(newH), img, resize.Lanczos3)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, false
+	}
+	if buf.Len() >= len(sd.Raw) {
+		return nil, false
+	}
+
+	d := sd.Dict.Clone().(types.Dict)
+	for _, key := range []string{"DecodeParms", "Length", "SMaskInData"} {
+		delete(d, key)
+	}
+	d["Width"] = types.Integer(newW)
+	d["Height"] = types.Integer(newH)
+	d["BitsPerComponent"] = types.Integer(8)
+	d["ColorSpace"] = space
+	d["Filter"] = types.Name(filter.DCT)
+
+	length := int64(buf.Len())
+	newSD := types.NewStreamDict(d, 0, &length, nil, []types.PDFFilter{{Name: filter.DCT}})
+	newSD.Raw = buf.Bytes()
+	newSD.Update("Length", types.Integer(length))
+	return &newSD, true
+}
+
+// decodeImage decodes the samples of an image XObject. It also returns the
+// colour space a JPEG of the image declares; CMYK becomes DeviceRGB and
+// indexed images take their base colour space.
+func decodeImage(xRefTable *model.XRefTable, sd *types.StreamDict, w, h int) (image.Image, types.Object, bool) {
+	cs, _ := xRefTable.Dereference(sd.Dict["ColorSpace"])
+	n, space, palette, ok := imageColorSpace(xRefTable, cs)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// JPEGs are decoded directly; other filters must be ones pdfcpu decodes
+	fpl := sd.FilterPipeline
+	if len(fpl) == 1 && fpl[0].Name == filter.DCT {
+		img, err := jpeg.Decode(bytes.NewReader(sd.Raw))
+		if err != nil || palette != nil {
+			return nil, nil, false
+		}
+		// Keep the colour space consistent with what the JPEG holds
+		switch _, isGray := img.(*image.Gray); {
+		case isGray && n != 1:
+			space = types.Name("DeviceGray")
+		case !isGray && n == 1:
+			space = types.Name("DeviceRGB")
+		}
+		return img, space, true
+	}
+	for _, f := range fpl {
+		switch f.Name {
+		case filter.DCT, filter.JPX, filter.CCITTFax, "JBIG2Decode":
+			return nil, nil, false
+		}
+	}
+	if bpc := sd.IntEntry("BitsPerComponent"); bpc == nil || *bpc != 8 {
+		return nil, nil, false
+	}
+	if err := sd.Decode(); err != nil {
+		return nil, nil, false
+	}
+
+	samples := sd.Content
+	if palette != nil {
+		if len(samples) < w*h {
+			return nil, nil, false
+		}
+		expanded := make([]byte, 0, w*h*n)
+		for _, index := range samples[:w*h] {
+			entry := int(index) * n
+			if entry+n > len(palette) {
+				return nil, nil, false
+			}
+			expanded = append(expanded, palette[entry:entry+n]...)
+		}
+		samples = expanded
+	}
+	if len(samples) < w*h*n {
+		return nil, nil, false
+	}
+
+	rect := image.Rect(0, 0, w, h)
+	switch n {
+	case 1:
+		return &image.Gray{Pix: samples[:w*h], Stride: w, Rect: rect}, space, true
+	case 3:
+		img := image.NewRGBA(rect)
+		for i := 0; i < w*h; i++ {
+			copy(img.Pix[i*4:i*4+3], samples[i*3:i*3+3])
+			img.Pix[i*4+3] = 0xff
+		}
+		return img, space, true
+	case 4:
+		return &image.CMYK{Pix: samples[:w*h*4], Stride: w * 4, Rect: rect}, space, true
+	}
+	return nil, nil, false
+}
+
+// imageColorSpace resolves the colour space of an image into its number of
+// components and the colour space of its JPEG version. Indexed colour
+// spaces also return their palette, in components of the base space.
+func imageColorSpace(xRefTable *model.XRefTable, o types.Object) (int, types.Object, []byte, bool) {
+	switch cs := o.(type) {
+	case types.Name:
+		switch cs {
+		case "DeviceGray", "CalGray":
+			return 1, cs, nil, true
+		case "DeviceRGB", "CalRGB":
+			return 3, cs, nil, true
+		case "DeviceCMYK":
+			return 4, types.Name("DeviceRGB"), nil, true
+		}
+	case types.Array:
+		if len(cs) == 0 {
+			break
+		}
+		name, _ := xRefTable.Dereference(cs[0])
+		switch name {
+		case types.Name("CalGray"):
+			return 1, cs, nil, true
+		case types.Name("CalRGB"):
+			return 3, cs, nil, true
+		case types.Name("ICCBased"):
+			if len(cs) < 2 {
+				break
+			}
+			profile, _, err := xRefTable.DereferenceStreamDict(cs[1])
+			if err != nil || profile == nil {
+				break
+			}
+			switch n := profile.IntEntry("N"); {
+			case n == nil:
+			case *n == 1 || *n == 3:
+				return *n, cs, nil, true
+			case *n == 4:
+				return 4, types.Name("DeviceRGB"), nil, true
+			}
+		case types.Name("Indexed"), types.Name("I"):
+			if len(cs) < 4 {
+				break
+			}
+			base, _ := xRefTable.Dereference(cs[1])
+			n, space, palette, ok := imageColorSpace(xRefTable, base)
+			if !ok || palette != nil {
+				break
+			}
+			lookup, ok := indexedLookup(xRefTable, cs[3])
+			if !ok {
+				break
+			}
+			// CMYK palettes are converted here, as the JPEG is RGB anyway
+			if n == 4 {
+				rgb := make([]byte, 0, len(lookup)/4*3)
+				for i := 0; i+4 <= len(lookup); i += 4 {
+					r, g, b := color.CMYKToRGB(lookup[i], lookup[i+1], lookup[i+2], lookup[i+3])
+					rgb = append(rgb, r, g, b)
+				}
+				return 3, space, rgb, true
+			}
+			return n, space, lookup, true
+		}
+	}
+	return 0, nil, nil, false
+}
+
+// indexedLookup reads the palette of an indexed colour space
+func indexedLookup(xRefTable *model.XRefTable, o types.Object) ([]byte, bool) {
+	o, err := xRefTable.Dereference(o)
+	if err != nil {
+		return nil, false
+	}
+	switch v := o.(type) {
+	case types.StringLiteral:
+		b, err := types.Unescape(v.Value())
+		return b, err == nil
+	case types.HexLiteral:
+		b, err := v.Bytes()
+		return b, err == nil
+	case types.StreamDict:
+		if err := v.Decode(); err != nil {
+			return nil, false
+		}
+		return v.Content, true
+	}
+	return nil, false
+}
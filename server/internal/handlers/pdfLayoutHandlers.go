@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Sheet sizes for imposition, as pdfcpu paper size names
+var sheetSizes = map[string]string{
+	"a3":      "A3",
+	"a4":      "A4",
+	"a5":      "A5",
+	"letter":  "Letter",
+	"legal":   "Legal",
+	"tabloid": "Tabloid",
+}
+
+// Grid orders of n-up sheets: across then down, down then across, and
+// their right-to-left variants
+var nupOrders = []string{"rd", "dr", "ld", "dl"}
+
+// NUpPDF places several pages of a PDF on each sheet, e.g. for handouts.
+// The n field sets the pages per sheet (2, 3, 4, 8, 9, 12 or 16, default 4)
+// and order the way they fill the grid (rd, dr, ld or dl). By default the
+// sheet orientation keeps portrait pages upright.
+func NUpPDF(w http.ResponseWriter, r *http.Request) {
+	imposePDF(w, r, "nup", func(value func(string) string, conf *model.Configuration) (*model.NUp, error) {
+		n, err := parseSheetCount(value("n"), 4, []int{2, 3, 4, 8, 9, 12, 16})
+		if err != nil {
+			return nil, err
+		}
+		order := "rd"
+		if v := strings.ToLower(value("order")); v != "" {
+			if !slices.Contains(nupOrders, v) {
+				return nil, fmt.Errorf("invalid order %q, use rd, dr, ld or dl", v)
+			}
+			order = v
+		}
+		size, err := sheetSize(value)
+		if err != nil {
+			return nil, err
+		}
+		config := func(format string) (*model.NUp, error) {
+			return api.PDFNUpConfig(n, "formsize:"+format+", orientation:"+order, conf)
+		}
+
+		// auto takes the orientation whose grid cells are portrait
+		var nup *model.NUp
+		switch v := strings.ToLower(value("orientation")); v {
+		case "", "auto":
+			if nup, err = config(size + "P"); err == nil && !uprightCells(nup) {
+				nup, err = config(size + "L")
+			}
+		case "portrait":
+			nup, err = config(size + "P")
+		case "landscape":
+			nup, err = config(size + "L")
+		default:
+			return nil, fmt.Errorf("invalid orientation %q", v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nup, applySheetStyle(nup, value)
+	}, api.NUpFile)
+}
+
+// BookletPDF imposes a PDF as a saddle-stitch booklet: printed double-sided
+// and folded, the sheets read in page order. The n field sets the pages per
+// side of a sheet: 2, or 4 to cut each sheet in half, in which case binding
+// picks the long (default) or short edge of the pages to bind along.
+// guides=true draws fold and cut lines. The page count is padded with blank
+// pages as needed.
+func BookletPDF(w http.ResponseWriter, r *http.Request) {
+	imposePDF(w, r, "booklet", func(value func(string) string, config *model.Configuration) (*model.NUp, error) {
+		n, err := parseSheetCount(value("n"), 2, []int{2, 4})
+		if err != nil {
+			return nil, err
+		}
+		binding := model.LongEdge
+		switch v := strings.ToLower(value("binding")); v {
+		case "", "long":
+		case "short":
+			binding = model.ShortEdge
+		default:
+			return nil, fmt.Errorf("invalid binding %q, use long or short", v)
+		}
+		guides := false
+		if v := value("guides"); v != "" {
+			if guides, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("invalid guides value %q", v)
+			}
+		}
+		size, err := sheetSize(value)
+		if err != nil {
+			return nil, err
+		}
+		// pdfcpu lays booklets out on portrait sheets, turning the pages
+		nup, err := api.PDFBookletConfig(n, "formsize:"+size+"P", config)
+		if err != nil {
+			return nil, err
+		}
+		nup.BookletBinding = binding
+		nup.BookletGuides = guides
+		return nup, applySheetStyle(nup, value)
+	}, api.BookletFile)
+}
+
+// imposePDF runs an imposition of the uploaded PDF, configured from the
+// form fields by layout, and sends the result
+func imposePDF(w http.ResponseWriter, r *http.Request, name string,
+	layout func(value func(string) string, config *model.Configuration) (*model.NUp, error),
+	impose func(inFiles []string, outFile string, selectedPages []string, nup *model.NUp, conf *model.Configuration) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	config := newPDFConfig(r)
+	nup, err := layout(r.FormValue, config)
+	if err != nil {
+		http.Error(w, "Invalid layout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdf"+name+"-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var pages []string
+	if expr := r.FormValue("pages"); expr != "" {
+		selected, err := selectPages(inputPath, expr, config)
+		if err != nil {
+			selectPagesError(w, err)
+			return
+		}
+		pages = utils.PageGroup{Pages: selected}.PageStrings()
+	}
+
+	progress.Report(r.Context(), progress.StageConverting, 0, 0)
+	outputPath := filepath.Join(tempDir, name+"_"+filename)
+	if err := impose([]string{inputPath}, outputPath, pages, nup, config); err != nil {
+		pdfError(w, "Error imposing PDF", err)
+		return
+	}
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
+
+	sendFile(w, outputPath, "application/pdf", name+"_"+filename)
+}
+
+// parseSheetCount reads the number of pages per sheet
+func parseSheetCount(s string, def int, allowed []int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || !slices.Contains(allowed, n) {
+		names := make([]string, len(allowed))
+		for i, v := range allowed {
+			names[i] = strconv.Itoa(v)
+		}
+		return 0, fmt.Errorf("invalid n %q, use one of %s", s, strings.Join(names, ", "))
+	}
+	return n, nil
+}
+
+// sheetSize reads the paper size of the sheets, A4 by default
+func sheetSize(value func(string) string) (string, error) {
+	v := strings.ToLower(value("pageSize"))
+	if v == "" {
+		return "A4", nil
+	}
+	size, ok := sheetSizes[v]
+	if !ok {
+		return "", fmt.Errorf("invalid page size %q", v)
+	}
+	return size, nil
+}
+
+// applySheetStyle sets the margin around each page, in millimetres, and
+// whether a border is drawn around it from the form fields
+func applySheetStyle(nup *model.NUp, value func(string) string) error {
+	if v := value("margin"); v != "" {
+		margin, err := strconv.ParseFloat(v, 64)
+		if err != nil || margin < 0 || margin > 50 {
+			return fmt.Errorf("invalid margin %q", v)
+		}
+		nup.Margin = margin * 72 / 25.4
+	}
+	if v := value("border"); v != "" {
+		border, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid border value %q", v)
+		}
+		nup.Border = border
+	}
+	return nil
+}
+
+// uprightCells reports whether the grid cells of a sheet are portrait
+func uprightCells(nup *model.NUp) bool {
+	cellWidth := nup.PageDim.Width / nup.Grid.Width
+	cellHeight := nup.PageDim.Height / nup.Grid.Height
+	return cellHeight >= cellWidth
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Form fields accepted by MetadataPDF and the info dictionary entries they set
+var metadataFields = map[string]string{
+	"title":    "Title",
+	"author":   "Author",
+	"subject":  "Subject",
+	"keywords": "Keywords",
+	"creator":  "Creator",
+}
+
+// pdfInfo is the response of InfoPDF. Sizes are in points.
+type pdfInfo struct {
+	FileName         string            `json:"fileName"`
+	Version          string            `json:"version"`
+	PageCount        int               `json:"pageCount"`
+	Pages            []pageSize        `json:"pages"`
+	Title            string            `json:"title"`
+	Author           string            `json:"author"`
+	Subject          string            `json:"subject"`
+	Keywords         []string          `json:"keywords"`
+	Creator          string            `json:"creator"`
+	Producer         string            `json:"producer"`
+	CreationDate     string            `json:"creationDate"`
+	ModificationDate string            `json:"modificationDate"`
+	Properties       map[string]string `json:"properties"`
+	Encrypted        bool              `json:"encrypted"`
+	Restrictions     []string          `json:"restrictions"` // permission flags as accepted by EncryptPDF
+	Tagged           bool              `json:"tagged"`
+	Linearized       bool              `json:"linearized"`
+	Form             bool              `json:"form"`
+	Bookmarks        bool              `json:"bookmarks"`
+	Signatures       bool              `json:"signatures"`
+	Watermarked      bool              `json:"watermarked"`
+	Fonts            []fontInfo        `json:"fonts"`
+	Attachments      []attachmentInfo  `json:"attachments"`
+}
+
+type pageSize struct {
+	Page     int     `json:"page"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	Rotation int     `json:"rotation"`
+}
+
+type fontInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Embedded bool   `json:"embedded"`
+	Subset   bool   `json:"subset"`
+}
+
+type attachmentInfo struct {
+	FileName    string     `json:"fileName"`
+	Description string     `json:"description,omitempty"`
+	Modified    *time.Time `json:"modified,omitempty"`
+}
+
+// InfoPDF describes a PDF: its metadata, page sizes, version, encryption,
+// fonts and attachments
+func InfoPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfinfo-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		http.Error(w, "Error opening saved PDF file", http.StatusInternalServerError)
+		return
+	}
+	defer in.Close()
+
+	// Optimizing collects the fonts of all pages and forms
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := api.ReadValidateAndOptimize(in, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	if err := pdfcpu.DetectWatermarks(ctx); err != nil {
+		pdfError(w, "Error reading PDF", err)
+		return
+	}
+	details, err := pdfcpu.Info(ctx, filename, nil)
+	if err != nil {
+		pdfError(w, "Error reading PDF", err)
+		return
+	}
+
+	info := pdfInfo{
+		FileName:         filename,
+		Version:          details.Version,
+		PageCount:        details.PageCount,
+		Title:            details.Title,
+		Author:           details.Author,
+		Subject:          details.Subject,
+		Keywords:         details.Keywords,
+		Creator:          details.Creator,
+		Producer:         details.Producer,
+		CreationDate:     details.CreationDate,
+		ModificationDate: details.ModificationDate,
+		Properties:       details.Properties,
+		Encrypted:        details.Encrypted,
+		Restrictions:     []string{},
+		Tagged:           details.Tagged,
+		Linearized:       details.Linearized,
+		Form:             details.Form,
+		Bookmarks:        details.Outlines,
+		Signatures:       details.Signatures,
+		Watermarked:      details.Watermarked,
+		Fonts:            []fontInfo{},
+		Attachments:      []attachmentInfo{},
+	}
+	if ctx.Info == nil {
+		xmpProperties(ctx, &info)
+	}
+	if info.Keywords == nil {
+		info.Keywords = []string{}
+	}
+
+	// Page sizes as displayed, i.e. with the page rotation applied
+	dims, err := ctx.PageDims()
+	if err != nil {
+		pdfError(w, "Error reading page sizes", err)
+		return
+	}
+	for i, d := range dims {
+		size := pageSize{Page: i + 1, Width: round2(d.Width), Height: round2(d.Height)}
+		if i < len(details.PageBoundaries) {
+			size.Rotation = details.PageBoundaries[i].Rot
+		}
+		info.Pages = append(info.Pages, size)
+	}
+
+	if ctx.E != nil {
+		for flag, bits := range permissionFlags {
+			if ctx.E.P&int(bits) != int(bits) {
+				info.Restrictions = append(info.Restrictions, flag)
+			}
+		}
+		sort.Strings(info.Restrictions)
+	}
+
+	for _, font := range ctx.Optimize.FontObjects {
+		info.Fonts = append(info.Fonts, fontInfo{
+			Name:     font.FontName,
+			Type:     font.SubType(),
+			Embedded: fontEmbedded(ctx.XRefTable, font.FontDict),
+			Subset:   font.Prefix != "",
+		})
+	}
+	sort.Slice(info.Fonts, func(i, j int) bool { return info.Fonts[i].Name < info.Fonts[j].Name })
+
+	for _, a := range details.Attachments {
+		info.Attachments = append(info.Attachments, attachmentInfo{FileName: a.FileName, Description: a.Desc, Modified: a.ModTime})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// xmpProperties reads the document properties from XMP metadata. pdfcpu
+// only does so when there is also an info dictionary, which PDF 2.0
+// documents usually lack.
+func xmpProperties(ctx *model.Context, info *pdfInfo) {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return
+	}
+	sd, _, err := ctx.DereferenceStreamDict(root["Metadata"])
+	if err != nil || sd == nil || sd.Decode() != nil {
+		return
+	}
+	var x model.XMPMeta
+	if err := xml.Unmarshal(sd.Content, &x); err != nil {
+		return
+	}
+
+	d := x.RDF.Description
+	info.Title = strings.Join(d.Title.Alt.Entries, ", ")
+	info.Author = strings.Join(d.Author.Seq.Entries, ", ")
+	info.Subject = strings.Join(d.Subject.Alt.Entries, ", ")
+	info.Creator = d.Creator
+	info.Producer = d.Producer
+	for _, kw := range strings.FieldsFunc(d.Keywords, func(r rune) bool { return r == ',' || r == ';' }) {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			info.Keywords = append(info.Keywords, kw)
+		}
+	}
+}
+
+// fontEmbedded reports whether the program of a font is embedded in the PDF
+func fontEmbedded(xRefTable *model.XRefTable, d types.Dict) bool {
+	switch subtype := d.Subtype(); {
+	case subtype == nil:
+		return false
+	case *subtype == "Type3":
+		// Type 3 glyphs are content streams of the font itself
+		return true
+	case *subtype == "Type0":
+		descendants, err := xRefTable.DereferenceArray(d["DescendantFonts"])
+		if err != nil || len(descendants) == 0 {
+			return false
+		}
+		if d, err = xRefTable.DereferenceDict(descendants[0]); err != nil || d == nil {
+			return false
+		}
+	}
+
+	fd, err := xRefTable.DereferenceDict(d["FontDescriptor"])
+	if err != nil || fd == nil {
+		return false
+	}
+	for _, key := range []string{"FontFile", "FontFile2", "FontFile3"} {
+		if _, ok := fd.Find(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataPDF sets the document properties given as form fields in both
+// the info dictionary and the XMP metadata. A field sent empty clears the
+// property; properties without a field are left alone.
+func MetadataPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	props := map[string]string{}
+	for field, key := range metadataFields {
+		if values, ok := r.MultipartForm.Value[field]; ok && len(values) > 0 {
+			props[key] = values[0]
+		}
+	}
+	if len(props) == 0 {
+		http.Error(w, "No metadata fields given, use title, author, subject, keywords or creator", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfmetadata-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		http.Error(w, "Error opening saved PDF file", http.StatusInternalServerError)
+		return
+	}
+	defer in.Close()
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := api.ReadValidateAndOptimize(in, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageConverting, 0, 0)
+	if err := setInfoDict(ctx, props); err != nil {
+		http.Error(w, "Error updating document info: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := setXMPMetadata(ctx, props, time.Now()); err != nil {
+		http.Error(w, "Error updating XMP metadata: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, "output.pdf")
+	if err := api.WriteContextFile(ctx, outputPath); err != nil {
+		pdfError(w, "Error writing PDF", err)
+		return
+	}
+
+	sendFile(w, outputPath, "application/pdf", "edited_"+filename)
+}
+
+// setInfoDict applies properties to the info dictionary, creating one if
+// needed. PDF 2.0 deprecates the info dictionary, so none is added there.
+func setInfoDict(ctx *model.Context, props map[string]string) error {
+	if ctx.Info == nil {
+		if ctx.XRefTable.Version() >= model.V20 {
+			return nil
+		}
+		ir, err := ctx.IndRefForNewObject(types.NewDict())
+		if err != nil {
+			return err
+		}
+		ctx.Info = ir
+	}
+
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || d == nil {
+		return err
+	}
+	for key, value := range props {
+		if value == "" {
+			delete(d, key)
+			continue
+		}
+		s, err := types.EscapedUTF16String(value)
+		if err != nil {
+			return err
+		}
+		d[key] = types.StringLiteral(*s)
+	}
+	return nil
+}
+
+// setXMPMetadata applies properties to the XMP metadata of the catalog. A
+// document without usable XMP metadata gets a new packet with all its
+// properties.
+func setXMPMetadata(ctx *model.Context, props map[string]string, now time.Time) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	var packet []byte
+	if sd, _, err := ctx.DereferenceStreamDict(root["Metadata"]); err == nil && sd != nil && sd.Decode() == nil {
+		packet, err = utils.UpdateXMP(sd.Content, props, now)
+		if err != nil {
+			packet = nil
+		}
+	}
+	if packet == nil {
+		all := map[string]string{}
+		for k, v := range props {
+			all[k] = v
+		}
+		if ctx.Info != nil {
+			if d, err := ctx.DereferenceDict(*ctx.Info); err == nil && d != nil {
+				for _, key := range metadataFields {
+					if s, err := ctx.DereferenceText(d[key]); err == nil && s != "" {
+						all[key] = s
+					}
+				}
+			}
+		}
+		packet = utils.NewXMP(all, now)
+	}
+
+	// Metadata streams stay uncompressed so that tools can find them
+	sd := types.StreamDict{Dict: types.NewDict(), Content: packet}
+	sd.InsertName("Type", "Metadata")
+	sd.InsertName("Subtype", "XML")
+	if err := sd.Encode(); err != nil {
+		return err
+	}
+	ir, err := ctx.IndRefForNewObject(sd)
+	if err != nil {
+		return err
+	}
+	root["Metadata"] = *ir
+	return nil
+}
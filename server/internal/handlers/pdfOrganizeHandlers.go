@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"encoding/json"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// pageOperation is one step of an organize request. Page numbers refer to
+// the uploaded document whatever the earlier steps did, so that a client
+// can take them from thumbnails of the original pages. Pages deleted by an
+// earlier step can no longer be referred to, and inserted pages cannot be.
+//
+//	{"op": "rotate", "pages": "3,5", "angle": 90}
+//	{"op": "move", "pages": "10", "before": 2}
+//	{"op": "delete", "pages": "7-8"}
+//	{"op": "insert", "after": 4, "count": 1}
+type pageOperation struct {
+	Op     string `json:"op"`
+	Pages  string `json:"pages"`
+	Angle  int    `json:"angle"`
+	Before *int   `json:"before"`
+	After  *int   `json:"after"`
+	Count  int    `json:"count"`
+}
+
+// OrganizePDF applies a list of page operations to a PDF. The operations are
+// applied in order and the result is only returned if all of them succeed.
+func OrganizePDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	var ops []pageOperation
+	if err := json.Unmarshal([]byte(r.FormValue("operations")), &ops); err != nil {
+		http.Error(w, "Invalid operations: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(ops) == 0 {
+		http.Error(w, "No operations given", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdforganize-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	currentPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config := newPDFConfig(r)
+	pageCount, err := countPages(currentPath, config)
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+
+	// The original number of every page in the current document, 0 for
+	// inserted pages
+	order := make([]int, pageCount)
+	for i := range order {
+		order[i] = i + 1
+	}
+
+	for i, op := range ops {
+		progress.Report(r.Context(), progress.StagePage, i+1, len(ops))
+		step, next, err := op.plan(order, pageCount)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid operation %d (%s): %v", i+1, op.Op, err), http.StatusBadRequest)
+			return
+		}
+		order = next
+		if step == nil {
+			continue
+		}
+		nextPath := filepath.Join(tempDir, fmt.Sprintf("step%02d.pdf", i+1))
+		if err := step(currentPath, nextPath, config); err != nil {
+			pdfError(w, fmt.Sprintf("Error applying operation %d (%s)", i+1, op.Op), err)
+			return
+		}
+		currentPath = nextPath
+	}
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
+
+	sendFile(w, currentPath, "application/pdf", "organized_"+filename)
+}
+
+// pageStep rewrites the PDF at inFile into outFile
+type pageStep func(inFile, outFile string, config *model.Configuration) error
+
+// plan checks the operation against the original pageCount pages, maps its
+// page numbers into the current document, whose pages are the originals in
+// order, and returns the step that carries it out, or nil if there is
+// nothing to do, together with the page order after the step
+func (op pageOperation) plan(order []int, pageCount int) (pageStep, []int, error) {
+	switch op.Op {
+	case "rotate":
+		if op.Angle%90 != 0 {
+			return nil, nil, fmt.Errorf("angle must be a multiple of 90")
+		}
+		pages, err := op.selectPages(order, pageCount)
+		if err != nil {
+			return nil, nil, err
+		}
+		angle := (op.Angle%360 + 360) % 360
+		if angle == 0 {
+			return nil, order, nil
+		}
+		return func(inFile, outFile string, config *model.Configuration) error {
+			return api.RotateFile(inFile, outFile, angle, utils.PageGroup{Pages: pages}.PageStrings(), config)
+		}, order, nil
+
+	case "delete":
+		pages, err := op.selectPages(order, pageCount)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(pages) == len(order) {
+			return nil, nil, fmt.Errorf("cannot delete every page")
+		}
+		var next []int
+		for i, p := range order {
+			if !slices.Contains(pages, i+1) {
+				next = append(next, p)
+			}
+		}
+		return func(inFile, outFile string, config *model.Configuration) error {
+			return api.RemovePagesFile(inFile, outFile, utils.PageGroup{Pages: pages}.PageStrings(), config)
+		}, next, nil
+
+	case "insert":
+		target, before, err := op.target(order, pageCount)
+		if err != nil {
+			return nil, nil, err
+		}
+		count := op.Count
+		if count == 0 {
+			count = 1
+		}
+		if count < 0 || count > 100 {
+			return nil, nil, fmt.Errorf("count must be between 1 and 100")
+		}
+		at := target
+		if before {
+			at--
+		}
+		next := slices.Insert(slices.Clone(order), at, make([]int, count)...)
+		// pdfcpu inserts one blank page per call. Left to itself it sizes
+		// the page from the page tree, often A4, so it is given the size of
+		// the neighbouring page.
+		return func(inFile, outFile string, config *model.Configuration) error {
+			pageConf, err := pageSizeOf(inFile, target, config)
+			if err != nil {
+				return err
+			}
+			page := []string{strconv.Itoa(target)}
+			for i := 0; i < count; i++ {
+				out := fmt.Sprintf("%s.%d", outFile, i)
+				if i == count-1 {
+					out = outFile
+				}
+				if err := api.InsertPagesFile(inFile, out, page, before, pageConf, config); err != nil {
+					return err
+				}
+				inFile = out
+			}
+			return nil
+		}, next, nil
+
+	case "move":
+		moved, err := op.selectPages(order, pageCount)
+		if err != nil {
+			return nil, nil, err
+		}
+		target, before, err := op.target(order, pageCount)
+		if err != nil {
+			return nil, nil, err
+		}
+		if slices.Contains(moved, target) {
+			return nil, nil, fmt.Errorf("page %d cannot be moved relative to itself", order[target-1])
+		}
+
+		// Build the new page order and let pdfcpu collect the pages in it
+		var collect []string
+		var next []int
+		add := func(pages ...int) {
+			for _, p := range pages {
+				collect = append(collect, strconv.Itoa(p))
+				next = append(next, order[p-1])
+			}
+		}
+		for p := 1; p <= len(order); p++ {
+			if slices.Contains(moved, p) {
+				continue
+			}
+			if p == target && before {
+				add(moved...)
+			}
+			add(p)
+			if p == target && !before {
+				add(moved...)
+			}
+		}
+		return func(inFile, outFile string, config *model.Configuration) error {
+			return api.CollectFile(inFile, outFile, collect, config)
+		}, next, nil
+	}
+	return nil, nil, fmt.Errorf("unknown operation, use rotate, move, delete or insert")
+}
+
+// pageSizeOf returns a page configuration with the MediaBox size of a page
+func pageSizeOf(path string, page int, config *model.Configuration) (*pdfcpu.PageConfiguration, error) {
+	ctx, err := readPDF(path, config)
+	if err != nil {
+		return nil, err
+	}
+	_, _, inh, err := ctx.PageDict(page, false)
+	if err != nil {
+		return nil, err
+	}
+	if inh == nil || inh.MediaBox == nil {
+		return nil, nil
+	}
+	return &pdfcpu.PageConfiguration{
+		PageDim: &types.Dim{Width: inh.MediaBox.Width(), Height: inh.MediaBox.Height()},
+		InpUnit: types.POINTS,
+	}, nil
+}
+
+// selectPages returns the current positions of the original pages the
+// operation selects
+func (op pageOperation) selectPages(order []int, pageCount int) ([]int, error) {
+	if op.Pages == "" {
+		return nil, fmt.Errorf("pages are required")
+	}
+	sel, err := utils.ParsePageSelection(op.Pages)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := sel.Pages(pageCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages selected")
+	}
+	positions := make([]int, len(pages))
+	for i, p := range pages {
+		if positions[i], err = position(order, p); err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(positions)
+	return positions, nil
+}
+
+// target returns the current position of the original page given by
+// exactly one of before and after
+func (op pageOperation) target(order []int, pageCount int) (int, bool, error) {
+	if (op.Before == nil) == (op.After == nil) {
+		return 0, false, fmt.Errorf("exactly one of before and after is required")
+	}
+	page, before := 0, op.Before != nil
+	if before {
+		page = *op.Before
+	} else {
+		page = *op.After
+	}
+	if page < 1 || page > pageCount {
+		return 0, false, &utils.PageRangeError{Page: page, PageCount: pageCount}
+	}
+	pos, err := position(order, page)
+	return pos, before, err
+}
+
+// position returns the 1-based position of an original page in order
+func position(order []int, page int) (int, error) {
+	i := slices.Index(order, page)
+	if i < 0 {
+		return 0, fmt.Errorf("page %d was deleted by an earlier operation", page)
+	}
+	return i + 1, nil
+}
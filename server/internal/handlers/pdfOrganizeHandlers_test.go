@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+func TestOrganizeInsertMatchesNeighbour(t *testing.T) {
+	data := imagePDF(t, image.Pt(400, 300), image.Pt(300, 500))
+	dims, err := api.PageDims(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, ops string
+		want      []types.Dim
+	}{
+		{"after", `[{"op":"insert","after":1,"count":2}]`, []types.Dim{dims[0], dims[0], dims[0], dims[1]}},
+		{"before", `[{"op":"insert","before":2}]`, []types.Dim{dims[0], dims[1], dims[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postPDF(t, OrganizePDF, data, map[string]string{"operations": tt.ops})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			got, err := api.PageDims(bytes.NewReader(rec.Body.Bytes()), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d pages, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("page %d is %v, want %v", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
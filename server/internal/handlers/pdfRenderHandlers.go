@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"file-conv/internal/pdfrender"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// Resolution limits of rendered pages, in dots per inch
+const (
+	defaultRenderDPI = 150
+	minRenderDPI     = 18
+	maxRenderDPI     = 600
+)
+
+// PDFToImages renders the pages of a PDF as PNG or JPEG images and returns
+// them as a ZIP. With the "page" field a single page is rendered and the
+// image itself is returned, which suits thumbnails; "width" then sizes it in
+// pixels instead of "dpi".
+func PDFToImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	formatName := r.FormValue("format")
+	if formatName == "" {
+		formatName = "png"
+	}
+	format, err := utils.LookupImageFormat(formatName)
+	if err != nil || (format.Name != "png" && format.Name != "jpeg") {
+		http.Error(w, "Invalid format: must be png or jpg", http.StatusBadRequest)
+		return
+	}
+
+	dpi := float64(defaultRenderDPI)
+	if s := r.FormValue("dpi"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < minRenderDPI || v > maxRenderDPI {
+			http.Error(w, fmt.Sprintf("Invalid dpi: must be between %d and %d", minRenderDPI, maxRenderDPI), http.StatusBadRequest)
+			return
+		}
+		dpi = float64(v)
+	}
+
+	quality := 0
+	if s := r.FormValue("quality"); s != "" {
+		quality, err = strconv.Atoi(s)
+		if err != nil || quality < 1 || quality > 100 {
+			http.Error(w, "Invalid quality: must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	single := 0
+	if s := r.FormValue("page"); s != "" {
+		single, err = strconv.Atoi(s)
+		if err != nil || single < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+	}
+	width := 0
+	if s := r.FormValue("width"); s != "" {
+		width, err = strconv.Atoi(s)
+		if err != nil || width < 1 || width > 10000 {
+			http.Error(w, "Invalid width: must be between 1 and 10000", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfrender-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		http.Error(w, "Error opening saved PDF file", http.StatusInternalServerError)
+		return
+	}
+	defer in.Close()
+
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := api.ReadAndValidate(in, newPDFConfig(r))
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+
+	pages := make([]int, ctx.PageCount)
+	for i := range pages {
+		pages[i] = i + 1
+	}
+	switch expr := r.FormValue("pages"); {
+	case single > 0:
+		if single > ctx.PageCount {
+			http.Error(w, fmt.Sprintf("Invalid page: the document has %d pages", ctx.PageCount), http.StatusBadRequest)
+			return
+		}
+		pages = []int{single}
+	case expr != "":
+		sel, err := utils.ParsePageSelection(expr)
+		if err == nil {
+			pages, err = sel.Pages(ctx.PageCount)
+		}
+		if err != nil {
+			http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	renderer := pdfrender.NewRenderer(ctx.XRefTable)
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	render := func(out io.Writer, p int) error {
+		pageDPI := dpi
+		if width > 0 {
+			pw, _, err := renderer.PageSize(p)
+			if err != nil {
+				return err
+			}
+			pageDPI = min(float64(width)/pw*72, maxRenderDPI)
+		}
+		img, err := renderer.RenderPage(p, pageDPI)
+		if err != nil {
+			return err
+		}
+		return utils.EncodeImage(out, img, format, quality)
+	}
+
+	if single > 0 {
+		progress.Report(r.Context(), progress.StageConverting, 1, 1)
+		var buf bytes.Buffer
+		if err := render(&buf, single); err != nil {
+			http.Error(w, fmt.Sprintf("Error rendering page %d: %v", single, err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", format.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_p%d.%s\"", base, single, format.Extension))
+		if _, err := io.Copy(w, &buf); err != nil {
+			http.Error(w, "Error sending response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Rendered pages go to their own directory so the input is not zipped
+	outDir := filepath.Join(tempDir, "pages")
+	if err := os.Mkdir(outDir, 0o755); err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	digits := len(strconv.Itoa(ctx.PageCount))
+	for i, p := range pages {
+		progress.Report(r.Context(), progress.StageConverting, i+1, len(pages))
+		out, err := os.Create(filepath.Join(outDir, fmt.Sprintf("%s_p%0*d.%s", base, digits, p, format.Extension)))
+		if err != nil {
+			http.Error(w, "Error creating output file", http.StatusInternalServerError)
+			return
+		}
+		err = render(out, p)
+		out.Close()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error rendering page %d: %v", p, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sendZip(w, r, outDir, base+"_images.zip")
+}
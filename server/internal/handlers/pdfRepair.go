@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// violation is a problem found in a PDF, located at an object if Object is
+// set
+type violation struct {
+	Object  int    `json:"object,omitempty"`
+	Message string `json:"message"`
+}
+
+var (
+	objHeaderRe    = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	streamRe       = regexp.MustCompile(`>>\s*stream(\r\n|\n|\r)`)
+	lengthRe       = regexp.MustCompile(`/Length\s+\d+(\s+\d+\s+R)?`)
+	objStmRe       = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	dropTypeRe     = regexp.MustCompile(`/Type\s*/(ObjStm|XRef)\b|/Linearized\b`)
+	catalogRe      = regexp.MustCompile(`/Type\s*/Catalog\b`)
+	flateOnlyRe    = regexp.MustCompile(`/Filter\s*(/FlateDecode|\[\s*/FlateDecode\s*\])`)
+	objStmCountRe  = regexp.MustCompile(`/N\s+(\d+)`)
+	objStmFirstRe  = regexp.MustCompile(`/First\s+(\d+)`)
+	trailerRootRe  = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	trailerInfoRe  = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	trailerCryptRe = regexp.MustCompile(`/Encrypt\s+(\d+)\s+(\d+)\s+R`)
+	trailerIDRe    = regexp.MustCompile(`/ID\s*\[\s*<[0-9A-Fa-f\s]*>\s*<[0-9A-Fa-f\s]*>\s*\]`)
+	sectionRe      = regexp.MustCompile(`(?m)^\s*(xref|trailer|startxref)\b`)
+	versionRe      = regexp.MustCompile(`%PDF-(\d\.\d)`)
+	badObjectRe    = regexp.MustCompile(`(?:object|obj#)\s*(\d+)`)
+	pagesRefRe     = regexp.MustCompile(`/Pages\s+(\d+)\s+\d+\s+R`)
+	kidsRe         = regexp.MustCompile(`/Kids\s*\[([^\]]*)\]`)
+	countRe        = regexp.MustCompile(`/Count\s+-?\d+`)
+	refRe          = regexp.MustCompile(`(\d+)\s+(\d+)\s+R`)
+	pageRe         = regexp.MustCompile(`/Type\s*/Page\b`)
+	mediaBoxRe     = regexp.MustCompile(`/MediaBox\s*\[[^\]]*\]`)
+	contentsRefRe  = regexp.MustCompile(`/Contents\s+(\d+)\s+\d+\s+R`)
+	parentRe       = regexp.MustCompile(`/Parent\s+\d+\s+\d+\s+R`)
+)
+
+// rawObject is an object found by scanning a PDF, with the text between
+// "obj" and "endobj"
+type rawObject struct {
+	gen  int
+	body []byte
+}
+
+// scannedPDF holds the objects of a PDF found without its cross-reference
+// table, which can be written out again with a new one
+type scannedPDF struct {
+	version string
+	objects map[int]rawObject
+	root    int
+	info    int
+	encrypt int
+	id      string
+}
+
+// scanPDF finds the objects of a PDF by their "N G obj" headers. Objects
+// defined more than once keep their last definition, as in an incremental
+// update, and objects in object streams are unpacked. Stream lengths are
+// corrected from the position of "endstream".
+func scanPDF(data []byte) (*scannedPDF, error) {
+	pdf := &scannedPDF{version: "1.7", objects: map[int]rawObject{}}
+	if m := versionRe.FindSubmatch(data[:min(len(data), 1024)]); m != nil {
+		pdf.version = string(m[1])
+	}
+
+	var objStms []int
+	for pos := 0; pos < len(data); {
+		loc := objHeaderRe.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		nr, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		gen, _ := strconv.Atoi(string(data[pos+loc[4] : pos+loc[5]]))
+		start := pos + loc[1]
+		body, end := objectBody(data, start)
+		pos = end
+		if body == nil {
+			continue
+		}
+		if objStmRe.Match(streamDict(body)) {
+			objStms = append(objStms, nr)
+		}
+		pdf.objects[nr] = rawObject{gen: gen, body: body}
+	}
+
+	// Objects outside object streams were written later, so they win
+	for _, nr := range objStms {
+		for cnr, body := range unpackObjectStream(pdf.objects[nr].body) {
+			if _, ok := pdf.objects[cnr]; !ok {
+				pdf.objects[cnr] = rawObject{body: body}
+			}
+		}
+	}
+	for nr, obj := range pdf.objects {
+		if dropTypeRe.Match(streamDict(obj.body)) {
+			delete(pdf.objects, nr)
+		}
+	}
+	if len(pdf.objects) == 0 {
+		return nil, errors.New("no objects found")
+	}
+
+	pdf.root = lastRef(data, trailerRootRe)
+	if _, ok := pdf.objects[pdf.root]; !ok {
+		pdf.root = 0
+		for nr, obj := range pdf.objects {
+			if catalogRe.Match(streamDict(obj.body)) && nr > pdf.root {
+				pdf.root = nr
+			}
+		}
+	}
+	if pdf.root == 0 {
+		// The page tree is added by prunePageTree
+		pdf.root = pdf.nextNr()
+		pdf.objects[pdf.root] = rawObject{body: []byte("<< /Type /Catalog >>")}
+	}
+	if pdf.info = lastRef(data, trailerInfoRe); pdf.objects[pdf.info].body == nil {
+		pdf.info = 0
+	}
+	if pdf.encrypt = lastRef(data, trailerCryptRe); pdf.encrypt != 0 {
+		if ids := trailerIDRe.FindAll(data, -1); ids != nil {
+			pdf.id = string(ids[len(ids)-1])
+		}
+	}
+	return pdf, nil
+}
+
+// objectBody returns the body of the object starting at start and the
+// position after it, or a nil body if the object is cut off
+func objectBody(data []byte, start int) ([]byte, int) {
+	rest := data[start:]
+	limit := len(rest)
+	if loc := objHeaderRe.FindIndex(rest); loc != nil {
+		limit = loc[0]
+	}
+	if i := bytes.Index(rest, []byte("endobj")); i >= 0 && i < limit {
+		limit = i
+	}
+	if loc := sectionRe.FindIndex(rest[:limit]); loc != nil {
+		limit = loc[0]
+	}
+
+	// A stream runs to "endstream", which may lie beyond a header-like
+	// sequence in its data
+	loc := streamRe.FindIndex(rest[:limit])
+	if loc == nil {
+		// Without endobj the object runs up to the next one
+		return bytes.TrimSpace(rest[:limit]), start + limit
+	}
+	dict, dataStart := rest[:loc[0]+2], loc[1]
+	dataEnd := -1
+	if m := lengthRe.Find(dict); m != nil {
+		if n, err := strconv.Atoi(string(bytes.Fields(m)[1])); err == nil && len(bytes.Fields(m)) == 2 &&
+			dataStart+n <= len(rest) && bytes.HasPrefix(bytes.TrimLeft(rest[dataStart+n:], "\r\n"), []byte("endstream")) {
+			dataEnd = dataStart + n
+		}
+	}
+	if dataEnd < 0 {
+		i := bytes.Index(rest[dataStart:], []byte("endstream"))
+		if i < 0 {
+			return nil, start + limit
+		}
+		dataEnd = dataStart + i
+		if bytes.HasSuffix(rest[:dataEnd], []byte("\r\n")) {
+			dataEnd -= 2
+		} else if dataEnd > dataStart && (rest[dataEnd-1] == '\n' || rest[dataEnd-1] == '\r') {
+			dataEnd--
+		}
+	}
+
+	length := []byte("/Length " + strconv.Itoa(dataEnd-dataStart))
+	if lengthRe.Match(dict) {
+		dict = lengthRe.ReplaceAllLiteral(dict, length)
+	} else {
+		dict = append(append([]byte("<<"), length...), bytes.TrimPrefix(bytes.TrimSpace(dict), []byte("<<"))...)
+	}
+	var body bytes.Buffer
+	body.Write(bytes.TrimSpace(dict))
+	body.WriteString("\nstream\n")
+	body.Write(rest[dataStart:dataEnd])
+	body.WriteString("\nendstream")
+
+	end := start + dataEnd + bytes.Index(rest[dataEnd:], []byte("endstream")) + len("endstream")
+	if i := bytes.Index(data[end:], []byte("endobj")); i >= 0 && !objHeaderRe.Match(data[end:end+i]) {
+		end += i + len("endobj")
+	}
+	return body.Bytes(), end
+}
+
+// streamDict returns the dictionary of an object body, which is the whole
+// body unless it is a stream
+func streamDict(body []byte) []byte {
+	if loc := streamRe.FindIndex(body); loc != nil {
+		return body[:loc[0]+2]
+	}
+	return body
+}
+
+// unpackObjectStream returns the objects of an object stream by number.
+// Only unfiltered and Flate-compressed streams without predictors can be
+// read; a stream cut short yields the objects before the cut.
+func unpackObjectStream(body []byte) map[int][]byte {
+	loc := streamRe.FindIndex(body)
+	if loc == nil {
+		return nil
+	}
+	dict := body[:loc[0]+2]
+	content := bytes.TrimSuffix(body[loc[1]:], []byte("\nendstream"))
+	if bytes.Contains(dict, []byte("/DecodeParms")) {
+		return nil
+	}
+	if flateOnlyRe.Match(dict) {
+		zr, err := zlib.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil
+		}
+		content, err = io.ReadAll(zr)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+	} else if bytes.Contains(dict, []byte("/Filter")) {
+		return nil
+	}
+
+	n, first := submatchInt(dict, objStmCountRe), submatchInt(dict, objStmFirstRe)
+	if first <= 0 || first > len(content) {
+		return nil
+	}
+	header := bytes.Fields(content[:first])
+	var nrs, offsets []int
+	for i := 0; i+1 < len(header) && i < 2*n; i += 2 {
+		nr, err1 := strconv.Atoi(string(header[i]))
+		off, err2 := strconv.Atoi(string(header[i+1]))
+		if err1 != nil || err2 != nil || first+off > len(content) {
+			break
+		}
+		nrs = append(nrs, nr)
+		offsets = append(offsets, first+off)
+	}
+	objects := map[int][]byte{}
+	for i, nr := range nrs {
+		end := len(content)
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		if offsets[i] < end {
+			objects[nr] = bytes.TrimSpace(content[offsets[i]:end])
+		}
+	}
+	return objects
+}
+
+func submatchInt(data []byte, re *regexp.Regexp) int {
+	m := re.FindSubmatch(data)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(m[1]))
+	return n
+}
+
+// lastRef returns the object number of the last reference matching re
+func lastRef(data []byte, re *regexp.Regexp) int {
+	refs := re.FindAllSubmatch(data, -1)
+	if refs == nil {
+		return 0
+	}
+	return submatchInt(refs[len(refs)-1][0], re)
+}
+
+// prunePageTree drops pages that are missing, e.g. cut off or dropped,
+// from the page tree and recounts its nodes. Without a usable page tree the
+// pages found are collected in a new one. It returns the page count.
+func (pdf *scannedPDF) prunePageTree() int {
+	root := pdf.objects[pdf.root]
+	if m := pagesRefRe.FindSubmatch(root.body); m != nil {
+		nr, _ := strconv.Atoi(string(m[1]))
+		if n := pdf.prunePages(nr, map[int]bool{}); n > 0 {
+			return n
+		}
+	}
+
+	var pages []int
+	for nr, obj := range pdf.objects {
+		if pageRe.Match(streamDict(obj.body)) && pdf.pageCount(nr) == 1 {
+			pages = append(pages, nr)
+		}
+	}
+	if len(pages) == 0 {
+		return 0
+	}
+	slices.Sort(pages)
+
+	// Pages may have inherited their size from a lost node, so the first
+	// size found in the file is passed on to them, or else A4
+	mediaBox := []byte("/MediaBox [0 0 595 842]")
+	for _, obj := range pdf.objects {
+		if m := mediaBoxRe.Find(streamDict(obj.body)); m != nil {
+			mediaBox = m
+			break
+		}
+	}
+	nr := pdf.nextNr()
+	kids := make([]string, len(pages))
+	for i, page := range pages {
+		kids[i] = fmt.Sprintf("%d %d R", page, pdf.objects[page].gen)
+		pdf.setRef(page, parentRe, "/Parent", nr)
+	}
+	pdf.objects[nr] = rawObject{body: []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d %s >>", strings.Join(kids, " "), len(pages), mediaBox))}
+	pdf.setRef(pdf.root, pagesRefRe, "/Pages", nr)
+	return len(pages)
+}
+
+// prunePages prunes the page tree node nr and returns its page count
+func (pdf *scannedPDF) prunePages(nr int, seen map[int]bool) int {
+	obj, ok := pdf.objects[nr]
+	if !ok || seen[nr] {
+		return 0
+	}
+	seen[nr] = true
+	kids := kidsRe.FindSubmatchIndex(obj.body)
+	if kids == nil {
+		return pdf.pageCount(nr)
+	}
+
+	var refs [][]byte
+	count := 0
+	for _, ref := range refRe.FindAllSubmatch(obj.body[kids[2]:kids[3]], -1) {
+		kid, _ := strconv.Atoi(string(ref[1]))
+		if n := pdf.prunePages(kid, seen); n > 0 {
+			refs = append(refs, ref[0])
+			count += n
+		}
+	}
+	var body []byte
+	body = append(body, obj.body[:kids[2]]...)
+	body = append(body, bytes.Join(refs, []byte(" "))...)
+	body = append(body, obj.body[kids[3]:]...)
+	obj.body = countRe.ReplaceAllLiteral(body, []byte("/Count "+strconv.Itoa(count)))
+	pdf.objects[nr] = obj
+	return count
+}
+
+// pageCount returns 1 for the page nr, or 0 if its content stream is
+// missing
+func (pdf *scannedPDF) pageCount(nr int) int {
+	if m := contentsRefRe.FindSubmatch(pdf.objects[nr].body); m != nil {
+		if content, _ := strconv.Atoi(string(m[1])); pdf.objects[content].body == nil {
+			return 0
+		}
+	}
+	return 1
+}
+
+// setRef points the entry key matched by re in the dictionary of object nr
+// to object target, adding the entry if needed
+func (pdf *scannedPDF) setRef(nr int, re *regexp.Regexp, key string, target int) {
+	obj := pdf.objects[nr]
+	ref := []byte(fmt.Sprintf("%s %d 0 R", key, target))
+	if re.Match(obj.body) {
+		obj.body = re.ReplaceAllLiteral(obj.body, ref)
+	} else if i := bytes.Index(obj.body, []byte("<<")); i >= 0 {
+		obj.body = slices.Concat(obj.body[:i+2], []byte(" "), ref, obj.body[i+2:])
+	}
+	pdf.objects[nr] = obj
+}
+
+// nextNr returns an object number that is neither used nor referenced
+func (pdf *scannedPDF) nextNr() int {
+	nr := 0
+	for n, obj := range pdf.objects {
+		nr = max(nr, n)
+		for _, ref := range refRe.FindAllSubmatch(streamDict(obj.body), -1) {
+			if n, err := strconv.Atoi(string(ref[1])); err == nil {
+				nr = max(nr, n)
+			}
+		}
+	}
+	return nr + 1
+}
+
+// bytes writes the objects out as a PDF with a new cross-reference table
+func (pdf *scannedPDF) bytes() []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", pdf.version)
+
+	nrs := make([]int, 0, len(pdf.objects))
+	for nr := range pdf.objects {
+		nrs = append(nrs, nr)
+	}
+	slices.Sort(nrs)
+	size := nrs[len(nrs)-1] + 1
+	offsets := make([]int, size)
+	for _, nr := range nrs {
+		offsets[nr] = out.Len()
+		obj := pdf.objects[nr]
+		fmt.Fprintf(&out, "%d %d obj\n", nr, obj.gen)
+		out.Write(obj.body)
+		out.WriteString("\nendobj\n")
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n", size)
+	for nr, off := range offsets {
+		switch {
+		case nr == 0:
+			out.WriteString("0000000000 65535 f\r\n")
+		case off == 0:
+			out.WriteString("0000000000 00000 f\r\n")
+		default:
+			fmt.Fprintf(&out, "%010d %05d n\r\n", off, pdf.objects[nr].gen)
+		}
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d %d R", size, pdf.root, pdf.objects[pdf.root].gen)
+	if pdf.info != 0 {
+		fmt.Fprintf(&out, " /Info %d %d R", pdf.info, pdf.objects[pdf.info].gen)
+	}
+	if pdf.encrypt != 0 {
+		fmt.Fprintf(&out, " /Encrypt %d %d R", pdf.encrypt, pdf.objects[pdf.encrypt].gen)
+		if pdf.id != "" {
+			out.WriteString(" " + pdf.id)
+		}
+	}
+	fmt.Fprintf(&out, " >>\nstartxref\n%d\n%%%%EOF\n", xref)
+	return out.Bytes()
+}
+
+// rebuildPDF reads a PDF whose cross-reference table cannot be used by
+// rebuilding it from the objects found in the file. Objects pdfcpu cannot
+// parse are dropped and returned as violations.
+func rebuildPDF(data []byte, config *model.Configuration) (*model.Context, []violation, error) {
+	pdf, err := scanPDF(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var dropped []violation
+	for {
+		if pdf.prunePageTree() == 0 {
+			return nil, dropped, errors.New("no pages found")
+		}
+		ctx, err := readContext(pdf.bytes(), config)
+		if err == nil {
+			return ctx, dropped, nil
+		}
+		if errors.Is(err, pdfcpu.ErrWrongPassword) {
+			return nil, dropped, err
+		}
+
+		// Drop the object pdfcpu failed on and try again
+		m := badObjectRe.FindStringSubmatch(err.Error())
+		if m == nil {
+			return nil, dropped, err
+		}
+		nr, _ := strconv.Atoi(m[1])
+		if _, ok := pdf.objects[nr]; !ok || nr == pdf.root || nr == pdf.encrypt {
+			return nil, dropped, err
+		}
+		delete(pdf.objects, nr)
+		if nr == pdf.info {
+			pdf.info = 0
+		}
+		dropped = append(dropped, violation{Object: nr, Message: "Object cannot be parsed: " + err.Error()})
+	}
+}
+
+// repairPDF reads a PDF for rewriting. A PDF pdfcpu cannot read as it is
+// is rebuilt from its objects and validated in relaxed mode.
+func repairPDF(data []byte, config *model.Configuration) (*model.Context, error) {
+	ctx, err := readContext(data, config)
+	if err == nil {
+		if err = api.ValidateContext(ctx); err == nil {
+			return ctx, api.OptimizeContext(ctx)
+		}
+	}
+	if errors.Is(err, pdfcpu.ErrWrongPassword) {
+		return nil, err
+	}
+
+	config.ValidationMode = model.ValidationRelaxed
+	if ctx, _, err = rebuildPDF(data, config); err != nil {
+		return nil, err
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// readContext reads a PDF with pdfcpu, which panics on some malformed
+// cross-reference streams
+func readContext(data []byte, config *model.Configuration) (ctx *model.Context, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			ctx, err = nil, fmt.Errorf("malformed file: %v", v)
+		}
+	}()
+	return api.ReadContext(bytes.NewReader(data), config)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// validationReport is the response of ValidatePDF
+type validationReport struct {
+	Valid      bool        `json:"valid"`
+	Mode       string      `json:"mode"`
+	Version    string      `json:"version,omitempty"`
+	PageCount  int         `json:"pageCount,omitempty"`
+	Violations []violation `json:"violations"`
+}
+
+// ValidatePDF checks a PDF against the specification and returns a report
+// as JSON. The mode field is relaxed (default), which accepts common
+// deviations, or strict. A damaged cross-reference table and each object
+// that cannot be parsed are reported; validation of the document structure
+// stops at its first violation.
+func ValidatePDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	config := newPDFConfig(r)
+	mode := r.FormValue("mode")
+	switch mode {
+	case "", "relaxed":
+		mode = "relaxed"
+		config.ValidationMode = model.ValidationRelaxed
+	case "strict":
+		config.ValidationMode = model.ValidationStrict
+	default:
+		http.Error(w, "Invalid mode: must be relaxed or strict", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfvalidate-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, _, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		http.Error(w, "Error reading saved PDF file", http.StatusInternalServerError)
+		return
+	}
+
+	report := validationReport{Mode: mode, Violations: []violation{}}
+	progress.Report(r.Context(), progress.StageParsing, 0, 0)
+	ctx, err := readContext(data, config)
+	if errors.Is(err, pdfcpu.ErrWrongPassword) {
+		pdfError(w, "Error reading PDF", err)
+		return
+	}
+	if err != nil {
+		// Look further into the objects the way RepairPDF would
+		report.Violations = append(report.Violations, violation{Message: "Cross-reference table is damaged: " + err.Error()})
+		var dropped []violation
+		ctx, dropped, err = rebuildPDF(data, config)
+		report.Violations = append(report.Violations, dropped...)
+		if err != nil {
+			report.Violations = append(report.Violations, violation{Message: "File cannot be rebuilt: " + err.Error()})
+		}
+	}
+
+	if ctx != nil {
+		progress.Report(r.Context(), progress.StageConverting, 0, 0)
+		report.Version = ctx.XRefTable.Version().String()
+		if err := api.ValidateContext(ctx); err != nil {
+			report.Violations = append(report.Violations, violation{Object: ctx.CurObj, Message: err.Error()})
+		} else {
+			report.PageCount = ctx.PageCount
+		}
+	}
+	report.Valid = len(report.Violations) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// RepairPDF rewrites a PDF with a new cross-reference table. A PDF pdfcpu
+// cannot read as it is is rebuilt from the objects found in the file,
+// dropping those that cannot be parsed.
+func RepairPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfrepair-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageConverting, 0, 0)
+	outputPath := filepath.Join(tempDir, "repaired_"+filename)
+	if err := repairFile(inputPath, outputPath, newPDFConfig(r)); err != nil {
+		if errors.Is(err, pdfcpu.ErrWrongPassword) {
+			pdfError(w, "Error reading PDF", err)
+			return
+		}
+		http.Error(w, "Cannot repair PDF: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
+
+	sendFile(w, outputPath, "application/pdf", "repaired_"+filename)
+}
+
+// repairFile writes the repaired PDF at inPath to outPath, which may be
+// the same path
+func repairFile(inPath, outPath string, config *model.Configuration) error {
+	data, err := os.ReadFile(inPath)
+	if err != nil {
+		return err
+	}
+	ctx, err := repairPDF(data, config)
+	if err != nil {
+		return err
+	}
+	return api.WriteContextFile(ctx, outPath)
+}
+
+// parseRepair reads the opt-in "repair" field of the merge, split and
+// compress endpoints
+func parseRepair(r *http.Request) (bool, error) {
+	v := r.FormValue("repair")
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// repairInputs repairs the PDFs at paths that pdfcpu cannot read in place,
+// so that an operation can go on with them
+func repairInputs(paths []string, config *model.Configuration) error {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		ctx, err := readContext(data, config)
+		if err == nil {
+			err = api.ValidateContext(ctx)
+		}
+		if err == nil || errors.Is(err, pdfcpu.ErrWrongPassword) {
+			continue
+		}
+		if ctx, err = repairPDF(data, config); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		if err := api.WriteContextFile(ctx, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"file-conv/internal/textpdf"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// testPDF lays out a PDF with one line of text on each of its pages
+func testPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+	var src []string
+	for i := 1; i <= pages; i++ {
+		src = append(src, fmt.Sprintf("Page %d", i))
+	}
+	opts, err := textpdf.ParseOptions(func(string) string { return "" }, "mono")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := textpdf.TextToPDF(context.Background(), &buf, strings.Join(src, "\f"), opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScanPDF(t *testing.T) {
+	data := testPDF(t, 3)
+	pdf, err := scanPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdf.root == 0 || !catalogRe.Match(pdf.objects[pdf.root].body) {
+		t.Errorf("root %d is not the catalog", pdf.root)
+	}
+	if got := pdf.prunePageTree(); got != 3 {
+		t.Errorf("prunePageTree = %d pages, want 3", got)
+	}
+	if nr := pdf.nextNr(); pdf.objects[nr].body != nil {
+		t.Errorf("nextNr = %d, which is in use", nr)
+	}
+
+	if _, err := scanPDF([]byte("%PDF-1.7\nnothing here\n%%EOF\n")); err == nil {
+		t.Error("scanPDF succeeded on a file without objects")
+	}
+}
+
+func TestRepairPDF(t *testing.T) {
+	const pages = 4
+	data := testPDF(t, pages)
+	tests := []struct {
+		name    string
+		corrupt func(d []byte) []byte
+	}{
+		{"intact", func(d []byte) []byte {
+			return d
+		}},
+		{"wrong startxref", func(d []byte) []byte {
+			i := bytes.LastIndex(d, []byte("startxref"))
+			return append(d[:i:i], "startxref\n99\n%%EOF\n"...)
+		}},
+		{"shifted offsets", func(d []byte) []byte {
+			return append(append(d[:9:9], bytes.Repeat([]byte("%junk\n"), 20)...), d[9:]...)
+		}},
+		{"missing xref", func(d []byte) []byte {
+			i := bytes.LastIndex(d, []byte("\nxref"))
+			return d[: i+1 : i+1]
+		}},
+		{"wrong stream length", func(d []byte) []byte {
+			return regexp.MustCompile(`/Length \d+`).ReplaceAll(d, []byte("/Length 9"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupted := tt.corrupt(bytes.Clone(data))
+			ctx, err := repairPDF(corrupted, model.NewDefaultConfiguration())
+			if err != nil {
+				t.Fatalf("repairPDF: %v", err)
+			}
+			if ctx.PageCount != pages {
+				t.Errorf("PageCount = %d, want %d", ctx.PageCount, pages)
+			}
+
+			// pdfcpu reads some of these itself, so rebuild them explicitly
+			config := model.NewDefaultConfiguration()
+			config.ValidationMode = model.ValidationRelaxed
+			ctx, dropped, err := rebuildPDF(corrupted, config)
+			if err != nil {
+				t.Fatalf("rebuildPDF: %v", err)
+			}
+			if err := api.ValidateContext(ctx); err != nil {
+				t.Fatalf("ValidateContext: %v", err)
+			}
+			if ctx.PageCount != pages || len(dropped) != 0 {
+				t.Errorf("rebuilt %d pages, dropping %v, want %d pages", ctx.PageCount, dropped, pages)
+			}
+		})
+	}
+}
+
+func TestRebuildPDFWithoutPages(t *testing.T) {
+	data := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n")
+	if _, _, err := rebuildPDF(data, model.NewDefaultConfiguration()); err == nil || err.Error() != "no pages found" {
+		t.Errorf("rebuildPDF error = %v, want no pages found", err)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"file-conv/internal/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Permission flags accepted by EncryptPDF and the bits each one clears
+var permissionFlags = map[string]model.PermissionFlags{
+	"no-print":    model.PermissionPrintRev2 | model.PermissionPrintRev3,
+	"no-copy":     model.PermissionExtract | model.PermissionExtractRev3,
+	"no-modify":   model.PermissionModify,
+	"no-annotate": model.PermissionModAnnFillForm,
+	"no-fill":     model.PermissionFillRev3,
+	"no-assemble": model.PermissionAssembleRev3,
+}
+
+func EncryptPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	// The owner password defaults to the user password
+	userPW := r.FormValue("userPassword")
+	ownerPW := r.FormValue("ownerPassword")
+	if ownerPW == "" {
+		ownerPW = userPW
+	}
+	if ownerPW == "" {
+		http.Error(w, "A user or owner password is required", http.StatusBadRequest)
+		return
+	}
+
+	keyLength := 256
+	switch strings.ToLower(r.FormValue("algorithm")) {
+	case "", "aes-256":
+	case "aes-128":
+		keyLength = 128
+	default:
+		http.Error(w, "Invalid algorithm, use aes-128 or aes-256", http.StatusBadRequest)
+		return
+	}
+
+	permissions := model.PermissionsAll
+	if flags := r.FormValue("permissions"); flags != "" {
+		for _, flag := range strings.Split(flags, ",") {
+			bits, ok := permissionFlags[strings.ToLower(strings.TrimSpace(flag))]
+			if !ok {
+				http.Error(w, "Invalid permission flag: "+flag, http.StatusBadRequest)
+				return
+			}
+			permissions &^= bits
+		}
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfencrypt-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The input itself may already be protected with "password"
+	config := newPDFConfig(r)
+	outputPath := filepath.Join(tempDir, "encrypted_"+filename)
+	if pw := r.FormValue("password"); pw != "" {
+		decryptedPath := filepath.Join(tempDir, "decrypted_"+filename)
+		if err := api.DecryptFile(inputPath, decryptedPath, config); err != nil {
+			pdfError(w, "Error decrypting PDF", err)
+			return
+		}
+		inputPath = decryptedPath
+		config = model.NewDefaultConfiguration()
+	}
+
+	config.UserPW = userPW
+	config.OwnerPW = ownerPW
+	config.EncryptUsingAES = true
+	config.EncryptKeyLength = keyLength
+	config.Permissions = permissions
+	if err := api.EncryptFile(inputPath, outputPath, config); err != nil {
+		pdfError(w, "Error encrypting PDF", err)
+		return
+	}
+
+	sendFile(w, outputPath, "application/pdf", "encrypted_"+filename)
+}
+
+func DecryptPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("password") == "" {
+		http.Error(w, "A password is required", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfdecrypt-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, "decrypted_"+filename)
+	if err := api.DecryptFile(inputPath, outputPath, newPDFConfig(r)); err != nil {
+		pdfError(w, "Error decrypting PDF", err)
+		return
+	}
+
+	sendFile(w, outputPath, "application/pdf", "decrypted_"+filename)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"file-conv/internal/pdfrender"
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// splitInputError is a split that cannot be done for the given input, as
+// opposed to a failure to process it
+type splitInputError struct{ msg string }
+
+func (e *splitInputError) Error() string { return e.msg }
+
+// extractPages writes the given pages of a document as a new PDF to w
+func extractPages(ctx *model.Context, pages []int, w io.Writer) error {
+	part, err := pdfcpu.ExtractPages(ctx, pages, false)
+	if err != nil {
+		return err
+	}
+	return api.WriteContext(part, w)
+}
+
+// writeParts writes each group of pages to its own file in outDir
+func writeParts(c context.Context, pdf *model.Context, groups []utils.PageGroup, outDir, base string) error {
+	for i, group := range groups {
+		progress.Report(c, progress.StagePage, i+1, len(groups))
+		name := fmt.Sprintf("%s_%02d_%s.pdf", base, i+1, utils.SafeFilename(group.Label))
+		var buf bytes.Buffer
+		if err := extractPages(pdf, group.Pages, &buf); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(outDir, name), buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageRange returns the pages from first to last
+func pageRange(first, last int) []int {
+	pages := make([]int, 0, last-first+1)
+	for p := first; p <= last; p++ {
+		pages = append(pages, p)
+	}
+	return pages
+}
+
+// rangeLabel names a part by its pages, e.g. "p3-7"
+func rangeLabel(pages []int) string {
+	if len(pages) == 1 {
+		return fmt.Sprintf("p%d", pages[0])
+	}
+	return fmt.Sprintf("p%d-%d", pages[0], pages[len(pages)-1])
+}
+
+// bookmarkGroups splits a document at its top-level bookmarks, each part
+// labelled with the bookmark title. Pages before the first bookmark go
+// with the first part.
+func bookmarkGroups(pdf *model.Context) ([]utils.PageGroup, error) {
+	bms, err := pdfcpu.Bookmarks(pdf)
+	if err != nil {
+		return nil, err
+	}
+	var starts []pdfcpu.Bookmark
+	for _, bm := range bms {
+		if bm.PageFrom >= 1 && bm.PageFrom <= pdf.PageCount {
+			starts = append(starts, bm)
+		}
+	}
+	if len(starts) == 0 {
+		return nil, &splitInputError{"the PDF has no bookmarks to split at"}
+	}
+	sort.SliceStable(starts, func(i, j int) bool { return starts[i].PageFrom < starts[j].PageFrom })
+
+	var groups []utils.PageGroup
+	for i, bm := range starts {
+		first, last := bm.PageFrom, pdf.PageCount
+		if i == 0 {
+			first = 1
+		}
+		if i+1 < len(starts) {
+			last = starts[i+1].PageFrom - 1
+		}
+		// Of several bookmarks on one page, the last one starts the part
+		if last < first {
+			continue
+		}
+		groups = append(groups, utils.PageGroup{Label: bm.Title, Pages: pageRange(first, last)})
+	}
+	return groups, nil
+}
+
+// sizeGroups splits a document into runs of pages whose PDFs stay within
+// maxBytes. Each run is made as long as possible by doubling it and then
+// bisecting, since shared resources make sizes hard to predict.
+func sizeGroups(c context.Context, pdf *model.Context, maxBytes int64) ([]utils.PageGroup, error) {
+	fits := func(first, last int) (bool, error) {
+		var n countingWriter
+		if err := extractPages(pdf, pageRange(first, last), &n); err != nil {
+			return false, err
+		}
+		return int64(n) <= maxBytes, nil
+	}
+
+	var groups []utils.PageGroup
+	for first := 1; first <= pdf.PageCount; {
+		progress.Report(c, progress.StageConverting, first, pdf.PageCount)
+		ok, err := fits(first, first)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &splitInputError{fmt.Sprintf("page %d alone is larger than the size limit", first)}
+		}
+
+		// good fits, bad does not or is past the end
+		good, bad := first, pdf.PageCount+1
+		for step := 1; good+step <= pdf.PageCount; step *= 2 {
+			if ok, err = fits(first, good+step); err != nil {
+				return nil, err
+			}
+			if !ok {
+				bad = good + step
+				break
+			}
+			good += step
+		}
+		for bad-good > 1 {
+			mid := (good + bad) / 2
+			if ok, err = fits(first, mid); err != nil {
+				return nil, err
+			}
+			if ok {
+				good = mid
+			} else {
+				bad = mid
+			}
+		}
+
+		pages := pageRange(first, good)
+		groups = append(groups, utils.PageGroup{Label: rangeLabel(pages), Pages: pages})
+		first = good + 1
+	}
+	return groups, nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// Blank pages are detected on a low resolution rendering, which also
+// evens out scanner noise. A page is blank when fewer than blankMaxInk of
+// its pixels are darker than blankLevel.
+const (
+	blankDPI    = 36
+	blankLevel  = 0xd0
+	blankMaxInk = 0.0005
+)
+
+// blankGroups splits a document at blank pages, which are left out
+func blankGroups(c context.Context, pdf *model.Context) ([]utils.PageGroup, error) {
+	renderer := pdfrender.NewRenderer(pdf.XRefTable)
+	var groups []utils.PageGroup
+	var pages []int
+	flush := func() {
+		if len(pages) > 0 {
+			groups = append(groups, utils.PageGroup{Label: rangeLabel(pages), Pages: pages})
+			pages = nil
+		}
+	}
+	for p := 1; p <= pdf.PageCount; p++ {
+		progress.Report(c, progress.StageConverting, p, pdf.PageCount)
+		img, err := renderer.RenderPage(p, blankDPI)
+		if err != nil {
+			return nil, err
+		}
+		ink := 0
+		for i := 0; i < len(img.Pix); i += 4 {
+			if min(img.Pix[i], img.Pix[i+1], img.Pix[i+2]) < blankLevel {
+				ink++
+			}
+		}
+		if float64(ink) < blankMaxInk*float64(len(img.Pix)/4) {
+			flush()
+			continue
+		}
+		pages = append(pages, p)
+	}
+	flush()
+	if len(groups) == 0 {
+		return nil, &splitInputError{"every page of the PDF is blank"}
+	}
+	return groups, nil
+}
+
+// isSplitInputError reports whether err is the input's fault
+func isSplitInputError(err error) bool {
+	var e *splitInputError
+	return errors.As(err, &e)
+}
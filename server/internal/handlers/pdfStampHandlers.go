@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/color"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// WatermarkPDF stamps text or an image onto the selected pages of a PDF
+func WatermarkPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	// "top" stamps over the page content, "behind" paints underneath it
+	var onTop bool
+	switch r.FormValue("layer") {
+	case "", "top":
+		onTop = true
+	case "behind":
+		onTop = false
+	default:
+		http.Error(w, "Invalid layer, use top or behind", http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfwatermark-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The watermark is either the "text" field or an uploaded "image"
+	var wm *model.Watermark
+	text := r.FormValue("text")
+	image, _, imageErr := r.FormFile("image")
+	switch {
+	case imageErr == nil:
+		defer image.Close()
+		wm, err = api.ImageWatermarkForReader(image, "", onTop, false, types.POINTS)
+	case text != "":
+		wm, err = api.TextWatermark(text, "", onTop, false, types.POINTS)
+	default:
+		http.Error(w, "Either text or an image is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid watermark: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := applyStampStyle(wm, r.FormValue); err != nil {
+		http.Error(w, "Invalid watermark: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config := newPDFConfig(r)
+	var pages []string
+	if expr := r.FormValue("pages"); expr != "" {
+		selected, err := selectPages(inputPath, expr, config)
+		if err != nil {
+			selectPagesError(w, err)
+			return
+		}
+		pages = utils.PageGroup{Pages: selected}.PageStrings()
+	}
+
+	progress.Report(r.Context(), progress.StageConverting, 0, 0)
+	outputPath := filepath.Join(tempDir, "watermarked_"+filename)
+	if err := api.AddWatermarksFile(inputPath, outputPath, pages, wm, config); err != nil {
+		pdfError(w, "Error watermarking PDF", err)
+		return
+	}
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
+
+	sendFile(w, outputPath, "application/pdf", "watermarked_"+filename)
+}
+
+// applyStampStyle sets the appearance of a watermark from the form fields
+// font, size, color, opacity, rotation, position and scale. Unset fields
+// keep pdfcpu's defaults, which paint the stamp along the page diagonal.
+func applyStampStyle(wm *model.Watermark, value func(string) string) error {
+	if name := value("font"); name != "" {
+		if !font.SupportedFont(name) {
+			names := font.CoreFontNames()
+			slices.Sort(names)
+			return fmt.Errorf("unsupported font %q, use one of: %s", name, strings.Join(names, ", "))
+		}
+		wm.FontName = name
+	}
+
+	if s := value("size"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < 1 {
+			return fmt.Errorf("invalid font size %q", s)
+		}
+		// An explicit font size is only honoured with absolute scaling
+		wm.FontSize = size
+		wm.Scale = 1
+		wm.ScaleAbs = true
+	}
+
+	if s := value("scale"); s != "" {
+		scale, err := strconv.ParseFloat(s, 64)
+		if err != nil || scale <= 0 || scale > 1 {
+			return fmt.Errorf("invalid scale %q, use a fraction of the page width between 0 and 1", s)
+		}
+		wm.Scale = scale
+		wm.ScaleAbs = false
+	}
+
+	if s := value("color"); s != "" {
+		c, err := color.ParseColor(s)
+		if err != nil {
+			return fmt.Errorf("invalid color %q, use #RRGGBB", s)
+		}
+		wm.FillColor = c
+		wm.StrokeColor = c
+	}
+
+	if s := value("opacity"); s != "" {
+		opacity, err := strconv.ParseFloat(s, 64)
+		if err != nil || opacity < 0 || opacity > 1 {
+			return fmt.Errorf("invalid opacity %q, use a value between 0 and 1", s)
+		}
+		wm.Opacity = opacity
+	}
+
+	if s := value("rotation"); s != "" {
+		rotation, err := strconv.ParseFloat(s, 64)
+		if err != nil || rotation < -180 || rotation > 180 {
+			return fmt.Errorf("invalid rotation %q, use degrees between -180 and 180", s)
+		}
+		wm.Rotation = rotation
+		wm.Diagonal = model.NoDiagonal
+		wm.UserRotOrDiagonal = true
+	}
+
+	if s := value("position"); s != "" {
+		pos, err := types.ParsePositionAnchor(s)
+		if err != nil || pos == types.Full {
+			return fmt.Errorf("invalid position %q, use tl, tc, tr, l, c, r, bl, bc or br", s)
+		}
+		wm.Pos = pos
+	}
+
+	return nil
+}
+
+// NumberPDF stamps page numbers, Bates numbers or similar footers onto the
+// selected pages of a PDF
+func NumberPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	numbering, err := parsePageNumbering(r.FormValue)
+	if err != nil {
+		http.Error(w, "Invalid numbering: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "pdfnumber-")
+	if err != nil {
+		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath, filename, err := utils.SaveUploadedFile(r, "pdf", tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config := newPDFConfig(r)
+	pageCount, err := countPages(inputPath, config)
+	if err != nil {
+		inputError(w, "Error reading PDF", err)
+		return
+	}
+	expr := r.FormValue("pages")
+	if expr == "" {
+		expr = "all"
+	}
+	sel, err := utils.ParsePageSelection(expr)
+	if err != nil {
+		http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	pages, err := sel.Pages(pageCount)
+	if err != nil {
+		http.Error(w, "Invalid page ranges: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	progress.Report(r.Context(), progress.StageConverting, 0, 0)
+	outputPath := filepath.Join(tempDir, "numbered_"+filename)
+	if err := numbering.apply(inputPath, outputPath, pages, pageCount, config); err != nil {
+		pdfError(w, "Error numbering PDF", err)
+		return
+	}
+	progress.Report(r.Context(), progress.StageEncoding, 0, 0)
+
+	sendFile(w, outputPath, "application/pdf", "numbered_"+filename)
+}
+
+// pageNumbering stamps a numbering template onto pages. Besides the template
+// fields it takes the stamp style fields of applyStampStyle, but defaults to
+// 10pt upright text at the bottom centre of the page.
+type pageNumbering struct {
+	template utils.NumberTemplate
+	prefix   string
+	start    int
+	margin   float64 // distance from the page edge in points
+	style    func(string) string
+}
+
+func parsePageNumbering(value func(string) string) (*pageNumbering, error) {
+	tmpl := value("template")
+	if tmpl == "" {
+		tmpl = "Page {page} of {pages}"
+	}
+	template, err := utils.ParseNumberTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	pn := &pageNumbering{template: template, prefix: value("prefix"), start: 1, margin: 10, style: value}
+
+	if s := value("start"); s != "" {
+		if pn.start, err = strconv.Atoi(s); err != nil || pn.start < 0 {
+			return nil, fmt.Errorf("invalid start number %q", s)
+		}
+	}
+	if s := value("margin"); s != "" {
+		if pn.margin, err = strconv.ParseFloat(s, 64); err != nil || pn.margin < 0 || pn.margin > 100 {
+			return nil, fmt.Errorf("invalid margin %q", s)
+		}
+	}
+	// The margin is given in millimetres like the page layout options
+	pn.margin = pn.margin * 72 / 25.4
+
+	// Catch style errors before any page is processed
+	if _, err := pn.stamp("0"); err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
+
+// stamp returns the watermark for one page
+func (pn *pageNumbering) stamp(text string) (*model.Watermark, error) {
+	wm, err := api.TextWatermark(text, "", true, false, types.POINTS)
+	if err != nil {
+		return nil, err
+	}
+	wm.FontSize = 10
+	wm.Scale = 1
+	wm.ScaleAbs = true
+	wm.Rotation = 0
+	wm.Diagonal = model.NoDiagonal
+	wm.UserRotOrDiagonal = true
+	wm.Pos = types.BottomCenter
+	if err := applyStampStyle(wm, pn.style); err != nil {
+		return nil, err
+	}
+
+	// Keep the stamp clear of the page edges it is anchored to
+	switch wm.Pos {
+	case types.TopLeft, types.Left, types.BottomLeft:
+		wm.Dx = pn.margin
+	case types.TopRight, types.Right, types.BottomRight:
+		wm.Dx = -pn.margin
+	}
+	switch wm.Pos {
+	case types.TopLeft, types.TopCenter, types.TopRight:
+		wm.Dy = -pn.margin
+	case types.BottomLeft, types.BottomCenter, types.BottomRight:
+		wm.Dy = pn.margin
+	}
+	return wm, nil
+}
+
+// apply numbers the given pages of the PDF at inputPath in order
+func (pn *pageNumbering) apply(inputPath, outputPath string, pages []int, pageCount int, config *model.Configuration) error {
+	stamps := make(map[int]*model.Watermark, len(pages))
+	for i, page := range pages {
+		text := pn.template.Format(utils.NumberValues{
+			N:      pn.start + i,
+			Total:  pn.start + len(pages) - 1,
+			Page:   page,
+			Pages:  pageCount,
+			Prefix: pn.prefix,
+		})
+		wm, err := pn.stamp(text)
+		if err != nil {
+			return err
+		}
+		stamps[page] = wm
+	}
+	return api.AddWatermarksMapFile(inputPath, outputPath, stamps, config)
+}
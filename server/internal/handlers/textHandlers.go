@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"file-conv/internal/textpdf"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// TextToPDF lays out plain text as a PDF. The text is uploaded as "file"
+// or sent in the "text" field; pageSize, orientation, margin, font (mono
+// by default, or sans) and fontSize control the layout.
+func TextToPDF(w http.ResponseWriter, r *http.Request) {
+	convertText(w, r, "mono", func(ctx context.Context, out io.Writer, src string, _ map[string][]byte, opts textpdf.Options) error {
+		return textpdf.TextToPDF(ctx, out, src, opts)
+	})
+}
+
+// MarkdownToPDF lays out a Markdown document as a PDF, with the same
+// options as TextToPDF but sans type by default. Images the document
+// refers to are uploaded alongside it as "images" and matched by file name.
+func MarkdownToPDF(w http.ResponseWriter, r *http.Request) {
+	convertText(w, r, "sans", textpdf.MarkdownToPDF)
+}
+
+func convertText(w http.ResponseWriter, r *http.Request, defaultFont string,
+	convert func(context.Context, io.Writer, string, map[string][]byte, textpdf.Options) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse multipart form with 50MB limit
+	if err := r.ParseMultipartForm(50 << 20); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := textpdf.ParseOptions(r.FormValue, defaultFont)
+	if err != nil {
+		http.Error(w, "Invalid layout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var data []byte
+	name := "document"
+	if file, header, err := r.FormFile("file"); err == nil {
+		data, err = io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, "Failed to read uploaded file", http.StatusBadRequest)
+			return
+		}
+		name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	} else if text := r.FormValue("text"); text != "" {
+		data = []byte(text)
+	} else {
+		http.Error(w, "Failed to get uploaded file", http.StatusBadRequest)
+		return
+	}
+	opts.Title = name
+
+	images := map[string][]byte{}
+	for _, fileHeader := range r.MultipartForm.File["images"] {
+		file, err := fileHeader.Open()
+		if err != nil {
+			http.Error(w, "Failed to get uploaded file", http.StatusBadRequest)
+			return
+		}
+		img, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, "Failed to read uploaded file", http.StatusBadRequest)
+			return
+		}
+		images[filepath.Base(fileHeader.Filename)] = img
+	}
+
+	var pdfBuf bytes.Buffer
+	if err := convert(r.Context(), &pdfBuf, decodeText(data), images, opts); err != nil {
+		generateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pdf\"", name))
+	_, _ = io.Copy(w, &pdfBuf)
+}
+
+// decodeText returns uploaded text as a string. UTF-8 is expected; text
+// that is not valid UTF-8 is taken to be Windows-1252.
+func decodeText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	var b strings.Builder
+	for _, c := range data {
+		b.WriteRune(charmap.Windows1252.DecodeByte(c))
+	}
+	return b.String()
+}
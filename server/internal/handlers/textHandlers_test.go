@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMarkdownToPDFImages(t *testing.T) {
+	tests := []struct {
+		name   string
+		images map[string][]byte
+		want   int
+	}{
+		{"missing image", nil, http.StatusBadRequest},
+		{"undecodable image", map[string][]byte{"logo.png": []byte("not an image")}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			mw.WriteField("text", "# Title\n\n![logo](logo.png)\n")
+			for name, data := range tt.images {
+				part, err := mw.CreateFormFile("images", name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				part.Write(data)
+			}
+			mw.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			MarkdownToPDF(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"file-conv/internal/progress"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Upload limit for a job body, which is spooled to disk rather than memory
+const maxBodySize = 200 << 20
+
+// Headers of a recorded response that are passed on with the job result
+var resultHeaders = []string{"Content-Type", "Content-Disposition", "X-Original-Size", "X-Compressed-Size"}
+
+// CreateJob stores the request and queues it. The target endpoint is given
+// by the "target" query parameter, e.g. POST /jobs?target=/merge-pdfs; the
+// remaining query parameters and the body are passed through unchanged.
+func (m *Manager) CreateJob(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	target := query.Get("target")
+	query.Del("target")
+
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "/jobs") {
+		http.Error(w, "Invalid job target", http.StatusBadRequest)
+		return
+	}
+	probe := &http.Request{Method: http.MethodPost, URL: &url.URL{Path: target}, Host: r.Host}
+	if _, pattern := m.router.Handler(probe); pattern == "" {
+		http.Error(w, "Unknown job target", http.StatusBadRequest)
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		http.Error(w, "Error creating job", http.StatusInternalServerError)
+		return
+	}
+
+	// Store the body so it outlives the request
+	bodyPath := filepath.Join(m.dir, id+".body")
+	body, err := os.Create(bodyPath)
+	if err != nil {
+		http.Error(w, "Error saving job input", http.StatusInternalServerError)
+		return
+	}
+	_, err = io.Copy(body, http.MaxBytesReader(w, r.Body, maxBodySize))
+	body.Close()
+	if err != nil {
+		os.Remove(bodyPath)
+		http.Error(w, "Error reading job input", http.StatusBadRequest)
+		return
+	}
+
+	job := &Job{
+		ID:          id,
+		Target:      target,
+		Status:      StatusQueued,
+		CreatedAt:   time.Now(),
+		query:       query.Encode(),
+		contentType: r.Header.Get("Content-Type"),
+		bodyPath:    bodyPath,
+		resultPath:  filepath.Join(m.dir, id+".result"),
+	}
+	if err := m.enqueue(job); err != nil {
+		http.Error(w, "Job queue is full, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	snapshot, _ := m.Get(id)
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// JobStatus reports the state of a job
+func (m *Manager) JobStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := m.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// JobResult sends the output of a finished job
+func (m *Manager) JobResult(w http.ResponseWriter, r *http.Request) {
+	job, ok := m.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	switch job.Status {
+	case StatusFailed:
+		http.Error(w, "Job failed: "+job.Error, http.StatusConflict)
+		return
+	case StatusQueued, StatusRunning:
+		http.Error(w, "Job is not finished", http.StatusConflict)
+		return
+	}
+
+	result, err := os.Open(job.resultPath)
+	if err != nil {
+		http.Error(w, "Job result has expired", http.StatusGone)
+		return
+	}
+	defer result.Close()
+
+	for _, name := range resultHeaders {
+		if v := job.header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+	if _, err := io.Copy(w, result); err != nil {
+		http.Error(w, "Error sending response", http.StatusInternalServerError)
+	}
+}
+
+// JobEvents streams the progress of a job as Server-Sent Events. Past events
+// are replayed first, and the stream ends after the final done or error event.
+func (m *Manager) JobEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := m.Get(id); !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	for {
+		events, changed, ok := m.eventsSince(id, sent)
+		if !ok {
+			return
+		}
+		final := false
+		for _, e := range events {
+			name := "progress"
+			if e.Stage == progress.StageDone || e.Stage == progress.StageError {
+				name = e.Stage
+				final = true
+			}
+			data, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data); err != nil {
+				return
+			}
+		}
+		sent += len(events)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if final {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// replay runs the stored request against the router. It returns the
+// recorded headers, or the error text of a response with a failure status.
+func (m *Manager) replay(ctx context.Context, job *Job) (header http.Header, errText string, err error) {
+	body, err := os.Open(job.bodyPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error opening job input: %v", err)
+	}
+	defer body.Close()
+
+	target := job.Target
+	if job.query != "" {
+		target += "?" + job.query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", job.contentType)
+
+	result, err := os.Create(job.resultPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating job result: %v", err)
+	}
+	defer result.Close()
+
+	// A panicking handler fails its job instead of taking the worker, and
+	// with it the server, down
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Caught panic in job %s: %v, Stack trace: %s", job.ID, p, debug.Stack())
+			os.Remove(job.resultPath)
+			header, errText, err = nil, "", fmt.Errorf("internal error: %v", p)
+		}
+	}()
+
+	rec := &recorder{header: http.Header{}, body: result, status: http.StatusOK}
+	m.router.ServeHTTP(rec, req)
+
+	if rec.status >= http.StatusBadRequest {
+		result.Close()
+		msg, _ := os.ReadFile(job.resultPath)
+		os.Remove(job.resultPath)
+		return nil, strings.TrimSpace(string(msg)), nil
+	}
+	return rec.header, "", nil
+}
+
+// recorder is a ResponseWriter that streams the body to the result file
+type recorder struct {
+	header      http.Header
+	body        io.Writer
+	status      int
+	wroteHeader bool
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = code
+	rec.wroteHeader = true
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(p)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
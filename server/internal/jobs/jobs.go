@@ -0,0 +1,230 @@
+// Package jobs runs conversions asynchronously. A job is an ordinary request
+// to one of the POST endpoints; its body is stored on disk, replayed against
+// the router by a bounded worker pool and the response kept until it expires.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"file-conv/internal/progress"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+var errQueueFull = errors.New("job queue is full")
+
+// Job is the public view of a submitted conversion
+type Job struct {
+	ID         string     `json:"id"`
+	Target     string     `json:"target"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+
+	// Request to replay
+	query       string
+	contentType string
+	bodyPath    string
+
+	// Recorded response of a finished job
+	resultPath string
+	header     http.Header
+
+	// Progress history; changed is closed and replaced on every new event
+	events  []progress.Event
+	changed chan struct{}
+}
+
+// Manager owns the job table, the queue and the workers
+type Manager struct {
+	router *http.ServeMux
+	dir    string
+	ttl    time.Duration
+	queue  chan *Job
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewManager starts workers goroutines that replay jobs against router.
+// At most queueSize jobs wait for a worker, and finished jobs are removed
+// ttl after they complete.
+func NewManager(router *http.ServeMux, workers, queueSize int, ttl time.Duration) (*Manager, error) {
+	dir, err := os.MkdirTemp("", "jobs-")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		router: router,
+		dir:    dir,
+		ttl:    ttl,
+		queue:  make(chan *Job, queueSize),
+		jobs:   make(map[string]*Job),
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	go m.janitor()
+	return m, nil
+}
+
+// Get returns a snapshot of the job with the given ID
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (m *Manager) enqueue(job *Job) error {
+	m.mu.Lock()
+	job.changed = make(chan struct{})
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+	m.publish(job, progress.Event{Stage: progress.StageUploaded})
+
+	select {
+	case m.queue <- job:
+		return nil
+	default:
+		m.remove(job.ID)
+		return errQueueFull
+	}
+}
+
+func (m *Manager) worker() {
+	for job := range m.queue {
+		m.run(job)
+	}
+}
+
+func (m *Manager) run(job *Job) {
+	m.update(job, func() {
+		now := time.Now()
+		job.Status = StatusRunning
+		job.StartedAt = &now
+	})
+
+	ctx := progress.WithReporter(context.Background(), func(e progress.Event) {
+		m.publish(job, e)
+	})
+	header, errText, err := m.replay(ctx, job)
+	os.Remove(job.bodyPath)
+
+	m.update(job, func() {
+		now := time.Now()
+		expires := now.Add(m.ttl)
+		job.FinishedAt = &now
+		job.ExpiresAt = &expires
+		switch {
+		case err != nil:
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		case errText != "":
+			job.Status = StatusFailed
+			job.Error = errText
+		default:
+			job.Status = StatusDone
+			job.header = header
+		}
+	})
+
+	if job.Status == StatusDone {
+		m.publish(job, progress.Event{Stage: progress.StageDone})
+	} else {
+		m.publish(job, progress.Event{Stage: progress.StageError, Message: job.Error})
+	}
+}
+
+// publish records a progress event and wakes up the event streams
+func (m *Manager) publish(job *Job, e progress.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.events = append(job.events, e)
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// eventsSince returns the events after the first n and a channel that is
+// closed when more arrive
+func (m *Manager) eventsSince(id string, n int) ([]progress.Event, <-chan struct{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+	events := append([]progress.Event(nil), job.events[n:]...)
+	return events, job.changed, true
+}
+
+func (m *Manager) update(job *Job, fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn()
+}
+
+// janitor drops expired jobs together with their files
+func (m *Manager) janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		var expired []string
+		m.mu.Lock()
+		for id, job := range m.jobs {
+			if job.ExpiresAt != nil && now.After(*job.ExpiresAt) {
+				expired = append(expired, id)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, id := range expired {
+			m.remove(id)
+		}
+	}
+}
+
+func (m *Manager) remove(id string) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	delete(m.jobs, id)
+	m.mu.Unlock()
+
+	if ok {
+		os.Remove(job.bodyPath)
+		os.Remove(job.resultPath)
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
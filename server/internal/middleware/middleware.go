@@ -22,6 +22,12 @@ func (w *responseWriterWrapper) WriteHeader(code int) {
 	w.wroteHeader = true
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController, which
+// streaming handlers use to flush
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // LoggingMiddleware logs incoming HTTP requests
 func Logger(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
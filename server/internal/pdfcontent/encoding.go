@@ -0,0 +1,171 @@
+package pdfcontent
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// baseEncoding returns the text of each code of a named simple font encoding
+func baseEncoding(name string) [256]string {
+	var enc [256]string
+	switch name {
+	case "WinAnsiEncoding", "PDFDocEncoding":
+		for i := range enc {
+			enc[i] = string(charmap.Windows1252.DecodeByte(byte(i)))
+		}
+	case "MacRomanEncoding":
+		for i := range enc {
+			enc[i] = string(charmap.Macintosh.DecodeByte(byte(i)))
+		}
+	default:
+		// StandardEncoding is ASCII with curly quotes and its own upper half
+		for i := 0x20; i < 0x7f; i++ {
+			enc[i] = string(rune(i))
+		}
+		enc['\''] = "’"
+		enc['`'] = "‘"
+		for code, glyph := range standardUpper {
+			enc[code] = GlyphText(glyph)
+		}
+	}
+	return enc
+}
+
+// Glyph names of StandardEncoding above 0x7f
+var standardUpper = map[int]string{
+	0xa1: "exclamdown", 0xa2: "cent", 0xa3: "sterling", 0xa4: "fraction", 0xa5: "yen",
+	0xa6: "florin", 0xa7: "section", 0xa8: "currency", 0xa9: "quotesingle", 0xaa: "quotedblleft",
+	0xab: "guillemotleft", 0xac: "guilsinglleft", 0xad: "guilsinglright", 0xae: "fi", 0xaf: "fl",
+	0xb1: "endash", 0xb2: "dagger", 0xb3: "daggerdbl", 0xb4: "periodcentered", 0xb6: "paragraph",
+	0xb7: "bullet", 0xb8: "quotesinglbase", 0xb9: "quotedblbase", 0xba: "quotedblright",
+	0xbb: "guillemotright", 0xbc: "ellipsis", 0xbd: "perthousand", 0xbf: "questiondown",
+	0xc1: "grave", 0xc2: "acute", 0xc3: "circumflex", 0xc4: "tilde", 0xc5: "macron", 0xc6: "breve",
+	0xc7: "dotaccent", 0xc8: "dieresis", 0xca: "ring", 0xcb: "cedilla", 0xcd: "hungarumlaut",
+	0xce: "ogonek", 0xcf: "caron", 0xd0: "emdash", 0xe1: "AE", 0xe3: "ordfeminine", 0xe8: "Lslash",
+	0xe9: "Oslash", 0xea: "OE", 0xeb: "ordmasculine", 0xf1: "ae", 0xf5: "dotlessi", 0xf8: "lslash",
+	0xf9: "oslash", 0xfa: "oe", 0xfb: "germandbls",
+}
+
+// Glyph names of the Latin character set that are not a letter with an accent
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$",
+	"percent": "%", "ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")",
+	"asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6",
+	"seven": "7", "eight": "8", "nine": "9", "colon": ":", "semicolon": ";", "less": "<",
+	"equal": "=", "greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_",
+	"grave": "`", "braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~",
+	"nbspace": " ", "exclamdown": "¡", "cent": "¢", "sterling": "£", "currency": "¤",
+	"yen": "¥", "brokenbar": "¦", "section": "§", "dieresis": "¨", "copyright": "©",
+	"ordfeminine": "ª", "guillemotleft": "«", "logicalnot": "¬", "sfthyphen": "­",
+	"registered": "®", "macron": "¯", "degree": "°", "plusminus": "±", "twosuperior": "²",
+	"threesuperior": "³", "acute": "´", "mu": "µ", "paragraph": "¶", "periodcentered": "·",
+	"cedilla": "¸", "onesuperior": "¹", "ordmasculine": "º", "guillemotright": "»",
+	"onequarter": "¼", "onehalf": "½", "threequarters": "¾", "questiondown": "¿",
+	"AE": "Æ", "ae": "æ", "Eth": "Ð", "eth": "ð", "Thorn": "Þ", "thorn": "þ",
+	"multiply": "×", "divide": "÷", "Oslash": "Ø", "oslash": "ø", "germandbls": "ß",
+	"Lslash": "Ł", "lslash": "ł", "OE": "Œ", "oe": "œ", "dotlessi": "ı", "florin": "ƒ",
+	"bullet": "•", "dagger": "†", "daggerdbl": "‡", "ellipsis": "…", "emdash": "—",
+	"endash": "–", "fraction": "⁄", "guilsinglleft": "‹", "guilsinglright": "›",
+	"minus": "−", "perthousand": "‰", "quotedblbase": "„", "quotedblleft": "“",
+	"quotedblright": "”", "quoteleft": "‘", "quoteright": "’", "quotesinglbase": "‚",
+	"trademark": "™", "Euro": "€", "circumflex": "ˆ", "tilde": "˜", "breve": "˘",
+	"dotaccent": "˙", "ring": "˚", "hungarumlaut": "˝", "ogonek": "˛", "caron": "ˇ",
+	"fi": "ﬁ", "fl": "ﬂ", "ff": "ﬀ", "ffi": "ﬃ", "ffl": "ﬄ",
+}
+
+// Accent suffixes of glyph names such as "eacute", with their combining marks
+var glyphAccents = []struct{ suffix, mark string }{
+	{"circumflex", "̂"}, {"dieresis", "̈"}, {"cedilla", "̧"},
+	{"grave", "̀"}, {"acute", "́"}, {"tilde", "̃"}, {"ring", "̊"},
+	{"caron", "̌"}, {"macron", "̄"}, {"breve", "̆"}, {"ogonek", "̨"},
+	{"dotaccent", "̇"}, {"hungarumlaut", "̋"},
+}
+
+// GlyphText maps a glyph name to its text, following the conventions of the
+// Adobe Glyph List for the Latin character set. Unknown names map to "".
+func GlyphText(name string) string {
+	// Variants such as "a.sc" and ligatures such as "f_i"
+	if base, _, found := strings.Cut(name, "."); found && base != "" {
+		return GlyphText(base)
+	}
+	if strings.Contains(name, "_") {
+		var b strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			b.WriteString(GlyphText(part))
+		}
+		return b.String()
+	}
+
+	if s, ok := glyphNames[name]; ok {
+		return s
+	}
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		return name
+	}
+
+	// uniXXXX, possibly several code units, and uXXXX to uXXXXXX
+	if hex, ok := strings.CutPrefix(name, "uni"); ok && len(hex) >= 4 && len(hex)%4 == 0 {
+		var b strings.Builder
+		for i := 0; i < len(hex); i += 4 {
+			v, err := strconv.ParseUint(hex[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			b.WriteRune(rune(v))
+		}
+		return b.String()
+	}
+	if hex, ok := strings.CutPrefix(name, "u"); ok && len(hex) >= 4 && len(hex) <= 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+
+	// A letter followed by an accent name, e.g. "Eacute" or "scaron"
+	for _, a := range glyphAccents {
+		if letter, ok := strings.CutSuffix(name, a.suffix); ok && len(letter) == 1 {
+			return norm.NFC.String(letter + a.mark)
+		}
+	}
+	return ""
+}
+
+// Glyph names by text, the reverse of glyphNames
+var namesByText = func() map[string]string {
+	m := make(map[string]string, len(glyphNames))
+	for name, text := range glyphNames {
+		// Prefer the names fonts commonly use for shared characters
+		if prev, ok := m[text]; ok && (name == "nbspace" || name == "sfthyphen" || prev < name) {
+			continue
+		}
+		m[text] = name
+	}
+	return m
+}()
+
+// glyphName returns the glyph name of an encoding entry, the reverse of
+// GlyphText. Text without a known name maps to "".
+func glyphName(text string) string {
+	if text == "" {
+		return ""
+	}
+	if name, ok := namesByText[text]; ok {
+		return name
+	}
+	if len(text) == 1 && (text[0] >= 'a' && text[0] <= 'z' || text[0] >= 'A' && text[0] <= 'Z') {
+		return text
+	}
+	if d := norm.NFD.String(text); len(d) > 1 && (d[0] >= 'a' && d[0] <= 'z' || d[0] >= 'A' && d[0] <= 'Z') {
+		for _, a := range glyphAccents {
+			if d[1:] == a.mark {
+				return d[:1] + a.suffix
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,406 @@
+package pdfcontent
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	pdffont "github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Font decodes the strings shown with a font resource into glyphs
+type Font struct {
+	Name string // BaseFont without a subset prefix
+
+	composite bool
+	codespace []codespaceRange
+	toCID     map[uint32]uint32
+	ucs2      bool // codes of a predefined Unicode CMap are UTF-16
+
+	toUnicode map[uint32]string
+	encoding  [256]string
+	names     [256]string // glyph names, empty where the font program's own encoding applies
+
+	widths       map[uint32]float64 // by code for simple fonts, by CID for composite ones
+	defaultWidth float64
+	scale        float64 // glyph space to text space
+}
+
+type codespaceRange struct {
+	low, high []byte
+}
+
+// Glyph is one character code of a shown string
+type Glyph struct {
+	Code  uint32
+	CID   uint32 // glyph selector of composite fonts, the code for simple fonts
+	Text  string
+	Width float64 // horizontal advance for a font size of 1
+	Space bool    // single-byte code 32, which word spacing applies to
+}
+
+// LoadFont reads a font dictionary. Fonts that cannot be read fully still
+// decode what they can; text of unknown codes is left empty.
+func LoadFont(xRefTable *model.XRefTable, o types.Object) (*Font, error) {
+	d, err := xRefTable.DereferenceDict(o)
+	if err != nil {
+		return nil, err
+	}
+	f := &Font{widths: map[uint32]float64{}, scale: 0.001}
+	if d == nil {
+		f.encoding = baseEncoding("StandardEncoding")
+		f.defaultWidth = 500
+		return f, nil
+	}
+
+	if name := d.NameEntry("BaseFont"); name != nil {
+		f.Name = *name
+		if i := strings.IndexByte(f.Name, '+'); i == 6 {
+			f.Name = f.Name[7:]
+		}
+	}
+	subtype := ""
+	if s := d.Subtype(); s != nil {
+		subtype = *s
+	}
+
+	if subtype == "Type0" {
+		f.loadComposite(xRefTable, d)
+	} else {
+		f.loadSimple(xRefTable, d, subtype)
+	}
+
+	if sd, _, err := xRefTable.DereferenceStreamDict(d["ToUnicode"]); err == nil && sd != nil {
+		if err := sd.Decode(); err == nil {
+			f.toUnicode = map[uint32]string{}
+			f.readCMap(sd.Content)
+		}
+	}
+	return f, nil
+}
+
+func (f *Font) loadSimple(xRefTable *model.XRefTable, d types.Dict, subtype string) {
+	base := "StandardEncoding"
+	if subtype == "TrueType" {
+		base = "WinAnsiEncoding"
+	}
+	var differences types.Array
+	explicit := false
+	switch enc := deref(xRefTable, d["Encoding"]).(type) {
+	case types.Name:
+		base, explicit = string(enc), true
+	case types.Dict:
+		if name := enc.NameEntry("BaseEncoding"); name != nil {
+			base, explicit = *name, true
+		}
+		differences, _ = deref(xRefTable, enc["Differences"]).(types.Array)
+	}
+	f.encoding = baseEncoding(base)
+	if explicit {
+		for code, text := range f.encoding {
+			f.names[code] = glyphName(text)
+		}
+	}
+
+	code := 0
+	for _, o := range differences {
+		switch v := deref(xRefTable, o).(type) {
+		case types.Integer:
+			code = v.Value()
+		case types.Name:
+			if code >= 0 && code < 256 {
+				f.encoding[code] = GlyphText(string(v))
+				f.names[code] = string(v)
+			}
+			code++
+		}
+	}
+
+	if subtype == "Type3" {
+		if m, ok := deref(xRefTable, d["FontMatrix"]).(types.Array); ok && len(m) > 0 {
+			f.scale = number(xRefTable, m[0])
+		}
+	}
+
+	first := 0
+	if v, ok := deref(xRefTable, d["FirstChar"]).(types.Integer); ok {
+		first = v.Value()
+	}
+	widths, _ := deref(xRefTable, d["Widths"]).(types.Array)
+	for i, o := range widths {
+		f.widths[uint32(first+i)] = number(xRefTable, o)
+	}
+
+	f.defaultWidth = 500
+	if fd, ok := deref(xRefTable, d["FontDescriptor"]).(types.Dict); ok {
+		if w, ok := fd["MissingWidth"]; ok {
+			f.defaultWidth = number(xRefTable, w)
+		}
+	}
+
+	// The standard 14 fonts may come without widths
+	if len(widths) == 0 && pdffont.IsCoreFont(f.Name) {
+		for code, text := range f.encoding {
+			if r := []rune(text); len(r) == 1 {
+				f.widths[uint32(code)] = float64(pdffont.CharWidth(f.Name, r[0]))
+			}
+		}
+	}
+}
+
+func (f *Font) loadComposite(xRefTable *model.XRefTable, d types.Dict) {
+	f.composite = true
+	f.defaultWidth = 1000
+
+	switch enc := deref(xRefTable, d["Encoding"]).(type) {
+	case types.Name:
+		name := string(enc)
+		if strings.HasPrefix(name, "Uni") && (strings.Contains(name, "UCS2") || strings.Contains(name, "UTF16")) {
+			f.ucs2 = true
+		}
+	case types.StreamDict:
+		if err := enc.Decode(); err == nil {
+			f.toCID = map[uint32]uint32{}
+			f.readCMap(enc.Content)
+		}
+	}
+	if len(f.codespace) == 0 {
+		f.codespace = []codespaceRange{{low: []byte{0, 0}, high: []byte{0xff, 0xff}}}
+	}
+
+	descendants, _ := deref(xRefTable, d["DescendantFonts"]).(types.Array)
+	if len(descendants) == 0 {
+		return
+	}
+	cidFont, ok := deref(xRefTable, descendants[0]).(types.Dict)
+	if !ok {
+		return
+	}
+	if dw, ok := cidFont["DW"]; ok {
+		f.defaultWidth = number(xRefTable, dw)
+	}
+
+	// W is a list of "c [w1 w2 ...]" and "cFirst cLast w" entries
+	w, _ := deref(xRefTable, cidFont["W"]).(types.Array)
+	for i := 0; i+1 < len(w); {
+		first := uint32(number(xRefTable, w[i]))
+		if a, ok := deref(xRefTable, w[i+1]).(types.Array); ok {
+			for j, o := range a {
+				f.widths[first+uint32(j)] = number(xRefTable, o)
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			break
+		}
+		last := uint32(number(xRefTable, w[i+1]))
+		width := number(xRefTable, w[i+2])
+		for k := uint32(0); last >= first && k <= last-first && k < 0x10000; k++ {
+			f.widths[first+k] = width
+		}
+		i += 3
+	}
+}
+
+// readCMap reads the mappings of a ToUnicode or encoding CMap
+func (f *Font) readCMap(data []byte) {
+	for _, op := range Parse(data) {
+		args := op.Operands
+		switch op.Operator {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(args); i += 2 {
+				low, ok1 := args[i].(String)
+				high, ok2 := args[i+1].(String)
+				if ok1 && ok2 && len(low) == len(high) && len(low) > 0 {
+					f.codespace = append(f.codespace, codespaceRange{low: low, high: high})
+				}
+			}
+		case "endbfchar":
+			if f.toUnicode == nil {
+				continue
+			}
+			for i := 0; i+1 < len(args); i += 2 {
+				if src, ok := args[i].(String); ok {
+					f.toUnicode[codeValue(src)] = unicodeText(args[i+1])
+				}
+			}
+		case "endbfrange":
+			if f.toUnicode == nil {
+				continue
+			}
+			for i := 0; i+2 < len(args); i += 3 {
+				low, ok1 := args[i].(String)
+				high, ok2 := args[i+1].(String)
+				if !ok1 || !ok2 {
+					continue
+				}
+				lo, hi := codeValue(low), codeValue(high)
+				if hi < lo || hi-lo > 0xffff {
+					continue
+				}
+				switch dst := args[i+2].(type) {
+				case String:
+					for k := uint32(0); k <= hi-lo; k++ {
+						f.toUnicode[lo+k] = unicodeText(incrementLast(dst, int(k)))
+					}
+				case []Object:
+					for j, o := range dst {
+						if lo+uint32(j) > hi {
+							break
+						}
+						f.toUnicode[lo+uint32(j)] = unicodeText(o)
+					}
+				}
+			}
+		case "endcidchar":
+			if f.toCID == nil {
+				continue
+			}
+			for i := 0; i+1 < len(args); i += 2 {
+				src, ok1 := args[i].(String)
+				cid, ok2 := args[i+1].(float64)
+				if ok1 && ok2 {
+					f.toCID[codeValue(src)] = uint32(cid)
+				}
+			}
+		case "endcidrange":
+			if f.toCID == nil {
+				continue
+			}
+			for i := 0; i+2 < len(args); i += 3 {
+				low, ok1 := args[i].(String)
+				high, ok2 := args[i+1].(String)
+				cid, ok3 := args[i+2].(float64)
+				if !ok1 || !ok2 || !ok3 {
+					continue
+				}
+				lo, hi := codeValue(low), codeValue(high)
+				if hi < lo || hi-lo > 0xffff {
+					continue
+				}
+				for k := uint32(0); k <= hi-lo; k++ {
+					f.toCID[lo+k] = uint32(cid) + k
+				}
+			}
+		}
+	}
+}
+
+// Glyphs splits a shown string into its character codes
+func (f *Font) Glyphs(s []byte) []Glyph {
+	var glyphs []Glyph
+	for len(s) > 0 {
+		n := 1
+		if f.composite {
+			n = f.codeLength(s)
+		}
+		code := codeValue(s[:n])
+		s = s[n:]
+
+		g := Glyph{Code: code, CID: code, Space: n == 1 && code == 32}
+		if cid, ok := f.toCID[code]; ok {
+			g.CID = cid
+		}
+		w, ok := f.widths[g.CID]
+		if !ok {
+			w = f.defaultWidth
+		}
+		g.Width = w * f.scale
+
+		switch text, ok := f.toUnicode[code]; {
+		case ok:
+			g.Text = text
+		case f.ucs2:
+			g.Text = string(utf16.Decode([]uint16{uint16(code)}))
+		case !f.composite:
+			g.Text = f.encoding[code]
+		}
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+// GlyphName returns the glyph name the encoding of a simple font gives a
+// code, or "" if the font program's built-in encoding applies
+func (f *Font) GlyphName(code uint32) string {
+	if f.composite || code > 0xff {
+		return ""
+	}
+	return f.names[code]
+}
+
+// codeLength finds the byte length of the code at the start of s
+func (f *Font) codeLength(s []byte) int {
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, r := range f.codespace {
+			if len(r.low) == n && inRange(s[:n], r) {
+				return n
+			}
+		}
+	}
+	return min(2, len(s))
+}
+
+func inRange(code []byte, r codespaceRange) bool {
+	for i, b := range code {
+		if b < r.low[i] || b > r.high[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// incrementLast adds n to the last byte of a bfrange destination
+func incrementLast(b String, n int) String {
+	out := append(String(nil), b...)
+	if len(out) > 0 {
+		out[len(out)-1] += byte(n)
+	}
+	return out
+}
+
+// unicodeText decodes a UTF-16BE CMap destination; names are glyph names
+func unicodeText(o Object) string {
+	switch v := o.(type) {
+	case String:
+		u := make([]uint16, 0, len(v)/2)
+		for i := 0; i+1 < len(v); i += 2 {
+			u = append(u, uint16(v[i])<<8|uint16(v[i+1]))
+		}
+		return string(utf16.Decode(u))
+	case Name:
+		return GlyphText(string(v))
+	}
+	return ""
+}
+
+func deref(xRefTable *model.XRefTable, o types.Object) types.Object {
+	if o == nil {
+		return nil
+	}
+	v, err := xRefTable.Dereference(o)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func number(xRefTable *model.XRefTable, o types.Object) float64 {
+	switch v := deref(xRefTable, o).(type) {
+	case types.Integer:
+		return float64(v.Value())
+	case types.Float:
+		return v.Value()
+	}
+	return 0
+}
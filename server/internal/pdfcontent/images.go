@@ -0,0 +1,103 @@
+package pdfcontent
+
+import (
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// ImagePlacement is an image XObject drawn on a page, with the size it is
+// drawn at in default user space units
+type ImagePlacement struct {
+	ObjNr         int
+	Width, Height float64
+}
+
+// PageImages returns the image XObjects drawn on a page, including those
+// drawn by form XObjects. Inline images are not reported.
+func PageImages(xRefTable *model.XRefTable, pageNr int) ([]ImagePlacement, error) {
+	d, _, inh, err := xRefTable.PageDict(pageNr, false)
+	if err != nil {
+		return nil, err
+	}
+	content, err := xRefTable.PageContent(d)
+	if err != nil && err != model.ErrNoContent {
+		return nil, err
+	}
+
+	e := &imageFinder{xRefTable: xRefTable}
+	e.run(content, inh.Resources, Identity, 0)
+	return e.placements, nil
+}
+
+type imageFinder struct {
+	xRefTable  *model.XRefTable
+	placements []ImagePlacement
+}
+
+func (e *imageFinder) run(content []byte, resources types.Dict, ctm Matrix, depth int) {
+	var stack []Matrix
+	for _, op := range Parse(content) {
+		switch op.Operator {
+		case "q":
+			stack = append(stack, ctm)
+		case "Q":
+			if len(stack) > 0 {
+				ctm = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if m, ok := MatrixFrom(op.Operands); ok {
+				ctm = m.Multiply(ctm)
+			}
+		case "Do":
+			if len(op.Operands) == 0 {
+				continue
+			}
+			if name, ok := op.Operands[len(op.Operands)-1].(Name); ok {
+				e.xObject(resources, name, ctm, depth)
+			}
+		}
+	}
+}
+
+func (e *imageFinder) xObject(resources types.Dict, name Name, ctm Matrix, depth int) {
+	xobjects, ok := deref(e.xRefTable, resources["XObject"]).(types.Dict)
+	if !ok {
+		return
+	}
+	o := xobjects[string(name)]
+	sd, _, err := e.xRefTable.DereferenceStreamDict(o)
+	if err != nil || sd == nil || sd.Subtype() == nil {
+		return
+	}
+
+	switch *sd.Subtype() {
+	case "Image":
+		// Images fill the unit square, so the CTM gives their size
+		ref, ok := o.(types.IndirectRef)
+		if !ok {
+			return
+		}
+		e.placements = append(e.placements, ImagePlacement{
+			ObjNr:  ref.ObjectNumber.Value(),
+			Width:  math.Hypot(ctm[0], ctm[1]),
+			Height: math.Hypot(ctm[2], ctm[3]),
+		})
+	case "Form":
+		if depth >= maxFormDepth || sd.Decode() != nil {
+			return
+		}
+		if a, ok := deref(e.xRefTable, sd.Dict["Matrix"]).(types.Array); ok {
+			if m, ok := MatrixFrom(numbers(e.xRefTable, a)); ok {
+				ctm = m.Multiply(ctm)
+			}
+		}
+		formResources := resources
+		if r, ok := deref(e.xRefTable, sd.Dict["Resources"]).(types.Dict); ok {
+			formResources = r
+		}
+		e.run(sd.Content, formResources, ctm, depth+1)
+	}
+}
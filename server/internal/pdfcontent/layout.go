@@ -0,0 +1,138 @@
+package pdfcontent
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// TextLine is text on a common baseline, in reading order
+type TextLine struct {
+	Text     string
+	X, Y     float64 // start of the baseline
+	EndX     float64
+	FontSize float64
+}
+
+// TextBlock is a group of lines that read together, such as a paragraph.
+// Its box is in default user space, with Y growing upwards.
+type TextBlock struct {
+	Text                string
+	Lines               []TextLine
+	X, Y, Width, Height float64 // lower-left corner and size
+	FontSize            float64
+}
+
+// Lines groups spans into lines. Spans on the same baseline that are close
+// enough are joined, with a space where the gap between them looks like one.
+func Lines(spans []TextSpan) []TextLine {
+	sorted := make([]TextSpan, 0, len(spans))
+	for _, s := range spans {
+		if strings.TrimSpace(s.Text) != "" && s.FontSize > 0 && s.EndX >= s.X {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].X < sorted[j].X })
+
+	var lines []TextLine
+	for _, s := range sorted {
+		best := -1
+		for i, l := range lines {
+			size := math.Max(l.FontSize, s.FontSize)
+			gap := s.X - l.EndX
+			// Overlapping glyphs still belong to the line; far apart ones are
+			// probably another column
+			if math.Abs(l.Y-s.Y) <= 0.3*size && gap > -0.5*size && gap < 1.5*size {
+				best = i
+				break
+			}
+		}
+		if best < 0 {
+			lines = append(lines, TextLine{Text: s.Text, X: s.X, Y: s.Y, EndX: s.EndX, FontSize: s.FontSize})
+			continue
+		}
+		l := &lines[best]
+		if s.X-l.EndX > 0.15*math.Min(l.FontSize, s.FontSize) && !endsWithSpace(l.Text) && !startsWithSpace(s.Text) {
+			l.Text += " "
+		}
+		l.Text += s.Text
+		l.EndX = math.Max(l.EndX, s.EndX)
+		l.FontSize = math.Max(l.FontSize, s.FontSize)
+	}
+
+	for i := range lines {
+		lines[i].Text = strings.Join(strings.Fields(lines[i].Text), " ")
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].Y != lines[j].Y {
+			return lines[i].Y > lines[j].Y
+		}
+		return lines[i].X < lines[j].X
+	})
+	return lines
+}
+
+// Blocks groups lines that follow each other closely and overlap
+// horizontally. Blocks are ordered from the top of the page down.
+func Blocks(lines []TextLine) []TextBlock {
+	var blocks []TextBlock
+	for _, l := range lines {
+		best := -1
+		for i := range blocks {
+			b := &blocks[i]
+			last := b.Lines[len(b.Lines)-1]
+			dy := last.Y - l.Y
+			overlap := math.Min(b.X+b.Width, l.EndX) - math.Max(b.X, l.X)
+			similar := l.FontSize <= 1.5*last.FontSize && last.FontSize <= 1.5*l.FontSize
+			if dy > 0 && dy <= 2*math.Max(last.FontSize, l.FontSize) && overlap > 0 && similar {
+				best = i
+			}
+		}
+		if best < 0 {
+			blocks = append(blocks, TextBlock{Lines: []TextLine{l}, X: l.X, Width: l.EndX - l.X})
+			continue
+		}
+		b := &blocks[best]
+		b.Lines = append(b.Lines, l)
+		right := math.Max(b.X+b.Width, l.EndX)
+		b.X = math.Min(b.X, l.X)
+		b.Width = right - b.X
+	}
+
+	for i := range blocks {
+		b := &blocks[i]
+		texts := make([]string, len(b.Lines))
+		for j, l := range b.Lines {
+			texts[j] = l.Text
+			b.FontSize = math.Max(b.FontSize, l.FontSize)
+		}
+		b.Text = strings.Join(texts, "\n")
+
+		// The box reaches from below the last baseline to the top of the first line
+		first, last := b.Lines[0], b.Lines[len(b.Lines)-1]
+		b.Y = last.Y - 0.25*last.FontSize
+		b.Height = first.Y + 0.75*first.FontSize - b.Y
+	}
+	return blocks
+}
+
+// PlainText joins the lines of blocks, leaving an empty line between blocks
+func PlainText(blocks []TextBlock) string {
+	texts := make([]string, len(blocks))
+	for i, b := range blocks {
+		texts[i] = b.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func startsWithSpace(s string) bool {
+	for _, r := range s {
+		return unicode.IsSpace(r)
+	}
+	return false
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && unicode.IsSpace(rune(s[len(s)-1]))
+}
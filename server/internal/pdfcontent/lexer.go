@@ -0,0 +1,385 @@
+// Package pdfcontent reads PDF content streams. It parses the operators of
+// a stream and interprets the text they show, which is enough to extract the
+// text of a page together with its approximate position.
+package pdfcontent
+
+import "strconv"
+
+// Operands of a content stream operator are one of float64, bool, Name,
+// String, []Object, map[Name]Object or nil
+type Object = any
+
+// Name is a PDF name without its leading slash
+type Name string
+
+// String holds the bytes of a literal or hexadecimal string
+type String []byte
+
+// Operation is an operator together with the operands preceding it. Inline
+// images are reported as a "BI" operation whose operands are the image
+// dictionary and the image data.
+type Operation struct {
+	Operator string
+	Operands []Object
+}
+
+// Parse splits a content stream into operations. Malformed input is skipped
+// rather than rejected, as viewers do.
+func Parse(data []byte) []Operation {
+	l := &lexer{data: data}
+	var ops []Operation
+	var operands []Object
+	for {
+		tok, ok := l.next()
+		if !ok {
+			return ops
+		}
+		if _, isDelim := tok.(delimiter); isDelim {
+			continue
+		}
+		kw, isKeyword := tok.(keyword)
+		if !isKeyword {
+			operands = append(operands, tok)
+			continue
+		}
+		if kw == "BI" {
+			dict, data := l.inlineImage()
+			ops = append(ops, Operation{Operator: "BI", Operands: []Object{dict, data}})
+			operands = nil
+			continue
+		}
+		ops = append(ops, Operation{Operator: string(kw), Operands: operands})
+		operands = nil
+	}
+}
+
+// keyword is a bare word, an operator unless it is true, false or null
+type keyword string
+
+// Closing delimiters returned by next, consumed by arrays and dictionaries
+type delimiter byte
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipWhitespace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isWhitespace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next object, keyword or closing delimiter
+func (l *lexer) next() (Object, bool) {
+	for {
+		l.skipWhitespace()
+		if l.pos >= len(l.data) {
+			return nil, false
+		}
+		c := l.data[l.pos]
+		switch {
+		case c == '(':
+			l.pos++
+			return l.literalString(), true
+		case c == '<' && l.peek(1) == '<':
+			l.pos += 2
+			return l.dict(), true
+		case c == '<':
+			l.pos++
+			return l.hexString(), true
+		case c == '>' && l.peek(1) == '>':
+			l.pos += 2
+			return delimiter('>'), true
+		case c == '[':
+			l.pos++
+			return l.array(), true
+		case c == ']':
+			l.pos++
+			return delimiter(']'), true
+		case c == '/':
+			l.pos++
+			return l.name(), true
+		case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			if n, ok := l.number(); ok {
+				return n, true
+			}
+		case isDelimiter(c):
+			// Stray delimiters such as ')' or '{' carry no meaning here
+			l.pos++
+		default:
+			word := l.word()
+			switch word {
+			case "true":
+				return true, true
+			case "false":
+				return false, true
+			case "null":
+				return nil, true
+			}
+			return keyword(word), true
+		}
+	}
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *lexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *lexer) number() (float64, bool) {
+	start := l.pos
+	if c := l.data[l.pos]; c == '+' || c == '-' {
+		l.pos++
+	}
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if (c < '0' || c > '9') && c != '.' {
+			break
+		}
+		l.pos++
+	}
+	n, err := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+	if err != nil {
+		// Some producers write numbers such as "--5"; skip them
+		return 0, false
+	}
+	return n, true
+}
+
+func (l *lexer) name() Name {
+	var b []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) || isDelimiter(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return Name(b)
+}
+
+func (l *lexer) literalString() String {
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(b)
+			}
+		case '\r':
+			// An end of line in a string is always read as \n
+			if l.peek(0) == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				return String(b)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Line continuation
+				if l.peek(0) == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return String(b)
+}
+
+func (l *lexer) hexString() String {
+	var b []byte
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		if v, ok := hexValue(c); ok {
+			digits = append(digits, v)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, 0)
+	}
+	for i := 0; i < len(digits); i += 2 {
+		b = append(b, digits[i]<<4|digits[i+1])
+	}
+	return String(b)
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (l *lexer) array() []Object {
+	a := []Object{}
+	for {
+		tok, ok := l.next()
+		if !ok || tok == delimiter(']') {
+			return a
+		}
+		if _, isDelim := tok.(delimiter); isDelim {
+			continue
+		}
+		a = append(a, tok)
+	}
+}
+
+func (l *lexer) dict() map[Name]Object {
+	d := map[Name]Object{}
+	for {
+		tok, ok := l.next()
+		if !ok || tok == delimiter('>') {
+			return d
+		}
+		key, isName := tok.(Name)
+		if !isName {
+			continue
+		}
+		value, ok := l.next()
+		if !ok || value == delimiter('>') {
+			return d
+		}
+		d[key] = value
+	}
+}
+
+// inlineImage reads the dictionary and data of an inline image following BI
+func (l *lexer) inlineImage() (map[Name]Object, String) {
+	dict := map[Name]Object{}
+	for {
+		tok, ok := l.next()
+		if !ok {
+			return dict, nil
+		}
+		if tok == keyword("ID") {
+			break
+		}
+		key, isName := tok.(Name)
+		if !isName {
+			continue
+		}
+		if value, ok := l.next(); ok {
+			dict[key] = value
+		}
+	}
+
+	// A single whitespace byte separates ID from the data
+	l.pos++
+	if l.pos > len(l.data) {
+		return dict, nil
+	}
+	start := l.pos
+
+	// The data ends at "EI" standing on its own; binary data may contain
+	// the same bytes, so require whitespace around it
+	for i := start; i+2 <= len(l.data); i++ {
+		if l.data[i] != 'E' || l.data[i+1] != 'I' {
+			continue
+		}
+		before := i == start || isWhitespace(l.data[i-1])
+		after := i+2 == len(l.data) || isWhitespace(l.data[i+2])
+		if before && after {
+			end := i
+			if end > start {
+				end--
+			}
+			l.pos = i + 2
+			return dict, String(l.data[start:end])
+		}
+	}
+	l.pos = len(l.data)
+	return dict, String(l.data[start:])
+}
@@ -0,0 +1,307 @@
+package pdfcontent
+
+import (
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Form XObjects may nest, but not without limit
+const maxFormDepth = 12
+
+// Matrix is a PDF transformation matrix [a b c d e f]
+type Matrix [6]float64
+
+// Identity is the identity matrix
+var Identity = Matrix{1, 0, 0, 1, 0, 0}
+
+// Multiply returns m × n, i.e. m applied first and then n
+func (m Matrix) Multiply(n Matrix) Matrix {
+	return Matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// Apply transforms the point (x, y)
+func (m Matrix) Apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// MatrixFrom reads six numeric operands or array elements
+func MatrixFrom(args []Object) (Matrix, bool) {
+	if len(args) < 6 {
+		return Identity, false
+	}
+	var m Matrix
+	for i := range m {
+		v, ok := args[len(args)-6+i].(float64)
+		if !ok {
+			return Identity, false
+		}
+		m[i] = v
+	}
+	return m, true
+}
+
+// TextSpan is a run of text shown by one operator, positioned in the
+// default user space of the page
+type TextSpan struct {
+	Text     string
+	X, Y     float64 // start of the baseline
+	EndX     float64 // end of the baseline
+	FontSize float64
+}
+
+// TextState holds the text parameters of the graphics state
+type TextState struct {
+	Font      *Font
+	Size      float64
+	CharSpace float64
+	WordSpace float64
+	Scale     float64
+	Leading   float64
+	Rise      float64
+}
+
+// Fonts caches the fonts of a document by object number
+type Fonts struct {
+	xRefTable *model.XRefTable
+	byObj     map[int]*Font
+}
+
+// NewFonts returns an empty font cache for a document
+func NewFonts(xRefTable *model.XRefTable) *Fonts {
+	return &Fonts{xRefTable: xRefTable, byObj: map[int]*Font{}}
+}
+
+// Lookup returns the font resource called name in resources
+func (fs *Fonts) Lookup(resources types.Dict, name Name) *Font {
+	fonts, ok := deref(fs.xRefTable, resources["Font"]).(types.Dict)
+	if !ok {
+		return nil
+	}
+	o, ok := fonts[string(name)]
+	if !ok {
+		return nil
+	}
+	ref, isRef := o.(types.IndirectRef)
+	if isRef {
+		if f, ok := fs.byObj[ref.ObjectNumber.Value()]; ok {
+			return f
+		}
+	}
+	f, err := LoadFont(fs.xRefTable, o)
+	if err != nil {
+		return nil
+	}
+	if isRef {
+		fs.byObj[ref.ObjectNumber.Value()] = f
+	}
+	return f
+}
+
+// PageText returns the text shown on a page in content stream order
+func PageText(xRefTable *model.XRefTable, fonts *Fonts, pageNr int) ([]TextSpan, error) {
+	d, _, inh, err := xRefTable.PageDict(pageNr, false)
+	if err != nil {
+		return nil, err
+	}
+	content, err := xRefTable.PageContent(d)
+	if err != nil && err != model.ErrNoContent {
+		return nil, err
+	}
+
+	e := &textExtractor{xRefTable: xRefTable, fonts: fonts}
+	e.run(content, inh.Resources, Identity, TextState{Scale: 1}, 0)
+	return e.spans, nil
+}
+
+type textExtractor struct {
+	xRefTable *model.XRefTable
+	fonts     *Fonts
+	spans     []TextSpan
+}
+
+type textGState struct {
+	ctm  Matrix
+	text TextState
+}
+
+func (e *textExtractor) run(content []byte, resources types.Dict, ctm Matrix, ts TextState, depth int) {
+	var stack []textGState
+	tm, tlm := Identity, Identity
+
+	for _, op := range Parse(content) {
+		args := op.Operands
+		switch op.Operator {
+		case "q":
+			stack = append(stack, textGState{ctm, ts})
+		case "Q":
+			if len(stack) > 0 {
+				ctm, ts = stack[len(stack)-1].ctm, stack[len(stack)-1].text
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if m, ok := MatrixFrom(args); ok {
+				ctm = m.Multiply(ctm)
+			}
+
+		case "BT":
+			tm, tlm = Identity, Identity
+		case "Tc":
+			ts.CharSpace = lastNumber(args, ts.CharSpace)
+		case "Tw":
+			ts.WordSpace = lastNumber(args, ts.WordSpace)
+		case "Tz":
+			ts.Scale = lastNumber(args, ts.Scale*100) / 100
+		case "TL":
+			ts.Leading = lastNumber(args, ts.Leading)
+		case "Ts":
+			ts.Rise = lastNumber(args, ts.Rise)
+		case "Tf":
+			if len(args) >= 2 {
+				if name, ok := args[len(args)-2].(Name); ok {
+					ts.Font = e.fonts.Lookup(resources, name)
+				}
+				ts.Size = lastNumber(args, ts.Size)
+			}
+		case "Td", "TD":
+			if len(args) >= 2 {
+				tx, _ := args[len(args)-2].(float64)
+				ty, _ := args[len(args)-1].(float64)
+				if op.Operator == "TD" {
+					ts.Leading = -ty
+				}
+				tlm = Matrix{1, 0, 0, 1, tx, ty}.Multiply(tlm)
+				tm = tlm
+			}
+		case "Tm":
+			if m, ok := MatrixFrom(args); ok {
+				tm, tlm = m, m
+			}
+		case "T*":
+			tlm = Matrix{1, 0, 0, 1, 0, -ts.Leading}.Multiply(tlm)
+			tm = tlm
+
+		case "Tj", "'", "\"":
+			if op.Operator != "Tj" {
+				if op.Operator == "\"" && len(args) >= 3 {
+					ts.WordSpace, _ = args[len(args)-3].(float64)
+					ts.CharSpace, _ = args[len(args)-2].(float64)
+				}
+				tlm = Matrix{1, 0, 0, 1, 0, -ts.Leading}.Multiply(tlm)
+				tm = tlm
+			}
+			if len(args) > 0 {
+				if s, ok := args[len(args)-1].(String); ok {
+					tm = e.show(s, tm, ctm, ts)
+				}
+			}
+		case "TJ":
+			if len(args) == 0 {
+				continue
+			}
+			a, _ := args[len(args)-1].([]Object)
+			for _, o := range a {
+				switch v := o.(type) {
+				case String:
+					tm = e.show(v, tm, ctm, ts)
+				case float64:
+					tx := -v / 1000 * ts.Size * ts.Scale
+					tm = Matrix{1, 0, 0, 1, tx, 0}.Multiply(tm)
+				}
+			}
+
+		case "Do":
+			if depth >= maxFormDepth || len(args) == 0 {
+				continue
+			}
+			if name, ok := args[len(args)-1].(Name); ok {
+				e.form(resources, name, ctm, ts, depth)
+			}
+		}
+	}
+}
+
+// form runs the content of a form XObject
+func (e *textExtractor) form(resources types.Dict, name Name, ctm Matrix, ts TextState, depth int) {
+	xobjects, ok := deref(e.xRefTable, resources["XObject"]).(types.Dict)
+	if !ok {
+		return
+	}
+	sd, _, err := e.xRefTable.DereferenceStreamDict(xobjects[string(name)])
+	if err != nil || sd == nil {
+		return
+	}
+	if subtype := sd.Subtype(); subtype == nil || *subtype != "Form" {
+		return
+	}
+	if err := sd.Decode(); err != nil {
+		return
+	}
+
+	if a, ok := deref(e.xRefTable, sd.Dict["Matrix"]).(types.Array); ok {
+		if m, ok := MatrixFrom(numbers(e.xRefTable, a)); ok {
+			ctm = m.Multiply(ctm)
+		}
+	}
+	formResources := resources
+	if r, ok := deref(e.xRefTable, sd.Dict["Resources"]).(types.Dict); ok {
+		formResources = r
+	}
+	e.run(sd.Content, formResources, ctm, ts, depth+1)
+}
+
+// show records a string and returns the text matrix advanced past it
+func (e *textExtractor) show(s String, tm, ctm Matrix, ts TextState) Matrix {
+	if ts.Font == nil {
+		return tm
+	}
+
+	// The text rendering matrix maps text space to user space
+	trm := func() Matrix {
+		return Matrix{ts.Size * ts.Scale, 0, 0, ts.Size, 0, ts.Rise}.Multiply(tm).Multiply(ctm)
+	}
+	start := trm()
+	span := TextSpan{X: start[4], Y: start[5], FontSize: math.Hypot(start[2], start[3])}
+
+	var text []byte
+	for _, g := range ts.Font.Glyphs(s) {
+		text = append(text, g.Text...)
+		tx := g.Width*ts.Size + ts.CharSpace
+		if g.Space {
+			tx += ts.WordSpace
+		}
+		tm = Matrix{1, 0, 0, 1, tx * ts.Scale, 0}.Multiply(tm)
+	}
+	end := trm()
+	span.EndX = end[4]
+	span.Text = string(text)
+	e.spans = append(e.spans, span)
+	return tm
+}
+
+func lastNumber(args []Object, def float64) float64 {
+	if len(args) == 0 {
+		return def
+	}
+	if v, ok := args[len(args)-1].(float64); ok {
+		return v
+	}
+	return def
+}
+
+// numbers converts a pdfcpu array of numbers into operands
+func numbers(xRefTable *model.XRefTable, a types.Array) []Object {
+	out := make([]Object, len(a))
+	for i, o := range a {
+		out[i] = number(xRefTable, o)
+	}
+	return out
+}
@@ -0,0 +1,699 @@
+package pdfrender
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"file-conv/internal/pdfcontent"
+)
+
+var errInvalidFont = errors.New("invalid font program")
+
+// cffFont is a CFF font program, embedded bare as FontFile3 or as the CFF
+// table of an OpenType font. Its glyphs are Type 2 charstrings.
+type cffFont struct {
+	charStrings [][]byte
+	gsubrs      [][]byte
+	subrs       [][]byte   // local subroutines of name-keyed fonts
+	fdSubrs     [][][]byte // local subroutines of each font DICT of CID-keyed fonts
+	fdSelect    []int      // font DICT of each glyph
+	cidKeyed    bool
+	names       map[string]int // glyph index by name
+	cids        map[int]int    // glyph index by CID
+	encoding    [256]int       // built-in encoding, glyph index by code
+	matrix      pdfcontent.Matrix
+}
+
+// cffReader reads the structures of a CFF font; reading past the end sets
+// bad rather than failing at once
+type cffReader struct {
+	data []byte
+	pos  int
+	bad  bool
+}
+
+func (r *cffReader) u8() int {
+	if r.pos >= len(r.data) {
+		r.bad = true
+		return 0
+	}
+	r.pos++
+	return int(r.data[r.pos-1])
+}
+
+func (r *cffReader) u16() int {
+	return r.u8()<<8 | r.u8()
+}
+
+func (r *cffReader) offset(size int) int {
+	v := 0
+	for i := 0; i < size; i++ {
+		v = v<<8 | r.u8()
+	}
+	return v
+}
+
+// index reads an INDEX structure
+func (r *cffReader) index() [][]byte {
+	count := r.u16()
+	if count == 0 || r.bad {
+		return nil
+	}
+	size := r.u8()
+	if size < 1 || size > 4 {
+		r.bad = true
+		return nil
+	}
+	offsets := make([]int, count+1)
+	for i := range offsets {
+		offsets[i] = r.offset(size)
+	}
+	base := r.pos - 1 // offsets count from 1
+	items := make([][]byte, count)
+	for i := range items {
+		start, end := base+offsets[i], base+offsets[i+1]
+		if start < r.pos || end < start || end > len(r.data) {
+			r.bad = true
+			return nil
+		}
+		items[i] = r.data[start:end]
+	}
+	r.pos = base + offsets[count]
+	return items
+}
+
+// indexAt reads the INDEX at an offset from the start of the font
+func (r *cffReader) indexAt(offset int) [][]byte {
+	if offset <= 0 || offset >= len(r.data) {
+		return nil
+	}
+	r.pos = offset
+	return r.index()
+}
+
+// cffDict holds the operands of a DICT by operator; two-byte operators are
+// keyed 1200 + their second byte
+type cffDict map[int][]float64
+
+func parseCFFDict(b []byte) cffDict {
+	d := cffDict{}
+	var operands []float64
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c <= 21:
+			op := int(c)
+			i++
+			if c == 12 && i < len(b) {
+				op = 1200 + int(b[i])
+				i++
+			}
+			d[op] = operands
+			operands = nil
+		case c == 28 && i+2 < len(b):
+			operands = append(operands, float64(int16(uint16(b[i+1])<<8|uint16(b[i+2]))))
+			i += 3
+		case c == 29 && i+4 < len(b):
+			operands = append(operands, float64(int32(uint32(b[i+1])<<24|uint32(b[i+2])<<16|uint32(b[i+3])<<8|uint32(b[i+4]))))
+			i += 5
+		case c == 30:
+			v, n := cffReal(b[i+1:])
+			operands = append(operands, v)
+			i += 1 + n
+		case c >= 32 && c <= 246:
+			operands = append(operands, float64(int(c)-139))
+			i++
+		case c >= 247 && c <= 250 && i+1 < len(b):
+			operands = append(operands, float64((int(c)-247)*256+int(b[i+1])+108))
+			i += 2
+		case c >= 251 && c <= 254 && i+1 < len(b):
+			operands = append(operands, float64(-(int(c)-251)*256-int(b[i+1])-108))
+			i += 2
+		default:
+			return d
+		}
+	}
+	return d
+}
+
+// cffReal decodes a real number operand, returning it and its length
+func cffReal(b []byte) (float64, int) {
+	var s strings.Builder
+	for i, c := range b {
+		for _, nibble := range []byte{c >> 4, c & 0xf} {
+			switch {
+			case nibble <= 9:
+				s.WriteByte('0' + nibble)
+			case nibble == 0xa:
+				s.WriteByte('.')
+			case nibble == 0xb:
+				s.WriteByte('E')
+			case nibble == 0xc:
+				s.WriteString("E-")
+			case nibble == 0xe:
+				s.WriteByte('-')
+			case nibble == 0xf:
+				v, _ := strconv.ParseFloat(s.String(), 64)
+				return v, i + 1
+			}
+		}
+	}
+	return 0, len(b)
+}
+
+func (d cffDict) int(op, def int) int {
+	if v := d[op]; len(v) > 0 {
+		return int(v[len(v)-1])
+	}
+	return def
+}
+
+// parseCFF reads the glyphs of the first font of a CFF font set
+func parseCFF(data []byte) (*cffFont, error) {
+	if len(data) < 4 || data[0] != 1 {
+		return nil, errInvalidFont
+	}
+	r := &cffReader{data: data, pos: int(data[2])}
+	r.index() // Name INDEX
+	tops := r.index()
+	strs := r.index()
+	gsubrs := r.index()
+	if r.bad || len(tops) == 0 {
+		return nil, errInvalidFont
+	}
+	top := parseCFFDict(tops[0])
+
+	c := &cffFont{gsubrs: gsubrs, matrix: pdfcontent.Matrix{0.001, 0, 0, 0.001, 0, 0}}
+	if m := top[1207]; len(m) == 6 {
+		copy(c.matrix[:], m)
+	}
+	c.charStrings = r.indexAt(top.int(17, 0))
+	n := len(c.charStrings)
+	if r.bad || n == 0 {
+		return nil, errInvalidFont
+	}
+	str := func(sid int) string {
+		if sid < len(cffStandardStrings) {
+			return cffStandardStrings[sid]
+		}
+		if i := sid - len(cffStandardStrings); i < len(strs) {
+			return string(strs[i])
+		}
+		return ""
+	}
+
+	charset := r.charset(top.int(15, 0), n)
+	_, c.cidKeyed = top[1230]
+	if c.cidKeyed {
+		c.cids = make(map[int]int, n)
+		for gid, cid := range charset {
+			c.cids[cid] = gid
+		}
+		for _, fd := range r.indexAt(top.int(1236, 0)) {
+			c.fdSubrs = append(c.fdSubrs, r.privateSubrs(parseCFFDict(fd)))
+		}
+		c.fdSelect = r.fdSelect(top.int(1237, 0), n)
+	} else {
+		c.subrs = r.privateSubrs(top)
+		c.names = make(map[string]int, n)
+		bySID := make(map[int]int, n)
+		for gid, sid := range charset {
+			c.names[str(sid)] = gid
+			bySID[sid] = gid
+		}
+		r.encoding(top.int(16, 0), bySID, &c.encoding)
+	}
+	return c, nil
+}
+
+// charset reads the string ID, or the CID of CID-keyed fonts, of each glyph
+func (r *cffReader) charset(offset, n int) []int {
+	ids := make([]int, n)
+	// The predefined charsets are taken to be the identity
+	if offset <= 2 {
+		for i := range ids {
+			ids[i] = i
+		}
+		return ids
+	}
+	r.pos = offset
+	format := r.u8()
+	for gid := 1; gid < n && !r.bad; {
+		switch format {
+		case 0:
+			ids[gid] = r.u16()
+			gid++
+		case 1, 2:
+			first := r.u16()
+			left := r.u8()
+			if format == 2 {
+				left = left<<8 | r.u8()
+			}
+			for k := 0; k <= left && gid < n; k++ {
+				ids[gid] = first + k
+				gid++
+			}
+		default:
+			return ids
+		}
+	}
+	return ids
+}
+
+// encoding reads the built-in encoding of a name-keyed font
+func (r *cffReader) encoding(offset int, bySID map[int]int, enc *[256]int) {
+	switch offset {
+	case 0:
+		for code, sid := range standardEncoding {
+			if sid != 0 {
+				enc[code] = bySID[sid]
+			}
+		}
+		return
+	case 1:
+		// The expert encoding is only used by expert fonts, which PDFs
+		// always give an explicit encoding
+		return
+	}
+	r.pos = offset
+	format := r.u8()
+	switch format & 0x7f {
+	case 0:
+		count := r.u8()
+		for gid := 1; gid <= count && !r.bad; gid++ {
+			enc[r.u8()] = gid
+		}
+	case 1:
+		ranges := r.u8()
+		gid := 1
+		for i := 0; i < ranges && !r.bad; i++ {
+			first, left := r.u8(), r.u8()
+			for k := 0; k <= left && first+k < 256; k++ {
+				enc[first+k] = gid
+				gid++
+			}
+		}
+	}
+	if format&0x80 != 0 {
+		sups := r.u8()
+		for i := 0; i < sups && !r.bad; i++ {
+			code, sid := r.u8(), r.u16()
+			enc[code] = bySID[sid]
+		}
+	}
+}
+
+// privateSubrs reads the local subroutines of the Private DICT a Top or
+// font DICT points to
+func (r *cffReader) privateSubrs(d cffDict) [][]byte {
+	p := d[18]
+	if len(p) < 2 {
+		return nil
+	}
+	size, offset := int(p[0]), int(p[1])
+	if offset <= 0 || size < 0 || offset+size > len(r.data) {
+		return nil
+	}
+	private := parseCFFDict(r.data[offset : offset+size])
+	if subrs := private.int(19, 0); subrs > 0 {
+		return r.indexAt(offset + subrs)
+	}
+	return nil
+}
+
+// fdSelect reads the font DICT of each glyph of a CID-keyed font
+func (r *cffReader) fdSelect(offset, n int) []int {
+	fds := make([]int, n)
+	if offset <= 0 {
+		return fds
+	}
+	r.pos = offset
+	switch r.u8() {
+	case 0:
+		for i := range fds {
+			fds[i] = r.u8()
+		}
+	case 3:
+		ranges := r.u16()
+		first := r.u16()
+		for i := 0; i < ranges && !r.bad; i++ {
+			fd := r.u8()
+			next := r.u16()
+			for gid := first; gid < next && gid < n; gid++ {
+				fds[gid] = fd
+			}
+			first = next
+		}
+	}
+	return fds
+}
+
+// glyph returns the outline of a glyph in glyph space
+func (c *cffFont) glyph(gid int) []segment {
+	return c.outline(gid, true)
+}
+
+// outline runs the charstring of a glyph. The parts of accented glyphs may
+// not be accented themselves.
+func (c *cffFont) outline(gid int, accented bool) []segment {
+	if gid < 0 || gid >= len(c.charStrings) {
+		return nil
+	}
+	subrs := c.subrs
+	if c.cidKeyed && gid < len(c.fdSelect) && c.fdSelect[gid] < len(c.fdSubrs) {
+		subrs = c.fdSubrs[c.fdSelect[gid]]
+	}
+	t := &type2Interp{font: c, subrs: subrs}
+	t.run(c.charStrings[gid], 0)
+	t.p.close()
+	if t.seac != nil {
+		if !accented {
+			return nil
+		}
+		return c.accented(t.seac)
+	}
+	return t.p.segs
+}
+
+// accented draws the base and accent glyphs of the seac form of endchar
+func (c *cffFont) accented(args []float64) []segment {
+	adx, ady, bchar, achar := args[0], args[1], int(args[2]), int(args[3])
+	if c.names == nil || bchar < 0 || bchar > 255 || achar < 0 || achar > 255 {
+		return nil
+	}
+	var p path
+	if gid, ok := c.names[cffStandardStrings[standardEncoding[bchar]]]; ok {
+		p.appendTransformed(c.outline(gid, false), pdfcontent.Identity)
+	}
+	if gid, ok := c.names[cffStandardStrings[standardEncoding[achar]]]; ok {
+		p.appendTransformed(c.outline(gid, false), pdfcontent.Matrix{1, 0, 0, 1, adx, ady})
+	}
+	return p.segs
+}
+
+// Subroutines may call each other, but not without limit
+const maxSubrDepth = 10
+
+// type2Interp runs Type 2 charstrings
+type type2Interp struct {
+	font      *cffFont
+	subrs     [][]byte
+	p         path
+	stack     []float64
+	stems     int
+	haveWidth bool
+	seac      []float64
+	ended     bool
+}
+
+func subrBias(n int) int {
+	switch {
+	case n < 1240:
+		return 107
+	case n < 33900:
+		return 1131
+	}
+	return 32768
+}
+
+// width drops the advance width that may precede the operands of the first
+// stack-clearing operator
+func (t *type2Interp) width(odd bool) {
+	if !t.haveWidth && odd && len(t.stack) > 0 {
+		t.stack = t.stack[1:]
+	}
+	t.haveWidth = true
+}
+
+func (t *type2Interp) rel(dx, dy float64) point {
+	return point{t.p.cur.x + dx, t.p.cur.y + dy}
+}
+
+func (t *type2Interp) moveTo(dx, dy float64) {
+	pt := t.rel(dx, dy)
+	t.p.close()
+	t.p.moveTo(pt)
+}
+
+func (t *type2Interp) lineTo(dx, dy float64) {
+	t.p.lineTo(t.rel(dx, dy))
+}
+
+func (t *type2Interp) curveTo(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	c1 := t.rel(dx1, dy1)
+	c2 := point{c1.x + dx2, c1.y + dy2}
+	t.p.cubeTo(c1, c2, point{c2.x + dx3, c2.y + dy3})
+}
+
+func (t *type2Interp) run(code []byte, depth int) {
+	if depth > maxSubrDepth {
+		return
+	}
+	for i := 0; i < len(code) && !t.ended; {
+		b := code[i]
+		i++
+		switch {
+		case b == 28:
+			if i+1 >= len(code) {
+				return
+			}
+			t.stack = append(t.stack, float64(int16(uint16(code[i])<<8|uint16(code[i+1]))))
+			i += 2
+			continue
+		case b >= 32 && b <= 246:
+			t.stack = append(t.stack, float64(int(b)-139))
+			continue
+		case b >= 247 && b <= 250:
+			if i >= len(code) {
+				return
+			}
+			t.stack = append(t.stack, float64((int(b)-247)*256+int(code[i])+108))
+			i++
+			continue
+		case b >= 251 && b <= 254:
+			if i >= len(code) {
+				return
+			}
+			t.stack = append(t.stack, float64(-(int(b)-251)*256-int(code[i])-108))
+			i++
+			continue
+		case b == 255:
+			if i+3 >= len(code) {
+				return
+			}
+			v := int32(uint32(code[i])<<24 | uint32(code[i+1])<<16 | uint32(code[i+2])<<8 | uint32(code[i+3]))
+			t.stack = append(t.stack, float64(v)/65536)
+			i += 4
+			continue
+		}
+
+		s := t.stack
+		switch b {
+		case 1, 3, 18, 23: // hstem, vstem, hstemhm, vstemhm
+			t.width(len(s)%2 == 1)
+			t.stems += len(t.stack) / 2
+		case 19, 20: // hintmask, cntrmask
+			t.width(len(s)%2 == 1)
+			t.stems += len(t.stack) / 2
+			i += (t.stems + 7) / 8
+		case 21: // rmoveto
+			t.width(len(s) > 2)
+			if s = t.stack; len(s) >= 2 {
+				t.moveTo(s[0], s[1])
+			}
+		case 22: // hmoveto
+			t.width(len(s) > 1)
+			if s = t.stack; len(s) >= 1 {
+				t.moveTo(s[0], 0)
+			}
+		case 4: // vmoveto
+			t.width(len(s) > 1)
+			if s = t.stack; len(s) >= 1 {
+				t.moveTo(0, s[0])
+			}
+		case 5: // rlineto
+			for ; len(s) >= 2; s = s[2:] {
+				t.lineTo(s[0], s[1])
+			}
+		case 6, 7: // hlineto, vlineto
+			horizontal := b == 6
+			for ; len(s) >= 1; s = s[1:] {
+				if horizontal {
+					t.lineTo(s[0], 0)
+				} else {
+					t.lineTo(0, s[0])
+				}
+				horizontal = !horizontal
+			}
+		case 8: // rrcurveto
+			for ; len(s) >= 6; s = s[6:] {
+				t.curveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+			}
+		case 24: // rcurveline
+			for ; len(s) >= 8; s = s[6:] {
+				t.curveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+			}
+			if len(s) >= 2 {
+				t.lineTo(s[0], s[1])
+			}
+		case 25: // rlinecurve
+			for ; len(s) >= 8; s = s[2:] {
+				t.lineTo(s[0], s[1])
+			}
+			if len(s) >= 6 {
+				t.curveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+			}
+		case 26: // vvcurveto
+			dx1 := 0.0
+			if len(s)%2 == 1 {
+				dx1, s = s[0], s[1:]
+			}
+			for ; len(s) >= 4; s = s[4:] {
+				t.curveTo(dx1, s[0], s[1], s[2], 0, s[3])
+				dx1 = 0
+			}
+		case 27: // hhcurveto
+			dy1 := 0.0
+			if len(s)%2 == 1 {
+				dy1, s = s[0], s[1:]
+			}
+			for ; len(s) >= 4; s = s[4:] {
+				t.curveTo(s[0], dy1, s[1], s[2], s[3], 0)
+				dy1 = 0
+			}
+		case 30, 31: // vhcurveto, hvcurveto
+			horizontal := b == 31
+			for ; len(s) >= 4; s = s[4:] {
+				last := 0.0
+				if len(s) == 5 {
+					last = s[4]
+				}
+				if horizontal {
+					t.curveTo(s[0], 0, s[1], s[2], last, s[3])
+				} else {
+					t.curveTo(0, s[0], s[1], s[2], s[3], last)
+				}
+				horizontal = !horizontal
+			}
+		case 10, 29: // callsubr, callgsubr
+			if len(s) == 0 {
+				return
+			}
+			subrs := t.subrs
+			if b == 29 {
+				subrs = t.font.gsubrs
+			}
+			n := int(s[len(s)-1]) + subrBias(len(subrs))
+			t.stack = s[:len(s)-1]
+			if n >= 0 && n < len(subrs) {
+				t.run(subrs[n], depth+1)
+			}
+			continue
+		case 11: // return
+			return
+		case 14: // endchar
+			t.width(len(s) == 1 || len(s) == 5)
+			if s = t.stack; len(s) >= 4 {
+				t.seac = append([]float64(nil), s[len(s)-4:]...)
+			}
+			t.ended = true
+			return
+		case 12:
+			if i >= len(code) {
+				return
+			}
+			esc := code[i]
+			i++
+			if t.arithmetic(esc) {
+				continue
+			}
+			t.flex(esc, s)
+		}
+		t.stack = t.stack[:0]
+	}
+}
+
+// arithmetic runs the escaped operators that work on the stack, reporting
+// whether esc was one of them
+func (t *type2Interp) arithmetic(esc byte) bool {
+	s := t.stack
+	n := len(s)
+	switch esc {
+	case 9: // abs
+		if n >= 1 {
+			s[n-1] = math.Abs(s[n-1])
+		}
+	case 10, 11, 12, 24: // add, sub, div, mul
+		if n < 2 {
+			return true
+		}
+		a, b := s[n-2], s[n-1]
+		switch esc {
+		case 10:
+			a += b
+		case 11:
+			a -= b
+		case 12:
+			if b != 0 {
+				a /= b
+			}
+		case 24:
+			a *= b
+		}
+		t.stack = append(s[:n-2], a)
+	case 14: // neg
+		if n >= 1 {
+			s[n-1] = -s[n-1]
+		}
+	case 18: // drop
+		if n >= 1 {
+			t.stack = s[:n-1]
+		}
+	case 27: // dup
+		if n >= 1 {
+			t.stack = append(s, s[n-1])
+		}
+	case 28: // exch
+		if n >= 2 {
+			s[n-2], s[n-1] = s[n-1], s[n-2]
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// flex draws the two curves of the flex operators
+func (t *type2Interp) flex(esc byte, s []float64) {
+	start := t.p.cur
+	switch esc {
+	case 35: // flex
+		if len(s) >= 12 {
+			t.curveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+			t.curveTo(s[6], s[7], s[8], s[9], s[10], s[11])
+		}
+	case 34: // hflex
+		if len(s) >= 7 {
+			t.curveTo(s[0], 0, s[1], s[2], s[3], 0)
+			t.curveTo(s[4], 0, s[5], start.y-t.p.cur.y, s[6], 0)
+		}
+	case 36: // hflex1
+		if len(s) >= 9 {
+			t.curveTo(s[0], s[1], s[2], s[3], s[4], 0)
+			t.curveTo(s[5], 0, s[6], s[7], s[8], start.y-(t.p.cur.y+s[7]))
+		}
+	case 37: // flex1
+		if len(s) >= 11 {
+			dx := s[0] + s[2] + s[4] + s[6] + s[8]
+			dy := s[1] + s[3] + s[5] + s[7] + s[9]
+			t.curveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+			if math.Abs(dx) > math.Abs(dy) {
+				t.curveTo(s[6], s[7], s[8], s[9], s[10], start.y-(t.p.cur.y+s[7]+s[9]))
+			} else {
+				t.curveTo(s[6], s[7], s[8], s[9], start.x-(t.p.cur.x+s[6]+s[8]), s[10])
+			}
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package pdfrender
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// colorSpace converts colour components to RGB
+type colorSpace interface {
+	components() int
+	rgb(c []float64) (r, g, b float64) // each 0..1
+	initial() []float64
+}
+
+type deviceGray struct{}
+
+func (deviceGray) components() int    { return 1 }
+func (deviceGray) initial() []float64 { return []float64{0} }
+func (deviceGray) rgb(c []float64) (float64, float64, float64) {
+	v := component(c, 0)
+	return v, v, v
+}
+
+type deviceRGB struct{}
+
+func (deviceRGB) components() int    { return 3 }
+func (deviceRGB) initial() []float64 { return []float64{0, 0, 0} }
+func (deviceRGB) rgb(c []float64) (float64, float64, float64) {
+	return component(c, 0), component(c, 1), component(c, 2)
+}
+
+type deviceCMYK struct{}
+
+func (deviceCMYK) components() int    { return 4 }
+func (deviceCMYK) initial() []float64 { return []float64{0, 0, 0, 1} }
+func (deviceCMYK) rgb(c []float64) (float64, float64, float64) {
+	k := component(c, 3)
+	return (1 - component(c, 0)) * (1 - k), (1 - component(c, 1)) * (1 - k), (1 - component(c, 2)) * (1 - k)
+}
+
+// indexedSpace maps indices into a palette of base colours
+type indexedSpace struct {
+	palette []color.NRGBA
+}
+
+func (s *indexedSpace) components() int    { return 1 }
+func (s *indexedSpace) initial() []float64 { return []float64{0} }
+func (s *indexedSpace) rgb(c []float64) (float64, float64, float64) {
+	i := int(component(c, 0) + 0.5)
+	if len(s.palette) == 0 {
+		return 0, 0, 0
+	}
+	p := s.palette[max(0, min(i, len(s.palette)-1))]
+	return float64(p.R) / 255, float64(p.G) / 255, float64(p.B) / 255
+}
+
+// tintSpace is a Separation or DeviceN colour space, shown through its
+// alternate space
+type tintSpace struct {
+	n    int
+	alt  colorSpace
+	tint function
+	none bool // the None separation, which paints nothing
+}
+
+func (s *tintSpace) components() int { return s.n }
+func (s *tintSpace) initial() []float64 {
+	c := make([]float64, s.n)
+	for i := range c {
+		c[i] = 1
+	}
+	return c
+}
+func (s *tintSpace) rgb(c []float64) (float64, float64, float64) {
+	if s.tint == nil || s.alt == nil {
+		v := 1 - component(c, 0)
+		return v, v, v
+	}
+	return s.alt.rgb(s.tint.eval(c))
+}
+
+// labSpace is CIE L*a*b* with a white point
+type labSpace struct {
+	white [3]float64
+}
+
+func (s *labSpace) components() int    { return 3 }
+func (s *labSpace) initial() []float64 { return []float64{0, 0, 0} }
+func (s *labSpace) rgb(c []float64) (float64, float64, float64) {
+	l, a, b := component100(c, 0), componentAny(c, 1), componentAny(c, 2)
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	g := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 108.0 / 841 * (t - 4.0/29)
+	}
+	x, y, z := s.white[0]*g(fx), s.white[1]*g(fy), s.white[2]*g(fz)
+	// XYZ to linear sRGB, then gamma
+	r := 3.2406*x - 1.5372*y - 0.4986*z
+	gr := -0.9689*x + 1.8758*y + 0.0415*z
+	bl := 0.0557*x - 0.2040*y + 1.0570*z
+	return gamma(r), gamma(gr), gamma(bl)
+}
+
+func gamma(v float64) float64 {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// patternSpace selects patterns; uncoloured patterns take their colour in
+// the underlying space
+type patternSpace struct {
+	base colorSpace
+}
+
+func (s *patternSpace) components() int {
+	if s.base == nil {
+		return 0
+	}
+	return s.base.components()
+}
+func (s *patternSpace) initial() []float64 { return nil }
+func (s *patternSpace) rgb(c []float64) (float64, float64, float64) {
+	if s.base == nil {
+		return 0, 0, 0
+	}
+	return s.base.rgb(c)
+}
+
+func component(c []float64, i int) float64 {
+	if i >= len(c) {
+		return 0
+	}
+	return math.Max(0, math.Min(1, c[i]))
+}
+
+func component100(c []float64, i int) float64 {
+	if i >= len(c) {
+		return 0
+	}
+	return math.Max(0, math.Min(100, c[i]))
+}
+
+func componentAny(c []float64, i int) float64 {
+	if i >= len(c) {
+		return 0
+	}
+	return c[i]
+}
+
+// toNRGBA converts components of a colour space with the given opacity
+func toNRGBA(cs colorSpace, c []float64, alpha float64) color.NRGBA {
+	r, g, b := cs.rgb(c)
+	return color.NRGBA{
+		R: uint8(math.Round(math.Max(0, math.Min(1, r)) * 255)),
+		G: uint8(math.Round(math.Max(0, math.Min(1, g)) * 255)),
+		B: uint8(math.Round(math.Max(0, math.Min(1, b)) * 255)),
+		A: uint8(math.Round(math.Max(0, math.Min(1, alpha)) * 255)),
+	}
+}
+
+// Colour space names usable without a resource
+var deviceSpaces = map[string]colorSpace{
+	"DeviceGray": deviceGray{}, "G": deviceGray{}, "CalGray": deviceGray{},
+	"DeviceRGB": deviceRGB{}, "RGB": deviceRGB{}, "CalRGB": deviceRGB{},
+	"DeviceCMYK": deviceCMYK{}, "CMYK": deviceCMYK{},
+}
+
+// loadColorSpace resolves a colour space name or array. Names other than
+// the device spaces are looked up in the resources.
+func (r *Renderer) loadColorSpace(o types.Object, resources types.Dict, depth int) colorSpace {
+	if depth > 8 {
+		return nil
+	}
+	if ref, ok := o.(types.IndirectRef); ok {
+		if cs, ok := r.spaces[ref.ObjectNumber.Value()]; ok {
+			return cs
+		}
+		cs := r.loadColorSpace(deref(r.xRefTable, ref), resources, depth+1)
+		r.spaces[ref.ObjectNumber.Value()] = cs
+		return cs
+	}
+
+	switch v := deref(r.xRefTable, o).(type) {
+	case types.Name:
+		if cs, ok := deviceSpaces[string(v)]; ok {
+			return cs
+		}
+		if v == "Pattern" {
+			return &patternSpace{}
+		}
+		if named, ok := deref(r.xRefTable, resources["ColorSpace"]).(types.Dict); ok {
+			if entry, ok := named[string(v)]; ok {
+				return r.loadColorSpace(entry, resources, depth+1)
+			}
+		}
+	case types.Array:
+		if len(v) == 0 {
+			return nil
+		}
+		name, _ := deref(r.xRefTable, v[0]).(types.Name)
+		switch name {
+		case "DeviceGray", "DeviceRGB", "DeviceCMYK", "CalGray", "CalRGB", "G", "RGB", "CMYK":
+			return deviceSpaces[string(name)]
+		case "ICCBased":
+			if len(v) < 2 {
+				return nil
+			}
+			sd, _, err := r.xRefTable.DereferenceStreamDict(v[1])
+			if err != nil || sd == nil {
+				return nil
+			}
+			if alt, ok := sd.Dict["Alternate"]; ok {
+				if cs := r.loadColorSpace(alt, resources, depth+1); cs != nil {
+					return cs
+				}
+			}
+			switch intValue(r.xRefTable, sd.Dict["N"], 3) {
+			case 1:
+				return deviceGray{}
+			case 4:
+				return deviceCMYK{}
+			}
+			return deviceRGB{}
+		case "Indexed", "I":
+			if len(v) < 4 {
+				return nil
+			}
+			base := r.loadColorSpace(v[1], resources, depth+1)
+			if base == nil {
+				return nil
+			}
+			lookup := lookupBytes(r.xRefTable, v[3])
+			n := base.components()
+			hival := intValue(r.xRefTable, v[2], 0)
+			s := &indexedSpace{}
+			c := make([]float64, n)
+			for i := 0; i <= hival && (i+1)*n <= len(lookup); i++ {
+				for k := range c {
+					c[k] = float64(lookup[i*n+k]) / 255
+				}
+				if _, isLab := base.(*labSpace); isLab {
+					c[0] *= 100
+					c[1], c[2] = c[1]*255-128, c[2]*255-128
+				}
+				s.palette = append(s.palette, toNRGBA(base, c, 1))
+			}
+			return s
+		case "Separation", "DeviceN":
+			if len(v) < 4 {
+				return nil
+			}
+			s := &tintSpace{n: 1, alt: r.loadColorSpace(v[2], resources, depth+1), tint: loadFunction(r.xRefTable, v[3])}
+			if name == "DeviceN" {
+				names, _ := deref(r.xRefTable, v[1]).(types.Array)
+				s.n = max(1, len(names))
+				s.none = len(names) > 0
+				for _, n := range names {
+					if n, _ := deref(r.xRefTable, n).(types.Name); n != "None" {
+						s.none = false
+					}
+				}
+			} else if n, _ := deref(r.xRefTable, v[1]).(types.Name); n == "None" {
+				s.none = true
+			}
+			return s
+		case "Lab":
+			s := &labSpace{white: [3]float64{0.9505, 1, 1.089}}
+			if len(v) > 1 {
+				if d, ok := deref(r.xRefTable, v[1]).(types.Dict); ok {
+					if wp := numberArray(r.xRefTable, d["WhitePoint"]); len(wp) == 3 {
+						copy(s.white[:], wp)
+					}
+				}
+			}
+			return s
+		case "Pattern":
+			s := &patternSpace{}
+			if len(v) > 1 {
+				s.base = r.loadColorSpace(v[1], resources, depth+1)
+			}
+			return s
+		}
+	}
+	return nil
+}
+
+// lookupBytes reads the palette of an indexed colour space
+func lookupBytes(xRefTable *model.XRefTable, o types.Object) []byte {
+	switch v := deref(xRefTable, o).(type) {
+	case types.StringLiteral:
+		b, _ := types.Unescape(v.Value())
+		return b
+	case types.HexLiteral:
+		b, _ := v.Bytes()
+		return b
+	case types.StreamDict:
+		if err := v.Decode(); err == nil {
+			return v.Content
+		}
+	}
+	return nil
+}
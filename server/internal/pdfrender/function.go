@@ -0,0 +1,517 @@
+package pdfrender
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// function is a PDF function, used by tint transforms and shadings
+type function interface {
+	eval(in []float64) []float64
+}
+
+// loadFunction reads a function dictionary or stream. An array of
+// functions with one output each acts as a single function.
+func loadFunction(xRefTable *model.XRefTable, o types.Object) function {
+	o = deref(xRefTable, o)
+	if a, ok := o.(types.Array); ok {
+		var fns multiFunction
+		for _, e := range a {
+			fn := loadFunction(xRefTable, e)
+			if fn == nil {
+				return nil
+			}
+			fns = append(fns, fn)
+		}
+		return fns
+	}
+
+	var d types.Dict
+	var sd *types.StreamDict
+	switch v := o.(type) {
+	case types.Dict:
+		d = v
+	case types.StreamDict:
+		d, sd = v.Dict, &v
+	default:
+		return nil
+	}
+
+	domain := numberArray(xRefTable, d["Domain"])
+	rng := numberArray(xRefTable, d["Range"])
+	switch intValue(xRefTable, d["FunctionType"], -1) {
+	case 0:
+		if sd == nil || sd.Decode() != nil {
+			return nil
+		}
+		return newSampledFunction(xRefTable, d, sd.Content, domain, rng)
+	case 2:
+		f := &expFunction{domain: domain, c0: []float64{0}, c1: []float64{1}, n: numberValue(xRefTable, d["N"], 1)}
+		if c := numberArray(xRefTable, d["C0"]); len(c) > 0 {
+			f.c0 = c
+		}
+		if c := numberArray(xRefTable, d["C1"]); len(c) > 0 {
+			f.c1 = c
+		}
+		if len(f.c1) != len(f.c0) {
+			return nil
+		}
+		return f
+	case 3:
+		f := &stitchFunction{domain: domain, bounds: numberArray(xRefTable, d["Bounds"]), encode: numberArray(xRefTable, d["Encode"])}
+		fns, _ := deref(xRefTable, d["Functions"]).(types.Array)
+		for _, e := range fns {
+			fn := loadFunction(xRefTable, e)
+			if fn == nil {
+				return nil
+			}
+			f.fns = append(f.fns, fn)
+		}
+		if len(f.fns) == 0 || len(f.bounds) != len(f.fns)-1 || len(f.encode) < 2*len(f.fns) || len(domain) < 2 {
+			return nil
+		}
+		return f
+	case 4:
+		if sd == nil || sd.Decode() != nil {
+			return nil
+		}
+		prog, _ := parseCalculator(calculatorTokens(sd.Content))
+		return &calcFunction{domain: domain, rng: rng, prog: prog}
+	}
+	return nil
+}
+
+// multiFunction combines functions of one output each
+type multiFunction []function
+
+func (f multiFunction) eval(in []float64) []float64 {
+	out := make([]float64, 0, len(f))
+	for _, fn := range f {
+		out = append(out, fn.eval(in)...)
+	}
+	return out
+}
+
+func clampDomain(x float64, domain []float64, i int) float64 {
+	if len(domain) < 2*i+2 {
+		return x
+	}
+	return math.Max(domain[2*i], math.Min(domain[2*i+1], x))
+}
+
+// expFunction is an exponential interpolation function (type 2)
+type expFunction struct {
+	domain, c0, c1 []float64
+	n              float64
+}
+
+func (f *expFunction) eval(in []float64) []float64 {
+	x := 0.0
+	if len(in) > 0 {
+		x = clampDomain(in[0], f.domain, 0)
+	}
+	xn := math.Pow(x, f.n)
+	out := make([]float64, len(f.c0))
+	for i := range out {
+		out[i] = f.c0[i] + xn*(f.c1[i]-f.c0[i])
+	}
+	return out
+}
+
+// stitchFunction combines 1-in functions on subdomains (type 3)
+type stitchFunction struct {
+	domain, bounds, encode []float64
+	fns                    []function
+}
+
+func (f *stitchFunction) eval(in []float64) []float64 {
+	x := 0.0
+	if len(in) > 0 {
+		x = clampDomain(in[0], f.domain, 0)
+	}
+	i := 0
+	for i < len(f.bounds) && x >= f.bounds[i] {
+		i++
+	}
+	lo, hi := f.domain[0], f.domain[1]
+	if i > 0 {
+		lo = f.bounds[i-1]
+	}
+	if i < len(f.bounds) {
+		hi = f.bounds[i]
+	}
+	return f.fns[i].eval([]float64{interpolate(x, lo, hi, f.encode[2*i], f.encode[2*i+1])})
+}
+
+func interpolate(x, xmin, xmax, ymin, ymax float64) float64 {
+	if xmax == xmin {
+		return ymin
+	}
+	return ymin + (x-xmin)*(ymax-ymin)/(xmax-xmin)
+}
+
+// sampledFunction interpolates a table of samples (type 0)
+type sampledFunction struct {
+	domain, rng, encode, decode []float64
+	size                        []int
+	samples                     []float64 // normalised to 0..1
+	outputs                     int
+}
+
+func newSampledFunction(xRefTable *model.XRefTable, d types.Dict, data []byte, domain, rng []float64) function {
+	f := &sampledFunction{domain: domain, rng: rng, outputs: len(rng) / 2}
+	for _, s := range numberArray(xRefTable, d["Size"]) {
+		f.size = append(f.size, int(s))
+	}
+	bps := intValue(xRefTable, d["BitsPerSample"], 8)
+	if len(f.size) == 0 || len(domain) < 2*len(f.size) || f.outputs == 0 || bps <= 0 || bps > 32 {
+		return nil
+	}
+	f.encode = numberArray(xRefTable, d["Encode"])
+	if len(f.encode) < 2*len(f.size) {
+		f.encode = nil
+		for _, s := range f.size {
+			f.encode = append(f.encode, 0, float64(s-1))
+		}
+	}
+	f.decode = numberArray(xRefTable, d["Decode"])
+	if len(f.decode) < len(rng) {
+		f.decode = rng
+	}
+
+	count := f.outputs
+	for _, s := range f.size {
+		if s <= 0 || count > 1<<24/s {
+			return nil
+		}
+		count *= s
+	}
+	bits := bitReader{data: data}
+	maxValue := math.Pow(2, float64(bps)) - 1
+	f.samples = make([]float64, count)
+	for i := range f.samples {
+		f.samples[i] = float64(bits.read(bps)) / maxValue
+	}
+	return f
+}
+
+func (f *sampledFunction) eval(in []float64) []float64 {
+	// Sample positions, interpolating linearly along the first input only
+	index, stride := 0, f.outputs
+	frac, next := 0.0, 0
+	for i, size := range f.size {
+		x := 0.0
+		if i < len(in) {
+			x = clampDomain(in[i], f.domain, i)
+		}
+		e := interpolate(x, f.domain[2*i], f.domain[2*i+1], f.encode[2*i], f.encode[2*i+1])
+		e = math.Max(0, math.Min(float64(size-1), e))
+		k := int(e)
+		if i == 0 {
+			frac = e - float64(k)
+			if k < size-1 {
+				next = stride
+			}
+		}
+		index += k * stride
+		stride *= size
+	}
+
+	out := make([]float64, f.outputs)
+	for j := range out {
+		v := f.samples[index+j]
+		if frac > 0 && next > 0 {
+			v += frac * (f.samples[index+next+j] - v)
+		}
+		v = interpolate(v, 0, 1, f.decode[2*j], f.decode[2*j+1])
+		out[j] = math.Max(f.rng[2*j], math.Min(f.rng[2*j+1], v))
+	}
+	return out
+}
+
+// bitReader reads big-endian values of up to 32 bits
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (b *bitReader) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		byteIndex := b.pos >> 3
+		bit := uint32(0)
+		if byteIndex < len(b.data) {
+			bit = uint32(b.data[byteIndex]>>(7-b.pos&7)) & 1
+		}
+		v = v<<1 | bit
+		b.pos++
+	}
+	return v
+}
+
+// alignByte moves to the start of the next byte, as image rows do
+func (b *bitReader) alignByte() {
+	b.pos = (b.pos + 7) &^ 7
+}
+
+// calcFunction runs a PostScript calculator program (type 4)
+type calcFunction struct {
+	domain, rng []float64
+	prog        []calcOp
+}
+
+// calcOp is a number, an operator or the branches of if and ifelse
+type calcOp struct {
+	op              string
+	value           float64
+	then, otherwise []calcOp
+}
+
+// parseCalculator reads a calculator program up to the brace closing it.
+// The program starts after the outermost opening brace.
+func parseCalculator(tokens []string) ([]calcOp, []string) {
+	var prog []calcOp
+	var blocks [][]calcOp
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		tokens = tokens[1:]
+		switch tok {
+		case "{":
+			var block []calcOp
+			block, tokens = parseCalculator(tokens)
+			blocks = append(blocks, block)
+			continue
+		case "}":
+			return prog, tokens
+		case "if":
+			if len(blocks) >= 1 {
+				prog = append(prog, calcOp{op: "if", then: blocks[len(blocks)-1]})
+			}
+		case "ifelse":
+			if len(blocks) >= 2 {
+				prog = append(prog, calcOp{op: "ifelse", then: blocks[len(blocks)-2], otherwise: blocks[len(blocks)-1]})
+			}
+		default:
+			if v, err := strconv.ParseFloat(tok, 64); err == nil {
+				prog = append(prog, calcOp{value: v})
+			} else {
+				prog = append(prog, calcOp{op: tok})
+			}
+		}
+		blocks = nil
+	}
+	return prog, nil
+}
+
+// calculatorTokens splits a calculator program into words and braces
+func calculatorTokens(data []byte) []string {
+	var tokens []string
+	start := -1
+	for i, c := range data {
+		space := isSpace(c)
+		if space || c == '{' || c == '}' {
+			if start >= 0 {
+				tokens = append(tokens, string(data[start:i]))
+				start = -1
+			}
+			if !space {
+				tokens = append(tokens, string(c))
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, string(data[start:]))
+	}
+	// Skip the opening brace of the program
+	for len(tokens) > 0 && tokens[0] != "{" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 {
+		tokens = tokens[1:]
+	}
+	return tokens
+}
+
+func (f *calcFunction) eval(in []float64) []float64 {
+	stack := make([]float64, 0, 16)
+	for i, x := range in {
+		stack = append(stack, clampDomain(x, f.domain, i))
+	}
+	stack = runCalculator(f.prog, stack, 0)
+	n := len(f.rng) / 2
+	out := make([]float64, n)
+	if len(stack) < n {
+		return out
+	}
+	for i := range out {
+		out[i] = math.Max(f.rng[2*i], math.Min(f.rng[2*i+1], stack[len(stack)-n+i]))
+	}
+	return out
+}
+
+func runCalculator(prog []calcOp, s []float64, depth int) []float64 {
+	if depth > 32 {
+		return s
+	}
+	pop := func() float64 {
+		if len(s) == 0 {
+			return 0
+		}
+		v := s[len(s)-1]
+		s = s[:len(s)-1]
+		return v
+	}
+	boolean := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	for _, op := range prog {
+		switch op.op {
+		case "":
+			s = append(s, op.value)
+		case "true", "false":
+			s = append(s, boolean(op.op == "true"))
+		case "if":
+			if pop() != 0 {
+				s = runCalculator(op.then, s, depth+1)
+			}
+		case "ifelse":
+			if pop() != 0 {
+				s = runCalculator(op.then, s, depth+1)
+			} else {
+				s = runCalculator(op.otherwise, s, depth+1)
+			}
+		case "abs":
+			s = append(s, math.Abs(pop()))
+		case "neg":
+			s = append(s, -pop())
+		case "ceiling":
+			s = append(s, math.Ceil(pop()))
+		case "floor":
+			s = append(s, math.Floor(pop()))
+		case "round":
+			s = append(s, math.Floor(pop()+0.5))
+		case "truncate", "cvi":
+			s = append(s, math.Trunc(pop()))
+		case "cvr":
+		case "sqrt":
+			s = append(s, math.Sqrt(math.Max(0, pop())))
+		case "sin":
+			s = append(s, math.Sin(pop()*math.Pi/180))
+		case "cos":
+			s = append(s, math.Cos(pop()*math.Pi/180))
+		case "ln":
+			s = append(s, math.Log(pop()))
+		case "log":
+			s = append(s, math.Log10(pop()))
+		case "not":
+			v := pop()
+			if v == 0 || v == 1 {
+				s = append(s, 1-v)
+			} else {
+				s = append(s, float64(^int64(v)))
+			}
+		case "dup":
+			v := pop()
+			s = append(s, v, v)
+		case "pop":
+			pop()
+		case "exch":
+			b, a := pop(), pop()
+			s = append(s, b, a)
+		case "copy":
+			n := int(pop())
+			if n > 0 && n <= len(s) {
+				s = append(s, s[len(s)-n:]...)
+			}
+		case "index":
+			n := int(pop())
+			if n >= 0 && n < len(s) {
+				s = append(s, s[len(s)-1-n])
+			}
+		case "roll":
+			j, n := int(pop()), int(pop())
+			if n > 0 && n <= len(s) {
+				part := append([]float64(nil), s[len(s)-n:]...)
+				for i := range part {
+					s[len(s)-n+((i+j)%n+n)%n] = part[i]
+				}
+			}
+		default:
+			b, a := pop(), pop()
+			s = append(s, calcBinary(op.op, a, b))
+		}
+	}
+	return s
+}
+
+func calcBinary(op string, a, b float64) float64 {
+	boolean := func(v bool) float64 {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "add":
+		return a + b
+	case "sub":
+		return a - b
+	case "mul":
+		return a * b
+	case "div":
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	case "idiv":
+		if int64(b) == 0 {
+			return 0
+		}
+		return float64(int64(a) / int64(b))
+	case "mod":
+		if int64(b) == 0 {
+			return 0
+		}
+		return float64(int64(a) % int64(b))
+	case "exp":
+		return math.Pow(a, b)
+	case "atan":
+		v := math.Atan2(a, b) * 180 / math.Pi
+		if v < 0 {
+			v += 360
+		}
+		return v
+	case "eq":
+		return boolean(a == b)
+	case "ne":
+		return boolean(a != b)
+	case "gt":
+		return boolean(a > b)
+	case "ge":
+		return boolean(a >= b)
+	case "lt":
+		return boolean(a < b)
+	case "le":
+		return boolean(a <= b)
+	case "and":
+		return float64(int64(a) & int64(b))
+	case "or":
+		return float64(int64(a) | int64(b))
+	case "xor":
+		return float64(int64(a) ^ int64(b))
+	case "bitshift":
+		if b >= 0 {
+			return float64(int64(a) << uint(b))
+		}
+		return float64(int64(a) >> uint(-b))
+	}
+	return 0
+}
@@ -0,0 +1,505 @@
+package pdfrender
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+
+	"file-conv/internal/pdfcontent"
+
+	"github.com/nfnt/resize"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+var errUnsupportedImage = errors.New("unsupported image encoding")
+
+// Largest image, in pixels, that is decoded
+const maxImagePixels = 1 << 26
+
+// decodeImage decodes an image XObject or inline image into colours with
+// opacity. Image masks decode into the coverage they paint with the fill
+// colour and report stencil.
+func (r *Renderer) decodeImage(sd *types.StreamDict, resources types.Dict) (img image.Image, stencil bool, err error) {
+	d := sd.Dict
+	w, h := intValue(r.xRefTable, d["Width"], 0), intValue(r.xRefTable, d["Height"], 0)
+	if w <= 0 || h <= 0 || w*h > maxImagePixels {
+		return nil, false, fmt.Errorf("invalid image size %dx%d", w, h)
+	}
+	decode := numberArray(r.xRefTable, d["Decode"])
+
+	if boolValue(r.xRefTable, d["ImageMask"]) {
+		mask, err := r.decodeMask(sd, w, h, decode)
+		return mask, true, err
+	}
+
+	cs := r.loadColorSpace(d["ColorSpace"], resources, 0)
+	colors, err := r.decodeColors(sd, w, h, cs, decode)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Soft masks give the opacity, stencil masks and colour key ranges
+	// cut out parts of the image
+	switch m := deref(r.xRefTable, d["Mask"]).(type) {
+	case types.StreamDict:
+		mw, mh := intValue(r.xRefTable, m.Dict["Width"], 0), intValue(r.xRefTable, m.Dict["Height"], 0)
+		if mw > 0 && mh > 0 && mw*mh <= maxImagePixels {
+			if mask, err := r.decodeMask(&m, mw, mh, numberArray(r.xRefTable, m.Dict["Decode"])); err == nil {
+				applyAlpha(colors, mask)
+			}
+		}
+	case types.Array:
+		if ranges := numberArray(r.xRefTable, m); len(ranges) > 0 {
+			r.applyColorKey(sd, colors, ranges)
+		}
+	}
+	if smask, _, err := r.xRefTable.DereferenceStreamDict(d["SMask"]); err == nil && smask != nil {
+		sw, sh := intValue(r.xRefTable, smask.Dict["Width"], 0), intValue(r.xRefTable, smask.Dict["Height"], 0)
+		if sw > 0 && sh > 0 && sw*sh <= maxImagePixels {
+			if alpha, err := r.decodeColors(smask, sw, sh, deviceGray{}, numberArray(r.xRefTable, smask.Dict["Decode"])); err == nil {
+				applyAlpha(colors, toGray(alpha))
+			}
+		}
+	}
+	return colors, false, nil
+}
+
+// imageData returns the decoded samples of an image, or a decoded JPEG
+func imageData(sd *types.StreamDict) ([]byte, image.Image, error) {
+	fpl := sd.FilterPipeline
+	if len(fpl) > 0 {
+		switch fpl[len(fpl)-1].Name {
+		case filter.JPX, filter.JBIG2:
+			return nil, nil, errUnsupportedImage
+		case filter.DCT:
+			// pdfcpu stops decoding at the DCT filter
+			if err := sd.Decode(); err != nil {
+				return nil, nil, err
+			}
+			img, err := jpeg.Decode(bytes.NewReader(sd.Content))
+			return nil, img, err
+		}
+	}
+	if err := sd.Decode(); err != nil {
+		return nil, nil, err
+	}
+	return sd.Content, nil, nil
+}
+
+// decodeColors decodes the samples of an image in colour space cs
+func (r *Renderer) decodeColors(sd *types.StreamDict, w, h int, cs colorSpace, decode []float64) (*image.NRGBA, error) {
+	data, jpg, err := imageData(sd)
+	if err != nil {
+		return nil, err
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if jpg != nil {
+		return jpegColors(jpg, out, decode), nil
+	}
+	if cs == nil {
+		cs = deviceGray{}
+	}
+
+	n := cs.components()
+	bpc := intValue(r.xRefTable, sd.Dict["BitsPerComponent"], 8)
+	if n <= 0 || (bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8 && bpc != 16) {
+		return nil, errUnsupportedImage
+	}
+	maxValue := float64(int(1)<<bpc - 1)
+
+	// Decode maps sample values onto component values
+	_, indexed := cs.(*indexedSpace)
+	if len(decode) < 2*n {
+		decode = make([]float64, 0, 2*n)
+		for i := 0; i < n; i++ {
+			if indexed {
+				decode = append(decode, 0, maxValue)
+			} else {
+				decode = append(decode, 0, 1)
+			}
+		}
+	}
+
+	// Fast path for 8-bit device colours
+	if bpc == 8 && isDefaultDecode(decode, n) {
+		if rowLen := w * n; len(data) >= rowLen*h {
+			switch cs.(type) {
+			case deviceGray:
+				for i := 0; i < w*h; i++ {
+					v := data[i]
+					copy(out.Pix[i*4:], []uint8{v, v, v, 0xff})
+				}
+				return out, nil
+			case deviceRGB:
+				for i := 0; i < w*h; i++ {
+					copy(out.Pix[i*4:], data[i*3:i*3+3])
+					out.Pix[i*4+3] = 0xff
+				}
+				return out, nil
+			}
+		}
+	}
+
+	// Colours of 1-component images are looked up by sample value
+	var lut []color.NRGBA
+	if n == 1 && bpc <= 8 {
+		lut = make([]color.NRGBA, 1<<bpc)
+		for v := range lut {
+			lut[v] = toNRGBA(cs, []float64{interpolate(float64(v), 0, maxValue, decode[0], decode[1])}, 1)
+		}
+	}
+	cache := map[uint64]color.NRGBA{}
+
+	bits := bitReader{data: data}
+	samples := make([]uint32, n)
+	comps := make([]float64, n)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var key uint64
+			for k := range samples {
+				samples[k] = bits.read(bpc)
+				key = key<<bpc | uint64(samples[k])
+			}
+			var c color.NRGBA
+			if lut != nil {
+				c = lut[samples[0]]
+			} else if cached, ok := cache[key]; ok && n*bpc <= 64 {
+				c = cached
+			} else {
+				for k := range comps {
+					comps[k] = interpolate(float64(samples[k]), 0, maxValue, decode[2*k], decode[2*k+1])
+				}
+				c = toNRGBA(cs, comps, 1)
+				if len(cache) < 1<<16 {
+					cache[key] = c
+				}
+			}
+			i := out.PixOffset(x, y)
+			out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		bits.alignByte()
+	}
+	return out, nil
+}
+
+func isDefaultDecode(decode []float64, n int) bool {
+	for i := 0; i < n; i++ {
+		if decode[2*i] != 0 || decode[2*i+1] != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// jpegColors converts a decoded JPEG, inverting components when the Decode
+// array asks for it, as CMYK JPEGs from Photoshop do
+func jpegColors(img image.Image, out *image.NRGBA, decode []float64) *image.NRGBA {
+	inverted := len(decode) >= 2 && decode[0] == 1 && decode[1] == 0
+	b := img.Bounds()
+	for y := 0; y < out.Rect.Dy() && y < b.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx() && x < b.Dx(); x++ {
+			var c color.NRGBA
+			switch v := img.At(b.Min.X+x, b.Min.Y+y).(type) {
+			case color.CMYK:
+				if inverted {
+					v = color.CMYK{C: 255 - v.C, M: 255 - v.M, Y: 255 - v.Y, K: 255 - v.K}
+				}
+				cr, cg, cb := color.CMYKToRGB(v.C, v.M, v.Y, v.K)
+				c = color.NRGBA{cr, cg, cb, 0xff}
+			default:
+				c = color.NRGBAModel.Convert(v).(color.NRGBA)
+				if inverted {
+					c.R, c.G, c.B = 255-c.R, 255-c.G, 255-c.B
+				}
+			}
+			i := out.PixOffset(x, y)
+			out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = c.R, c.G, c.B, 0xff
+		}
+	}
+	return out
+}
+
+// decodeMask decodes a 1-bit stencil mask into the coverage it paints:
+// samples of 0 paint unless the Decode array inverts them
+func (r *Renderer) decodeMask(sd *types.StreamDict, w, h int, decode []float64) (*image.Gray, error) {
+	data, jpg, err := imageData(sd)
+	if err != nil {
+		return nil, err
+	}
+	if jpg != nil {
+		return nil, errUnsupportedImage
+	}
+	paint := uint32(0)
+	if len(decode) >= 2 && decode[0] == 1 {
+		paint = 1
+	}
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	bits := bitReader{data: data}
+	for y := 0; y < h; y++ {
+		row := mask.Pix[y*mask.Stride:]
+		for x := 0; x < w; x++ {
+			if bits.read(1) == paint {
+				row[x] = 0xff
+			}
+		}
+		bits.alignByte()
+	}
+	return mask, nil
+}
+
+// applyColorKey makes transparent the pixels whose samples all fall within
+// the ranges of a colour key mask
+func (r *Renderer) applyColorKey(sd *types.StreamDict, img *image.NRGBA, ranges []float64) {
+	bpc := intValue(r.xRefTable, sd.Dict["BitsPerComponent"], 8)
+	n := len(ranges) / 2
+	fpl := sd.FilterPipeline
+	if sd.Content == nil || bpc > 16 || n == 0 || len(fpl) > 0 && fpl[len(fpl)-1].Name == filter.DCT {
+		return
+	}
+	bits := bitReader{data: sd.Content}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			masked := true
+			for k := 0; k < n; k++ {
+				v := float64(bits.read(bpc))
+				if v < ranges[2*k] || v > ranges[2*k+1] {
+					masked = false
+				}
+			}
+			if masked {
+				img.Pix[img.PixOffset(x, y)+3] = 0
+			}
+		}
+		bits.alignByte()
+	}
+}
+
+func toGray(img *image.NRGBA) *image.Gray {
+	g := image.NewGray(img.Rect)
+	for i := range g.Pix {
+		g.Pix[i] = img.Pix[i*4]
+	}
+	return g
+}
+
+// applyAlpha multiplies the opacity of img by a mask, which is stretched to
+// the size of the image
+func applyAlpha(img *image.NRGBA, mask *image.Gray) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	mw, mh := mask.Rect.Dx(), mask.Rect.Dy()
+	for y := 0; y < h; y++ {
+		my := y * mh / h
+		for x := 0; x < w; x++ {
+			m := uint16(mask.Pix[my*mask.Stride+x*mw/w])
+			i := img.PixOffset(x, y) + 3
+			img.Pix[i] = uint8((uint16(img.Pix[i])*m + 127) / 255)
+		}
+	}
+}
+
+// drawImage paints an image filling the unit square of user space
+func (in *interp) drawImage(sd *types.StreamDict) {
+	img, stencil, err := in.r.decodeImage(sd, in.resources)
+	if err != nil {
+		return
+	}
+	m := in.gs.ctm
+	inv, ok := invert(m)
+	if !ok {
+		return
+	}
+
+	var polys []polyline
+	corners := []point{apply(m, point{0, 0}), apply(m, point{1, 0}), apply(m, point{1, 1}), apply(m, point{0, 1})}
+	polys = append(polys, polyline{pts: corners, closed: true})
+	area := in.clipped(rasterize(polys, false, in.bounds))
+	if area == nil {
+		return
+	}
+
+	// Images much larger than their size on the page are scaled down
+	// first, so that sampling them does not alias
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := math.Hypot(m[0], m[1]), math.Hypot(m[2], m[3])
+	if nw, nh := min(w, int(math.Ceil(dw))), min(h, int(math.Ceil(dh))); nw < w*2/3 || nh < h*2/3 {
+		img = resize.Resize(uint(max(1, nw)), uint(max(1, nh)), img, resize.Bilinear)
+		w, h = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+	smooth := dw > float64(w)*1.5 || dh > float64(h)*1.5
+
+	var fill color.NRGBA
+	if stencil {
+		fill = in.solidColor(in.gs.fill, in.gs.fillAlpha)
+		if fill.A == 0 {
+			return
+		}
+	}
+	alpha := in.gs.fillAlpha
+
+	r := area.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cover := area.Pix[area.PixOffset(x, y)]
+			if cover == 0 {
+				continue
+			}
+			p := apply(inv, point{float64(x) + 0.5, float64(y) + 0.5})
+			sx, sy := p.x*float64(w), (1-p.y)*float64(h)
+			var c color.NRGBA
+			if stencil {
+				v := sample(img, sx, sy, smooth)
+				c = fill
+				c.A = uint8(uint32(c.A) * uint32(v.A) / 255)
+			} else {
+				c = sample(img, sx, sy, smooth)
+				c.A = uint8(float64(c.A) * alpha)
+			}
+			blend(in.canvas, x, y, c, cover)
+		}
+	}
+}
+
+// sample returns the colour at a position in image pixels. Stencil masks
+// report their coverage as opacity.
+func sample(img image.Image, sx, sy float64, smooth bool) color.NRGBA {
+	b := img.Bounds()
+	at := func(x, y int) color.NRGBA {
+		x = max(0, min(x, b.Dx()-1))
+		y = max(0, min(y, b.Dy()-1))
+		switch v := img.(type) {
+		case *image.NRGBA:
+			i := v.PixOffset(b.Min.X+x, b.Min.Y+y)
+			return color.NRGBA{v.Pix[i], v.Pix[i+1], v.Pix[i+2], v.Pix[i+3]}
+		case *image.Gray:
+			return color.NRGBA{A: v.Pix[v.PixOffset(b.Min.X+x, b.Min.Y+y)]}
+		}
+		return color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+	}
+	if !smooth {
+		return at(int(math.Floor(sx)), int(math.Floor(sy)))
+	}
+
+	// Bilinear interpolation between pixel centres
+	fx, fy := sx-0.5, sy-0.5
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+	c00, c10, c01, c11 := at(x0, y0), at(x0+1, y0), at(x0, y0+1), at(x0+1, y0+1)
+	mix := func(a, b, c, d uint8) uint8 {
+		top := float64(a) + tx*(float64(b)-float64(a))
+		bottom := float64(c) + tx*(float64(d)-float64(c))
+		return uint8(top + ty*(bottom-top) + 0.5)
+	}
+	return color.NRGBA{
+		mix(c00.R, c10.R, c01.R, c11.R),
+		mix(c00.G, c10.G, c01.G, c11.G),
+		mix(c00.B, c10.B, c01.B, c11.B),
+		mix(c00.A, c10.A, c01.A, c11.A),
+	}
+}
+
+// blend composites a colour over a canvas pixel with the given coverage
+func blend(dst *image.RGBA, x, y int, c color.NRGBA, cover uint8) {
+	a := uint32(c.A) * uint32(cover) / 255
+	if a == 0 {
+		return
+	}
+	i := dst.PixOffset(x, y)
+	p := dst.Pix[i : i+4 : i+4]
+	p[0] = uint8((uint32(c.R)*a + uint32(p[0])*(255-a)) / 255)
+	p[1] = uint8((uint32(c.G)*a + uint32(p[1])*(255-a)) / 255)
+	p[2] = uint8((uint32(c.B)*a + uint32(p[2])*(255-a)) / 255)
+	p[3] = uint8(a + uint32(p[3])*(255-a)/255)
+}
+
+// Abbreviations of inline image keys and values
+var inlineImageKeys = map[string]string{
+	"BPC": "BitsPerComponent", "CS": "ColorSpace", "D": "Decode", "DP": "DecodeParms",
+	"F": "Filter", "H": "Height", "IM": "ImageMask", "I": "Interpolate", "W": "Width", "L": "Length",
+}
+
+var inlineImageNames = map[string]string{
+	"G": "DeviceGray", "RGB": "DeviceRGB", "CMYK": "DeviceCMYK", "I": "Indexed",
+	"AHx": filter.ASCIIHex, "A85": filter.ASCII85, "LZW": filter.LZW, "Fl": filter.Flate,
+	"RL": filter.RunLength, "CCF": filter.CCITTFax, "DCT": filter.DCT,
+}
+
+// inlineImage turns the dictionary and data of an inline image into a
+// stream that decodes like an image XObject
+func inlineImage(dict map[pdfcontent.Name]pdfcontent.Object, data pdfcontent.String) *types.StreamDict {
+	d := types.Dict{}
+	for k, v := range dict {
+		key := string(k)
+		if full, ok := inlineImageKeys[key]; ok {
+			key = full
+		}
+		d[key] = toPDFObject(v, key == "Filter" || key == "ColorSpace")
+	}
+
+	var fpl []types.PDFFilter
+	parms := []types.Object{d["DecodeParms"]}
+	if a, ok := d["DecodeParms"].(types.Array); ok {
+		parms = a
+	}
+	addFilter := func(i int, name types.Name) {
+		f := types.PDFFilter{Name: string(name)}
+		if i < len(parms) {
+			f.DecodeParms, _ = parms[i].(types.Dict)
+		}
+		fpl = append(fpl, f)
+	}
+	switch f := d["Filter"].(type) {
+	case types.Name:
+		addFilter(0, f)
+	case types.Array:
+		for i, o := range f {
+			if name, ok := o.(types.Name); ok {
+				addFilter(i, name)
+			}
+		}
+	}
+
+	sd := types.NewStreamDict(d, 0, nil, nil, fpl)
+	sd.Raw = data
+	return &sd
+}
+
+// toPDFObject converts a content stream operand into a pdfcpu object.
+// Names are expanded from their inline image abbreviations when expand is
+// set.
+func toPDFObject(o pdfcontent.Object, expand bool) types.Object {
+	switch v := o.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<31 {
+			return types.Integer(int(v))
+		}
+		return types.Float(v)
+	case bool:
+		return types.Boolean(v)
+	case pdfcontent.Name:
+		if full, ok := inlineImageNames[string(v)]; ok && expand {
+			return types.Name(full)
+		}
+		return types.Name(v)
+	case pdfcontent.String:
+		return types.HexLiteral(fmt.Sprintf("%X", []byte(v)))
+	case []pdfcontent.Object:
+		a := make(types.Array, len(v))
+		for i, e := range v {
+			a[i] = toPDFObject(e, expand)
+		}
+		return a
+	case map[pdfcontent.Name]pdfcontent.Object:
+		d := types.Dict{}
+		for k, e := range v {
+			d[string(k)] = toPDFObject(e, false)
+		}
+		return d
+	}
+	return nil
+}
@@ -0,0 +1,599 @@
+package pdfrender
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"file-conv/internal/pdfcontent"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Forms, patterns and Type 3 glyphs may nest, but not without limit
+const maxDepth = 12
+
+// paint is a fill or stroke colour, or a pattern
+type paint struct {
+	space   colorSpace
+	comps   []float64
+	pattern types.Object // pattern dictionary of the Pattern colour space
+}
+
+// graphicsState holds the parameters saved by q and restored by Q
+type graphicsState struct {
+	ctm          pdfcontent.Matrix
+	clip         *image.Alpha // nil clips nothing
+	fill, stroke paint
+
+	fillAlpha, strokeAlpha float64
+
+	lineWidth         float64
+	lineCap, lineJoin int
+	miterLimit        float64
+	dash              []float64
+	dashPhase         float64
+
+	text    pdfcontent.TextState
+	fontObj types.Object
+	render  int // text rendering mode
+}
+
+func defaultState(ctm pdfcontent.Matrix) graphicsState {
+	black := paint{space: deviceGray{}, comps: []float64{0}}
+	return graphicsState{
+		ctm:         ctm,
+		fill:        black,
+		stroke:      black,
+		fillAlpha:   1,
+		strokeAlpha: 1,
+		lineWidth:   1,
+		miterLimit:  10,
+		text:        pdfcontent.TextState{Scale: 1},
+	}
+}
+
+// interp runs content streams onto a canvas
+type interp struct {
+	r      *Renderer
+	canvas *image.RGBA
+	bounds image.Rectangle
+	base   pdfcontent.Matrix // pattern space of the content being run
+
+	gs        graphicsState
+	stack     []graphicsState
+	resources types.Dict
+	depth     int
+	uncolored bool // colours are given from outside: uncoloured patterns and d1 glyphs
+
+	path     path
+	clipRule int // clipping pending for the path being built
+
+	tm, tlm      pdfcontent.Matrix
+	textClip     []polyline
+	textClipping bool
+}
+
+// Pending clipping of the current path
+const (
+	clipNone = iota
+	clipNonZero
+	clipEvenOdd
+)
+
+func (r *Renderer) newInterp(canvas *image.RGBA, base pdfcontent.Matrix) *interp {
+	return &interp{
+		r:      r,
+		canvas: canvas,
+		bounds: canvas.Bounds(),
+		base:   base,
+		gs:     defaultState(base),
+	}
+}
+
+// sub returns an interpreter for another canvas one level deeper, such as
+// the cell of a tiling pattern
+func (in *interp) sub(canvas *image.RGBA, base pdfcontent.Matrix) *interp {
+	s := in.r.newInterp(canvas, base)
+	s.depth = in.depth + 1
+	return s
+}
+
+// runNested runs the content of a form or glyph with its own transformation
+// and restores the interpreter afterwards
+func (in *interp) runNested(content []byte, resources types.Dict, ctm pdfcontent.Matrix) {
+	if in.depth >= maxDepth {
+		return
+	}
+	saved := *in
+	in.gs.ctm, in.base = ctm, ctm
+	in.stack = nil
+	in.path = path{}
+	in.clipRule = clipNone
+	in.depth++
+	in.run(content, resources)
+	*in = saved
+}
+
+// clipped limits a coverage mask to the clipping path; nil means nothing
+// is covered
+func (in *interp) clipped(mask *image.Alpha) *image.Alpha {
+	if mask == nil {
+		return nil
+	}
+	if in.gs.clip == nil {
+		return mask
+	}
+	mask = intersectMasks(mask, in.gs.clip)
+	if mask.Rect.Empty() {
+		return nil
+	}
+	return mask
+}
+
+// solidColor returns the colour of a paint that is not a pattern
+func (in *interp) solidColor(p paint, alpha float64) color.NRGBA {
+	if p.space == nil {
+		return color.NRGBA{A: uint8(math.Round(alpha * 255))}
+	}
+	if t, ok := p.space.(*tintSpace); ok && t.none {
+		return color.NRGBA{}
+	}
+	return toNRGBA(p.space, p.comps, alpha)
+}
+
+// paintMask paints the covered pixels of mask
+func (in *interp) paintMask(p paint, mask *image.Alpha, alpha float64) {
+	if mask == nil || alpha <= 0 {
+		return
+	}
+	if _, ok := p.space.(*patternSpace); ok && p.pattern != nil {
+		in.paintPattern(p, mask, alpha)
+		return
+	}
+	c := in.solidColor(p, alpha)
+	if c.A == 0 {
+		return
+	}
+	r := mask.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := mask.Pix[mask.PixOffset(r.Min.X, y):]
+		for x := 0; x < r.Dx(); x++ {
+			if cover := row[x]; cover != 0 {
+				blend(in.canvas, r.Min.X+x, y, c, cover)
+			}
+		}
+	}
+}
+
+// fill paints the inside of polygons with the fill paint
+func (in *interp) fill(polys []polyline, evenOdd bool) {
+	in.paintMask(in.gs.fill, in.clipped(rasterize(polys, evenOdd, in.bounds)), in.gs.fillAlpha)
+}
+
+// strokeLines paints lines with the stroke paint and line parameters
+func (in *interp) strokeLines(lines []polyline) {
+	polys := stroke(lines, in.strokeStyle())
+	in.paintMask(in.gs.stroke, in.clipped(rasterize(polys, false, in.bounds)), in.gs.strokeAlpha)
+}
+
+// strokeStyle scales the line parameters to device pixels. Lines are never
+// thinner than a pixel.
+func (in *interp) strokeStyle() strokeStyle {
+	m := in.gs.ctm
+	scale := math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+	style := strokeStyle{
+		width:      math.Max(1, in.gs.lineWidth*scale),
+		cap:        in.gs.lineCap,
+		join:       in.gs.lineJoin,
+		miterLimit: in.gs.miterLimit,
+		phase:      in.gs.dashPhase * scale,
+	}
+	total := 0.0
+	for _, d := range in.gs.dash {
+		style.dash = append(style.dash, d*scale)
+		total += d
+	}
+	if total <= 0 {
+		style.dash = nil
+	}
+	return style
+}
+
+// paintPath paints the current path, applies pending clipping and ends
+// the path
+func (in *interp) paintPath(close, fill, evenOdd, strokePath bool) {
+	if close {
+		in.path.close()
+	}
+	lines := in.path.flatten()
+	if fill {
+		in.fill(lines, evenOdd)
+	}
+	if strokePath {
+		in.strokeLines(lines)
+	}
+	if in.clipRule != clipNone {
+		mask := rasterize(lines, in.clipRule == clipEvenOdd, in.bounds)
+		if mask == nil {
+			mask = emptyMask()
+		}
+		in.gs.clip = intersectMasks(in.gs.clip, mask)
+		in.clipRule = clipNone
+	}
+	in.path.reset()
+}
+
+// point returns the device position of two operands
+func (in *interp) point(args []pdfcontent.Object, i int) point {
+	return apply(in.gs.ctm, point{operand(args, i), operand(args, i+1)})
+}
+
+func operand(args []pdfcontent.Object, i int) float64 {
+	if i < len(args) {
+		if v, ok := args[i].(float64); ok {
+			return v
+		}
+	}
+	return 0
+}
+
+func operandNumbers(args []pdfcontent.Object) []float64 {
+	var out []float64
+	for _, a := range args {
+		if v, ok := a.(float64); ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func lastName(args []pdfcontent.Object) (pdfcontent.Name, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	name, ok := args[len(args)-1].(pdfcontent.Name)
+	return name, ok
+}
+
+// resource returns the named entry of a resource category
+func (in *interp) resource(category string, name pdfcontent.Name) types.Object {
+	d, ok := deref(in.r.xRefTable, in.resources[category]).(types.Dict)
+	if !ok {
+		return nil
+	}
+	return d[string(name)]
+}
+
+// run interprets a content stream
+func (in *interp) run(content []byte, resources types.Dict) {
+	in.resources = resources
+	for _, op := range pdfcontent.Parse(content) {
+		in.do(op.Operator, op.Operands)
+	}
+}
+
+func (in *interp) do(operator string, args []pdfcontent.Object) {
+	gs := &in.gs
+	switch operator {
+	case "q":
+		in.stack = append(in.stack, *gs)
+	case "Q":
+		if n := len(in.stack); n > 0 {
+			*gs = in.stack[n-1]
+			in.stack = in.stack[:n-1]
+		}
+	case "cm":
+		if m, ok := pdfcontent.MatrixFrom(args); ok {
+			gs.ctm = m.Multiply(gs.ctm)
+		}
+	case "w":
+		gs.lineWidth = operand(args, 0)
+	case "J":
+		gs.lineCap = int(operand(args, 0))
+	case "j":
+		gs.lineJoin = int(operand(args, 0))
+	case "M":
+		gs.miterLimit = operand(args, 0)
+	case "d":
+		if len(args) >= 2 {
+			a, _ := args[0].([]pdfcontent.Object)
+			gs.dash = operandNumbers(a)
+			gs.dashPhase = operand(args, 1)
+		}
+	case "gs":
+		if name, ok := lastName(args); ok {
+			in.extGState(in.resource("ExtGState", name))
+		}
+
+	case "m":
+		in.path.moveTo(in.point(args, 0))
+	case "l":
+		in.path.lineTo(in.point(args, 0))
+	case "c":
+		in.path.cubeTo(in.point(args, 0), in.point(args, 2), in.point(args, 4))
+	case "v":
+		in.path.cubeTo(in.path.cur, in.point(args, 0), in.point(args, 2))
+	case "y":
+		end := in.point(args, 2)
+		in.path.cubeTo(in.point(args, 0), end, end)
+	case "h":
+		in.path.close()
+	case "re":
+		in.path.rect(operand(args, 0), operand(args, 1), operand(args, 2), operand(args, 3), gs.ctm)
+
+	case "S":
+		in.paintPath(false, false, false, true)
+	case "s":
+		in.paintPath(true, false, false, true)
+	case "f", "F":
+		in.paintPath(false, true, false, false)
+	case "f*":
+		in.paintPath(false, true, true, false)
+	case "B":
+		in.paintPath(false, true, false, true)
+	case "B*":
+		in.paintPath(false, true, true, true)
+	case "b":
+		in.paintPath(true, true, false, true)
+	case "b*":
+		in.paintPath(true, true, true, true)
+	case "n":
+		in.paintPath(false, false, false, false)
+	case "W":
+		in.clipRule = clipNonZero
+	case "W*":
+		in.clipRule = clipEvenOdd
+
+	case "CS", "cs":
+		if in.uncolored {
+			return
+		}
+		p := &gs.fill
+		if operator == "CS" {
+			p = &gs.stroke
+		}
+		if name, ok := lastName(args); ok {
+			in.setSpace(p, in.r.loadColorSpace(types.Name(name), in.resources, 0))
+		}
+	case "SC", "SCN", "sc", "scn":
+		if in.uncolored {
+			return
+		}
+		p := &gs.fill
+		if operator == "SC" || operator == "SCN" {
+			p = &gs.stroke
+		}
+		p.comps = operandNumbers(args)
+		p.pattern = nil
+		if name, ok := lastName(args); ok {
+			p.pattern = in.resource("Pattern", name)
+		}
+	case "G", "g", "RG", "rg", "K", "k":
+		if in.uncolored {
+			return
+		}
+		p := &gs.fill
+		if operator == "G" || operator == "RG" || operator == "K" {
+			p = &gs.stroke
+		}
+		var cs colorSpace = deviceGray{}
+		switch operator {
+		case "RG", "rg":
+			cs = deviceRGB{}
+		case "K", "k":
+			cs = deviceCMYK{}
+		}
+		*p = paint{space: cs, comps: operandNumbers(args)}
+
+	case "sh":
+		name, ok := lastName(args)
+		if !ok {
+			return
+		}
+		s := in.r.loadShading(in.resource("Shading", name), in.resources)
+		if s == nil {
+			return
+		}
+		mask := gs.clip
+		if mask == nil {
+			mask = image.NewAlpha(in.bounds)
+			for i := range mask.Pix {
+				mask.Pix[i] = 0xff
+			}
+		}
+		in.paintShading(s, gs.ctm, mask, gs.fillAlpha)
+
+	case "Do":
+		if name, ok := lastName(args); ok {
+			in.xObject(in.resource("XObject", name))
+		}
+	case "BI":
+		if len(args) < 2 {
+			return
+		}
+		dict, _ := args[0].(map[pdfcontent.Name]pdfcontent.Object)
+		data, _ := args[1].(pdfcontent.String)
+		in.drawImage(inlineImage(dict, data))
+
+	case "BT":
+		in.tm, in.tlm = pdfcontent.Identity, pdfcontent.Identity
+		in.textClip, in.textClipping = nil, false
+	case "ET":
+		if in.textClipping {
+			mask := rasterize(in.textClip, false, in.bounds)
+			if mask == nil {
+				mask = emptyMask()
+			}
+			gs.clip = intersectMasks(gs.clip, mask)
+		}
+		in.textClip, in.textClipping = nil, false
+	case "Tc":
+		gs.text.CharSpace = operand(args, 0)
+	case "Tw":
+		gs.text.WordSpace = operand(args, 0)
+	case "Tz":
+		gs.text.Scale = operand(args, 0) / 100
+	case "TL":
+		gs.text.Leading = operand(args, 0)
+	case "Ts":
+		gs.text.Rise = operand(args, 0)
+	case "Tr":
+		gs.render = int(operand(args, 0))
+	case "Tf":
+		if len(args) >= 2 {
+			if name, ok := args[len(args)-2].(pdfcontent.Name); ok {
+				in.setFont(in.resource("Font", name), name)
+			}
+			gs.text.Size = operand(args, len(args)-1)
+		}
+	case "Td", "TD":
+		tx, ty := operand(args, 0), operand(args, 1)
+		if operator == "TD" {
+			gs.text.Leading = -ty
+		}
+		in.tlm = pdfcontent.Matrix{1, 0, 0, 1, tx, ty}.Multiply(in.tlm)
+		in.tm = in.tlm
+	case "Tm":
+		if m, ok := pdfcontent.MatrixFrom(args); ok {
+			in.tm, in.tlm = m, m
+		}
+	case "T*":
+		in.nextLine()
+	case "Tj", "'", "\"":
+		if operator != "Tj" {
+			if operator == "\"" && len(args) >= 3 {
+				gs.text.WordSpace, gs.text.CharSpace = operand(args, 0), operand(args, 1)
+			}
+			in.nextLine()
+		}
+		if len(args) > 0 {
+			if s, ok := args[len(args)-1].(pdfcontent.String); ok {
+				in.showText(s)
+			}
+		}
+	case "TJ":
+		if len(args) == 0 {
+			return
+		}
+		a, _ := args[len(args)-1].([]pdfcontent.Object)
+		for _, o := range a {
+			switch v := o.(type) {
+			case pdfcontent.String:
+				in.showText(v)
+			case float64:
+				tx := -v / 1000 * gs.text.Size * gs.text.Scale
+				in.tm = pdfcontent.Matrix{1, 0, 0, 1, tx, 0}.Multiply(in.tm)
+			}
+		}
+	case "d1":
+		// Glyphs declared with d1 are painted in the colour of the text
+		in.uncolored = true
+	}
+}
+
+func (in *interp) nextLine() {
+	in.tlm = pdfcontent.Matrix{1, 0, 0, 1, 0, -in.gs.text.Leading}.Multiply(in.tlm)
+	in.tm = in.tlm
+}
+
+// setSpace selects a colour space with its initial colour
+func (in *interp) setSpace(p *paint, cs colorSpace) {
+	if cs == nil {
+		cs = deviceGray{}
+	}
+	*p = paint{space: cs, comps: cs.initial()}
+}
+
+// setFont selects a font resource
+func (in *interp) setFont(o types.Object, name pdfcontent.Name) {
+	in.gs.fontObj = o
+	in.gs.text.Font = in.r.fonts.Lookup(in.resources, name)
+}
+
+// extGState applies the entries of a graphics state parameter dictionary
+func (in *interp) extGState(o types.Object) {
+	xRefTable := in.r.xRefTable
+	d, ok := deref(xRefTable, o).(types.Dict)
+	if !ok {
+		return
+	}
+	gs := &in.gs
+	for key, v := range d {
+		switch key {
+		case "LW":
+			gs.lineWidth = numberValue(xRefTable, v, gs.lineWidth)
+		case "LC":
+			gs.lineCap = intValue(xRefTable, v, gs.lineCap)
+		case "LJ":
+			gs.lineJoin = intValue(xRefTable, v, gs.lineJoin)
+		case "ML":
+			gs.miterLimit = numberValue(xRefTable, v, gs.miterLimit)
+		case "D":
+			if a, ok := deref(xRefTable, v).(types.Array); ok && len(a) == 2 {
+				gs.dash = numberArray(xRefTable, a[0])
+				gs.dashPhase = numberValue(xRefTable, a[1], 0)
+			}
+		case "CA":
+			gs.strokeAlpha = numberValue(xRefTable, v, gs.strokeAlpha)
+		case "ca":
+			gs.fillAlpha = numberValue(xRefTable, v, gs.fillAlpha)
+		case "Font":
+			if a, ok := deref(xRefTable, v).(types.Array); ok && len(a) == 2 {
+				gs.fontObj = a[0]
+				if f, err := pdfcontent.LoadFont(xRefTable, a[0]); err == nil {
+					gs.text.Font = f
+				}
+				gs.text.Size = numberValue(xRefTable, a[1], gs.text.Size)
+			}
+		}
+	}
+}
+
+// xObject draws an image or form XObject
+func (in *interp) xObject(o types.Object) {
+	sd, _, err := in.r.xRefTable.DereferenceStreamDict(o)
+	if err != nil || sd == nil {
+		return
+	}
+	subtype := sd.Subtype()
+	if subtype == nil {
+		return
+	}
+	switch *subtype {
+	case "Image":
+		in.drawImage(sd)
+	case "Form":
+		in.drawForm(sd, in.gs.ctm)
+	}
+}
+
+// drawForm runs the content of a form XObject drawn with a transformation
+// to device space, clipped to its bounding box
+func (in *interp) drawForm(sd *types.StreamDict, ctm pdfcontent.Matrix) {
+	if in.depth >= maxDepth || sd.Decode() != nil {
+		return
+	}
+	xRefTable := in.r.xRefTable
+	m := ctm
+	if fm, ok := pdfcontent.MatrixFrom(objects(numberArray(xRefTable, sd.Dict["Matrix"]))); ok {
+		m = fm.Multiply(ctm)
+	}
+	resources := in.resources
+	if res, ok := deref(xRefTable, sd.Dict["Resources"]).(types.Dict); ok {
+		resources = res
+	}
+
+	saved := in.gs
+	if bbox := numberArray(xRefTable, sd.Dict["BBox"]); len(bbox) == 4 {
+		var p path
+		p.rect(bbox[0], bbox[1], bbox[2]-bbox[0], bbox[3]-bbox[1], m)
+		mask := rasterize(p.flatten(), false, in.bounds)
+		if mask == nil {
+			return
+		}
+		in.gs.clip = intersectMasks(in.gs.clip, mask)
+	}
+	in.runNested(sd.Content, resources, m)
+	in.gs = saved
+}
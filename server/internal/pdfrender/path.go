@@ -0,0 +1,398 @@
+package pdfrender
+
+import (
+	"math"
+
+	"file-conv/internal/pdfcontent"
+)
+
+type point struct {
+	x, y float64
+}
+
+func (p point) add(q point) point     { return point{p.x + q.x, p.y + q.y} }
+func (p point) sub(q point) point     { return point{p.x - q.x, p.y - q.y} }
+func (p point) scale(f float64) point { return point{p.x * f, p.y * f} }
+func (p point) length() float64       { return math.Hypot(p.x, p.y) }
+func (p point) cross(q point) float64 { return p.x*q.y - p.y*q.x }
+func (p point) dot(q point) float64   { return p.x*q.x + p.y*q.y }
+func apply(m pdfcontent.Matrix, p point) point {
+	x, y := m.Apply(p.x, p.y)
+	return point{x, y}
+}
+
+// Segment kinds of a path
+const (
+	segMove = iota
+	segLine
+	segCubic
+	segClose
+)
+
+// segment is one path construction step; cubic curves use all three points,
+// the other kinds only the first
+type segment struct {
+	kind int
+	pts  [3]point
+}
+
+// path is a path under construction, in device space
+type path struct {
+	segs  []segment
+	start point // start of the current subpath
+	cur   point
+	open  bool // there is a current point
+}
+
+func (p *path) moveTo(pt point) {
+	// Consecutive moves only keep the last one
+	if n := len(p.segs); n > 0 && p.segs[n-1].kind == segMove {
+		p.segs = p.segs[:n-1]
+	}
+	p.segs = append(p.segs, segment{kind: segMove, pts: [3]point{pt}})
+	p.start, p.cur, p.open = pt, pt, true
+}
+
+func (p *path) lineTo(pt point) {
+	if !p.open {
+		p.moveTo(pt)
+		return
+	}
+	p.segs = append(p.segs, segment{kind: segLine, pts: [3]point{pt}})
+	p.cur = pt
+}
+
+func (p *path) cubeTo(c1, c2, pt point) {
+	if !p.open {
+		p.moveTo(c1)
+	}
+	p.segs = append(p.segs, segment{kind: segCubic, pts: [3]point{c1, c2, pt}})
+	p.cur = pt
+}
+
+func (p *path) close() {
+	if !p.open {
+		return
+	}
+	p.segs = append(p.segs, segment{kind: segClose})
+	p.cur = p.start
+}
+
+func (p *path) reset() {
+	p.segs = p.segs[:0]
+	p.open = false
+}
+
+// rect adds a closed rectangle with corners transformed by m
+func (p *path) rect(x, y, w, h float64, m pdfcontent.Matrix) {
+	p.moveTo(apply(m, point{x, y}))
+	p.lineTo(apply(m, point{x + w, y}))
+	p.lineTo(apply(m, point{x + w, y + h}))
+	p.lineTo(apply(m, point{x, y + h}))
+	p.close()
+}
+
+// appendTransformed adds the segments of another path, such as a glyph
+// outline, transformed by m
+func (p *path) appendTransformed(segs []segment, m pdfcontent.Matrix) {
+	for _, s := range segs {
+		switch s.kind {
+		case segMove:
+			p.moveTo(apply(m, s.pts[0]))
+		case segLine:
+			p.lineTo(apply(m, s.pts[0]))
+		case segCubic:
+			p.cubeTo(apply(m, s.pts[0]), apply(m, s.pts[1]), apply(m, s.pts[2]))
+		case segClose:
+			p.close()
+		}
+	}
+}
+
+// polyline is a flattened subpath
+type polyline struct {
+	pts    []point
+	closed bool
+}
+
+// Curves are flattened to within this many device pixels
+const flatness = 0.2
+
+// flatten approximates the subpaths with polylines
+func (p *path) flatten() []polyline {
+	var lines []polyline
+	var cur *polyline
+	var last point
+	implicit := false // cur only holds the start of a closed subpath
+	for _, s := range p.segs {
+		switch s.kind {
+		case segMove:
+			if implicit {
+				lines = lines[:len(lines)-1]
+			}
+			lines = append(lines, polyline{pts: []point{s.pts[0]}})
+			cur = &lines[len(lines)-1]
+			last, implicit = s.pts[0], false
+		case segLine:
+			cur.pts = append(cur.pts, s.pts[0])
+			last, implicit = s.pts[0], false
+		case segCubic:
+			cur.pts = flattenCubic(cur.pts, last, s.pts[0], s.pts[1], s.pts[2])
+			last, implicit = s.pts[2], false
+		case segClose:
+			if implicit {
+				continue
+			}
+			cur.closed = true
+			// Drawing may continue from the start of the closed subpath
+			lines = append(lines, polyline{pts: []point{cur.pts[0]}})
+			last, implicit = cur.pts[0], true
+			cur = &lines[len(lines)-1]
+		}
+	}
+	if implicit {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// flattenCubic appends points approximating a cubic Bézier curve
+func flattenCubic(pts []point, p0, p1, p2, p3 point) []point {
+	// Wang's formula bounds the number of segments needed
+	dd := math.Max(p0.sub(p1.scale(2)).add(p2).length(), p1.sub(p2.scale(2)).add(p3).length())
+	n := int(math.Ceil(math.Sqrt(0.75 * dd / flatness)))
+	n = max(1, min(n, 256))
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		pts = append(pts, point{
+			u*u*u*p0.x + 3*u*u*t*p1.x + 3*u*t*t*p2.x + t*t*t*p3.x,
+			u*u*u*p0.y + 3*u*u*t*p1.y + 3*u*t*t*p2.y + t*t*t*p3.y,
+		})
+	}
+	return pts
+}
+
+// Line caps and joins
+const (
+	capButt = iota
+	capRound
+	capSquare
+)
+
+const (
+	joinMiter = iota
+	joinRound
+	joinBevel
+)
+
+// strokeStyle holds the line parameters of the graphics state scaled to
+// device pixels
+type strokeStyle struct {
+	width      float64
+	cap, join  int
+	miterLimit float64
+	dash       []float64
+	phase      float64
+}
+
+// stroke returns polygons covering the outline of lines drawn with style.
+// The polygons all wind the same way, so filling them with the nonzero rule
+// paints their union.
+func stroke(lines []polyline, style strokeStyle) []polyline {
+	if len(style.dash) > 0 {
+		lines = dashLines(lines, style.dash, style.phase)
+	}
+	var polys []polyline
+	hw := style.width / 2
+	for _, l := range lines {
+		pts := dedupe(l.pts)
+		closed := l.closed && len(pts) > 2
+		if closed && pts[0] == pts[len(pts)-1] {
+			pts = pts[:len(pts)-1]
+		}
+
+		// A subpath of a single point is only visible with round or square caps
+		if len(pts) == 1 {
+			switch style.cap {
+			case capRound:
+				polys = append(polys, circle(pts[0], hw))
+			case capSquare:
+				c := pts[0]
+				polys = append(polys, oriented([]point{
+					{c.x - hw, c.y - hw}, {c.x + hw, c.y - hw}, {c.x + hw, c.y + hw}, {c.x - hw, c.y + hw},
+				}))
+			}
+			continue
+		}
+
+		n := len(pts)
+		segCount := n - 1
+		if closed {
+			segCount = n
+		}
+		for i := 0; i < segCount; i++ {
+			a, b := pts[i], pts[(i+1)%n]
+			d := b.sub(a).scale(1 / b.sub(a).length())
+			if !closed && style.cap == capSquare {
+				if i == 0 {
+					a = a.sub(d.scale(hw))
+				}
+				if i == segCount-1 {
+					b = b.add(d.scale(hw))
+				}
+			}
+			nrm := point{-d.y, d.x}.scale(hw)
+			polys = append(polys, oriented([]point{a.add(nrm), b.add(nrm), b.sub(nrm), a.sub(nrm)}))
+		}
+
+		// Joins at interior vertices, and at the start of closed subpaths
+		for i := 0; i < n; i++ {
+			if !closed && (i == 0 || i == n-1) {
+				continue
+			}
+			prev, next := pts[(i+n-1)%n], pts[(i+1)%n]
+			polys = append(polys, join(prev, pts[i], next, hw, style)...)
+		}
+
+		if !closed && style.cap == capRound {
+			polys = append(polys, circle(pts[0], hw), circle(pts[n-1], hw))
+		}
+	}
+	return polys
+}
+
+// join returns the polygons filling the outer corner at v
+func join(prev, v, next point, hw float64, style strokeStyle) []polyline {
+	d0 := v.sub(prev).scale(1 / v.sub(prev).length())
+	d1 := next.sub(v).scale(1 / next.sub(v).length())
+	turn := d0.cross(d1)
+	if math.Abs(turn) < 1e-9 && d0.dot(d1) > 0 {
+		return nil
+	}
+	if style.join == joinRound {
+		return []polyline{circle(v, hw)}
+	}
+
+	// The outer side is the one the path turns away from
+	s := -1.0
+	if turn < 0 {
+		s = 1
+	}
+	n0 := point{-d0.y, d0.x}.scale(s)
+	n1 := point{-d1.y, d1.x}.scale(s)
+	o0, o1 := v.add(n0.scale(hw)), v.add(n1.scale(hw))
+
+	if style.join == joinMiter {
+		bisector := n0.add(n1)
+		if l := bisector.length(); l > 1e-9 && 2/l <= style.miterLimit {
+			tip := v.add(bisector.scale(2 * hw / (l * l)))
+			return []polyline{oriented([]point{v, o0, tip, o1})}
+		}
+	}
+	return []polyline{oriented([]point{v, o0, o1})}
+}
+
+// circle approximates a disc with a polygon
+func circle(c point, r float64) polyline {
+	n := int(math.Ceil(r * 2))
+	n = max(8, min(n, 64))
+	pts := make([]point, n)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		pts[i] = point{c.x + r*math.Cos(a), c.y + r*math.Sin(a)}
+	}
+	return oriented(pts)
+}
+
+// oriented returns a closed polygon with its points in a fixed winding order
+func oriented(pts []point) polyline {
+	area := 0.0
+	for i := range pts {
+		area += pts[i].cross(pts[(i+1)%len(pts)])
+	}
+	if area < 0 {
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	return polyline{pts: pts, closed: true}
+}
+
+// dedupe drops points that repeat the one before them
+func dedupe(pts []point) []point {
+	out := pts[:0:0]
+	for i, p := range pts {
+		if i > 0 && p.sub(out[len(out)-1]).length() < 1e-6 {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// dashLines splits polylines into the dashes of a dash pattern
+func dashLines(lines []polyline, dash []float64, phase float64) []polyline {
+	total := 0.0
+	for _, d := range dash {
+		total += d
+	}
+	if total <= 0 {
+		return lines
+	}
+
+	var out []polyline
+	for _, l := range lines {
+		pts := l.pts
+		if l.closed && len(pts) > 1 {
+			pts = append(pts[:len(pts):len(pts)], pts[0])
+		}
+
+		// Each subpath starts the pattern anew at the phase
+		i, left := 0, 0.0
+		pos := math.Mod(phase, total)
+		if pos < 0 {
+			pos += total
+		}
+		for pos >= dash[i] {
+			pos -= dash[i]
+			i = (i + 1) % len(dash)
+		}
+		left = dash[i] - pos
+		on := i%2 == 0
+
+		var cur []point
+		if on && len(pts) > 0 {
+			cur = []point{pts[0]}
+		}
+		for k := 1; k < len(pts); k++ {
+			a, b := pts[k-1], pts[k]
+			segLen := b.sub(a).length()
+			for segLen > 0 {
+				step := math.Min(left, segLen)
+				a = a.add(b.sub(a).scale(step / segLen))
+				segLen -= step
+				left -= step
+				if on {
+					cur = append(cur, a)
+				}
+				if left <= 1e-9 {
+					if on {
+						out = append(out, polyline{pts: cur})
+					}
+					cur = nil
+					i = (i + 1) % len(dash)
+					left = dash[i]
+					on = !on
+					if on {
+						cur = []point{a}
+					}
+				}
+			}
+		}
+		if on && len(cur) > 1 {
+			out = append(out, polyline{pts: cur})
+		}
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package pdfrender
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Each pixel row is sampled on this many scanlines; coverage along a
+// scanline is computed exactly
+const subScanlines = 4
+
+type edge struct {
+	x0, y0, y1 float64 // y0 < y1
+	dxdy       float64
+	dir        int
+}
+
+type crossing struct {
+	x   float64
+	dir int
+}
+
+// rasterize computes the antialiased coverage of closed polygons within
+// bounds. It returns nil if the polygons cover nothing there.
+func rasterize(polys []polyline, evenOdd bool, bounds image.Rectangle) *image.Alpha {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	var edges []edge
+	for _, poly := range polys {
+		n := len(poly.pts)
+		if n < 2 {
+			continue
+		}
+		for i, a := range poly.pts {
+			b := poly.pts[(i+1)%n]
+			minX, maxX = math.Min(minX, a.x), math.Max(maxX, a.x)
+			minY, maxY = math.Min(minY, a.y), math.Max(maxY, a.y)
+			if a.y == b.y || math.IsNaN(a.y) || math.IsNaN(b.y) {
+				continue
+			}
+			dir := 1
+			if a.y > b.y {
+				a, b, dir = b, a, -1
+			}
+			edges = append(edges, edge{x0: a.x, y0: a.y, y1: b.y, dxdy: (b.x - a.x) / (b.y - a.y), dir: dir})
+		}
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+
+	// Coordinates far outside the page are clamped by the bounds
+	r := image.Rect(
+		int(math.Floor(math.Max(minX, -1e6))), int(math.Floor(math.Max(minY, -1e6))),
+		int(math.Ceil(math.Min(maxX, 1e6))), int(math.Ceil(math.Min(maxY, 1e6))),
+	).Intersect(bounds)
+	if r.Empty() {
+		return nil
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	mask := image.NewAlpha(r)
+	width := r.Dx()
+	acc := make([]float64, width+1)
+	var active []int
+	var xs []crossing
+	next := 0
+	covered := false
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		clear(acc)
+		rowCovered := false
+		for s := 0; s < subScanlines; s++ {
+			y := float64(py) + (float64(s)+0.5)/subScanlines
+			for next < len(edges) && edges[next].y0 <= y {
+				active = append(active, next)
+				next++
+			}
+			xs = xs[:0]
+			kept := active[:0]
+			for _, i := range active {
+				e := &edges[i]
+				if e.y1 <= y {
+					continue
+				}
+				kept = append(kept, i)
+				xs = append(xs, crossing{e.x0 + (y-e.y0)*e.dxdy, e.dir})
+			}
+			active = kept
+			if len(xs) < 2 {
+				continue
+			}
+			sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+
+			winding := 0
+			for i := 0; i < len(xs)-1; i++ {
+				winding += xs[i].dir
+				inside := winding != 0
+				if evenOdd {
+					inside = winding%2 != 0
+				}
+				if inside {
+					addSpan(acc, xs[i].x-float64(r.Min.X), xs[i+1].x-float64(r.Min.X), 1.0/subScanlines)
+					rowCovered = true
+				}
+			}
+		}
+		if !rowCovered {
+			continue
+		}
+		covered = true
+		row := mask.Pix[(py-r.Min.Y)*mask.Stride:]
+		for x := 0; x < width; x++ {
+			v := acc[x]
+			if v >= 1 {
+				row[x] = 0xff
+			} else if v > 0 {
+				row[x] = uint8(v*255 + 0.5)
+			}
+		}
+	}
+	if !covered {
+		return nil
+	}
+	return mask
+}
+
+// addSpan adds weight times the covered part of each pixel between x0 and x1
+func addSpan(acc []float64, x0, x1, weight float64) {
+	width := float64(len(acc) - 1)
+	x0, x1 = math.Max(x0, 0), math.Min(x1, width)
+	if x1 <= x0 {
+		return
+	}
+	i0, i1 := int(x0), int(x1)
+	if i0 == i1 {
+		acc[i0] += (x1 - x0) * weight
+		return
+	}
+	acc[i0] += (float64(i0+1) - x0) * weight
+	for i := i0 + 1; i < i1; i++ {
+		acc[i] += weight
+	}
+	acc[i1] += (x1 - float64(i1)) * weight
+}
+
+// intersectMasks multiplies two coverage masks. A nil mask covers
+// everything, so the result is nil only if both are.
+func intersectMasks(a, b *image.Alpha) *image.Alpha {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	r := a.Rect.Intersect(b.Rect)
+	out := image.NewAlpha(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		ra := a.Pix[a.PixOffset(r.Min.X, y):]
+		rb := b.Pix[b.PixOffset(r.Min.X, y):]
+		ro := out.Pix[out.PixOffset(r.Min.X, y):]
+		for x := 0; x < r.Dx(); x++ {
+			ro[x] = uint8((uint16(ra[x])*uint16(rb[x]) + 127) / 255)
+		}
+	}
+	return out
+}
+
+// emptyMask covers nothing
+func emptyMask() *image.Alpha {
+	return image.NewAlpha(image.Rectangle{})
+}
@@ -0,0 +1,274 @@
+// Package pdfrender rasterizes PDF pages in pure Go. It draws vector paths,
+// text in the embedded TrueType, OpenType, CFF and Type 1 fonts or in Go
+// fonts standing in for fonts that are not embedded, Type 3 fonts, images,
+// smooth shadings and tiling patterns. Blend modes, soft masks and mesh
+// shadings are not rendered.
+package pdfrender
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"file-conv/internal/pdfcontent"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Largest page, in pixels, that is rendered
+const maxPagePixels = 1 << 26
+
+// Renderer renders the pages of a document. Fonts and colour spaces are
+// loaded once and shared between pages.
+type Renderer struct {
+	xRefTable *model.XRefTable
+	fonts     *pdfcontent.Fonts
+	faces     map[*pdfcontent.Font]*face
+	spaces    map[int]colorSpace
+}
+
+// NewRenderer returns a renderer for a document
+func NewRenderer(xRefTable *model.XRefTable) *Renderer {
+	return &Renderer{
+		xRefTable: xRefTable,
+		fonts:     pdfcontent.NewFonts(xRefTable),
+		faces:     map[*pdfcontent.Font]*face{},
+		spaces:    map[int]colorSpace{},
+	}
+}
+
+// PageSize returns the size of a page as displayed, in points: the crop box
+// turned by the page rotation
+func (r *Renderer) PageSize(pageNr int) (width, height float64, err error) {
+	_, _, inh, err := r.xRefTable.PageDict(pageNr, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	if inh == nil {
+		return 0, 0, fmt.Errorf("page %d not found", pageNr)
+	}
+	box := pageBox(inh)
+	width, height = box.Width(), box.Height()
+	if rotation(inh.Rotate)%180 != 0 {
+		width, height = height, width
+	}
+	return width, height, nil
+}
+
+// RenderPage renders a page at a resolution in dots per inch onto a white
+// background
+func (r *Renderer) RenderPage(pageNr int, dpi float64) (img *image.RGBA, err error) {
+	d, _, inh, err := r.xRefTable.PageDict(pageNr, false)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil || inh == nil {
+		return nil, fmt.Errorf("page %d not found", pageNr)
+	}
+
+	// Device space has its origin at the top left, with y pointing down
+	box := pageBox(inh)
+	s := dpi / 72
+	w, h := box.Width()*s, box.Height()*s
+	base := pdfcontent.Matrix{s, 0, 0, -s, -box.LL.X * s, box.UR.Y * s}
+	switch rotation(inh.Rotate) {
+	case 90:
+		base = base.Multiply(pdfcontent.Matrix{0, 1, -1, 0, h, 0})
+		w, h = h, w
+	case 180:
+		base = base.Multiply(pdfcontent.Matrix{-1, 0, 0, -1, w, h})
+	case 270:
+		base = base.Multiply(pdfcontent.Matrix{0, -1, 1, 0, 0, w})
+		w, h = h, w
+	}
+	width, height := max(1, int(math.Round(w))), max(1, int(math.Round(h)))
+	if width*height > maxPagePixels {
+		return nil, fmt.Errorf("page %d is too large to render at %g dpi", pageNr, dpi)
+	}
+
+	content, err := r.xRefTable.PageContent(d)
+	if err != nil && err != model.ErrNoContent {
+		return nil, err
+	}
+
+	// Damaged content must not take the server down with it
+	defer func() {
+		if v := recover(); v != nil {
+			img, err = nil, fmt.Errorf("rendering page %d: %v", pageNr, v)
+		}
+	}()
+
+	img = image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Rect, image.White, image.Point{}, draw.Src)
+	in := r.newInterp(img, base)
+	in.run(content, inh.Resources)
+	r.drawAnnotations(in, d, base)
+	return img, nil
+}
+
+// pageBox returns the crop box of a page, which defaults to the media box
+func pageBox(inh *model.InheritedPageAttrs) types.Rectangle {
+	box := types.Rectangle{UR: types.Point{X: 612, Y: 792}}
+	if inh.MediaBox != nil {
+		box = normalized(*inh.MediaBox)
+	}
+	if inh.CropBox != nil {
+		crop := normalized(*inh.CropBox)
+		crop.LL.X, crop.LL.Y = math.Max(crop.LL.X, box.LL.X), math.Max(crop.LL.Y, box.LL.Y)
+		crop.UR.X, crop.UR.Y = math.Min(crop.UR.X, box.UR.X), math.Min(crop.UR.Y, box.UR.Y)
+		if crop.Width() > 0 && crop.Height() > 0 {
+			box = crop
+		}
+	}
+	if box.Width() <= 0 || box.Height() <= 0 {
+		box = types.Rectangle{UR: types.Point{X: 612, Y: 792}}
+	}
+	return box
+}
+
+func normalized(r types.Rectangle) types.Rectangle {
+	return types.Rectangle{
+		LL: types.Point{X: math.Min(r.LL.X, r.UR.X), Y: math.Min(r.LL.Y, r.UR.Y)},
+		UR: types.Point{X: math.Max(r.LL.X, r.UR.X), Y: math.Max(r.LL.Y, r.UR.Y)},
+	}
+}
+
+// rotation returns the page rotation as 0, 90, 180 or 270 degrees
+func rotation(rotate int) int {
+	return ((rotate/90)%4 + 4) % 4 * 90
+}
+
+// Annotation flags that keep an annotation off the page
+const (
+	AnnotHidden = 1 << 1
+	AnnotNoView = 1 << 5
+)
+
+// drawAnnotations draws the normal appearances of the annotations of a page
+func (r *Renderer) drawAnnotations(in *interp, page types.Dict, base pdfcontent.Matrix) {
+	annots, _ := deref(r.xRefTable, page["Annots"]).(types.Array)
+	for _, o := range annots {
+		d, ok := deref(r.xRefTable, o).(types.Dict)
+		if !ok || intValue(r.xRefTable, d["F"], 0)&(AnnotHidden|AnnotNoView) != 0 {
+			continue
+		}
+		ap, ok := deref(r.xRefTable, d["AP"]).(types.Dict)
+		if !ok {
+			continue
+		}
+		// The normal appearance is a stream, or one per appearance state
+		normal := deref(r.xRefTable, ap["N"])
+		if states, ok := normal.(types.Dict); ok {
+			state, _ := deref(r.xRefTable, d["AS"]).(types.Name)
+			normal = deref(r.xRefTable, states[string(state)])
+		}
+		sd, ok := normal.(types.StreamDict)
+		rect := numberArray(r.xRefTable, d["Rect"])
+		if !ok || len(rect) < 4 {
+			continue
+		}
+
+		// The appearance's bounding box, transformed by its matrix, is
+		// fitted to the annotation rectangle
+		bbox := numberArray(r.xRefTable, sd.Dict["BBox"])
+		if len(bbox) < 4 {
+			continue
+		}
+		m := pdfcontent.Identity
+		if fm, ok := pdfcontent.MatrixFrom(objects(numberArray(r.xRefTable, sd.Dict["Matrix"]))); ok {
+			m = fm
+		}
+		x0, y0, x1, y1 := TransformedBounds(bbox, m)
+		if x1-x0 <= 0 || y1-y0 <= 0 {
+			continue
+		}
+		rx0, ry0 := math.Min(rect[0], rect[2]), math.Min(rect[1], rect[3])
+		rx1, ry1 := math.Max(rect[0], rect[2]), math.Max(rect[1], rect[3])
+		sx, sy := (rx1-rx0)/(x1-x0), (ry1-ry0)/(y1-y0)
+		fit := pdfcontent.Matrix{sx, 0, 0, sy, rx0 - x0*sx, ry0 - y0*sy}
+
+		in.gs = defaultState(base)
+		in.drawForm(&sd, fit.Multiply(base))
+	}
+}
+
+// TransformedBounds returns the bounding box of a rectangle, given as
+// [x0 y0 x1 y1], transformed by m
+func TransformedBounds(rect []float64, m pdfcontent.Matrix) (x0, y0, x1, y1 float64) {
+	x0, y0 = math.Inf(1), math.Inf(1)
+	x1, y1 = math.Inf(-1), math.Inf(-1)
+	for _, c := range [][2]float64{{rect[0], rect[1]}, {rect[2], rect[1]}, {rect[2], rect[3]}, {rect[0], rect[3]}} {
+		x, y := m.Apply(c[0], c[1])
+		x0, y0 = math.Min(x0, x), math.Min(y0, y)
+		x1, y1 = math.Max(x1, x), math.Max(y1, y)
+	}
+	return x0, y0, x1, y1
+}
+
+func deref(xRefTable *model.XRefTable, o types.Object) types.Object {
+	if o == nil {
+		return nil
+	}
+	v, err := xRefTable.Dereference(o)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func numberValue(xRefTable *model.XRefTable, o types.Object, def float64) float64 {
+	switch v := deref(xRefTable, o).(type) {
+	case types.Integer:
+		return float64(v.Value())
+	case types.Float:
+		return v.Value()
+	}
+	return def
+}
+
+func intValue(xRefTable *model.XRefTable, o types.Object, def int) int {
+	return int(numberValue(xRefTable, o, float64(def)))
+}
+
+func boolValue(xRefTable *model.XRefTable, o types.Object) bool {
+	b, _ := deref(xRefTable, o).(types.Boolean)
+	return b.Value()
+}
+
+// numberArray reads an array of numbers, or returns nil
+func numberArray(xRefTable *model.XRefTable, o types.Object) []float64 {
+	a, ok := deref(xRefTable, o).(types.Array)
+	if !ok {
+		return nil
+	}
+	out := make([]float64, len(a))
+	for i, e := range a {
+		out[i] = numberValue(xRefTable, e, 0)
+	}
+	return out
+}
+
+// objects converts numbers into content stream operands
+func objects(v []float64) []pdfcontent.Object {
+	out := make([]pdfcontent.Object, len(v))
+	for i, x := range v {
+		out[i] = x
+	}
+	return out
+}
+
+// invert returns the inverse of a matrix, if it has one
+func invert(m pdfcontent.Matrix) (pdfcontent.Matrix, bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if math.Abs(det) < 1e-12 {
+		return pdfcontent.Matrix{}, false
+	}
+	return pdfcontent.Matrix{
+		m[3] / det, -m[1] / det,
+		-m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det,
+		(m[1]*m[4] - m[0]*m[5]) / det,
+	}, true
+}
@@ -0,0 +1,312 @@
+package pdfrender
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"file-conv/internal/pdfcontent"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// shading is a smooth shading; mesh shadings are not supported
+type shading struct {
+	kind       int
+	cs         colorSpace
+	fn         function
+	coords     []float64
+	domain     []float64
+	extend     [2]bool
+	matrix     pdfcontent.Matrix // function-based shadings only
+	bbox       []float64
+	background []float64
+
+	lut [256]color.NRGBA // axial and radial colours by parameter
+}
+
+func (r *Renderer) loadShading(o types.Object, resources types.Dict) *shading {
+	var d types.Dict
+	switch v := deref(r.xRefTable, o).(type) {
+	case types.Dict:
+		d = v
+	case types.StreamDict:
+		d = v.Dict
+	default:
+		return nil
+	}
+
+	s := &shading{
+		kind:       intValue(r.xRefTable, d["ShadingType"], 0),
+		cs:         r.loadColorSpace(d["ColorSpace"], resources, 0),
+		fn:         loadFunction(r.xRefTable, d["Function"]),
+		coords:     numberArray(r.xRefTable, d["Coords"]),
+		domain:     numberArray(r.xRefTable, d["Domain"]),
+		bbox:       numberArray(r.xRefTable, d["BBox"]),
+		background: numberArray(r.xRefTable, d["Background"]),
+		matrix:     pdfcontent.Identity,
+	}
+	if s.cs == nil {
+		return nil
+	}
+	if ext, ok := deref(r.xRefTable, d["Extend"]).(types.Array); ok && len(ext) == 2 {
+		s.extend = [2]bool{boolValue(r.xRefTable, ext[0]), boolValue(r.xRefTable, ext[1])}
+	}
+
+	switch s.kind {
+	case 1:
+		if len(s.domain) < 4 {
+			s.domain = []float64{0, 1, 0, 1}
+		}
+		if m, ok := pdfcontent.MatrixFrom(objects(numberArray(r.xRefTable, d["Matrix"]))); ok {
+			s.matrix = m
+		}
+		if s.fn == nil {
+			return nil
+		}
+	case 2, 3:
+		if len(s.domain) < 2 {
+			s.domain = []float64{0, 1}
+		}
+		if s.fn == nil || (s.kind == 2 && len(s.coords) < 4) || (s.kind == 3 && len(s.coords) < 6) {
+			return nil
+		}
+		for i := range s.lut {
+			t := interpolate(float64(i), 0, 255, s.domain[0], s.domain[1])
+			s.lut[i] = toNRGBA(s.cs, s.fn.eval([]float64{t}), 1)
+		}
+	default:
+		return nil
+	}
+	return s
+}
+
+// at returns the colour at a point of shading space
+func (s *shading) at(p point) (color.NRGBA, bool) {
+	if len(s.bbox) == 4 && (p.x < math.Min(s.bbox[0], s.bbox[2]) || p.x > math.Max(s.bbox[0], s.bbox[2]) ||
+		p.y < math.Min(s.bbox[1], s.bbox[3]) || p.y > math.Max(s.bbox[1], s.bbox[3])) {
+		return color.NRGBA{}, false
+	}
+	switch s.kind {
+	case 1:
+		inv, ok := invert(s.matrix)
+		if !ok {
+			return color.NRGBA{}, false
+		}
+		q := apply(inv, p)
+		if q.x < s.domain[0] || q.x > s.domain[1] || q.y < s.domain[2] || q.y > s.domain[3] {
+			return color.NRGBA{}, false
+		}
+		return toNRGBA(s.cs, s.fn.eval([]float64{q.x, q.y}), 1), true
+	case 2:
+		x0, y0, x1, y1 := s.coords[0], s.coords[1], s.coords[2], s.coords[3]
+		dx, dy := x1-x0, y1-y0
+		den := dx*dx + dy*dy
+		t := 0.0
+		if den > 0 {
+			t = ((p.x-x0)*dx + (p.y-y0)*dy) / den
+		}
+		return s.param(t)
+	case 3:
+		return s.radial(p)
+	}
+	return color.NRGBA{}, false
+}
+
+// param returns the colour at parameter t of an axial or radial shading,
+// where 0 and 1 are the start and end
+func (s *shading) param(t float64) (color.NRGBA, bool) {
+	if t < 0 {
+		if !s.extend[0] {
+			return color.NRGBA{}, false
+		}
+		t = 0
+	}
+	if t > 1 {
+		if !s.extend[1] {
+			return color.NRGBA{}, false
+		}
+		t = 1
+	}
+	return s.lut[int(t*255+0.5)], true
+}
+
+// radial finds the largest t whose circle passes through p
+func (s *shading) radial(p point) (color.NRGBA, bool) {
+	x0, y0, r0, x1, y1, r1 := s.coords[0], s.coords[1], s.coords[2], s.coords[3], s.coords[4], s.coords[5]
+	cdx, cdy, dr := x1-x0, y1-y0, r1-r0
+	px, py := p.x-x0, p.y-y0
+	a := cdx*cdx + cdy*cdy - dr*dr
+	b := px*cdx + py*cdy + r0*dr
+	c := px*px + py*py - r0*r0
+
+	var roots []float64
+	if math.Abs(a) < 1e-9 {
+		if b != 0 {
+			roots = []float64{c / (2 * b)}
+		}
+	} else {
+		disc := b*b - a*c
+		if disc < 0 {
+			return color.NRGBA{}, false
+		}
+		sq := math.Sqrt(disc)
+		t1, t2 := (b+sq)/a, (b-sq)/a
+		roots = []float64{math.Max(t1, t2), math.Min(t1, t2)}
+	}
+	for _, t := range roots {
+		if r0+t*dr < 0 {
+			continue
+		}
+		if (t < 0 && !s.extend[0]) || (t > 1 && !s.extend[1]) {
+			continue
+		}
+		return s.param(t)
+	}
+	return color.NRGBA{}, false
+}
+
+// paintShading fills the covered pixels of mask with a shading whose space
+// maps to device space through m
+func (in *interp) paintShading(s *shading, m pdfcontent.Matrix, mask *image.Alpha, alpha float64) {
+	inv, ok := invert(m)
+	if !ok || mask == nil {
+		return
+	}
+	r := mask.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cover := mask.Pix[mask.PixOffset(x, y)]
+			if cover == 0 {
+				continue
+			}
+			c, ok := s.at(apply(inv, point{float64(x) + 0.5, float64(y) + 0.5}))
+			if !ok {
+				continue
+			}
+			c.A = uint8(255 * alpha)
+			blend(in.canvas, x, y, c, cover)
+		}
+	}
+}
+
+// Largest tile of a tiling pattern that is rendered, in pixels per side
+const maxTileSize = 1024
+
+// paintPattern fills the covered pixels of mask with a pattern
+func (in *interp) paintPattern(p paint, mask *image.Alpha, alpha float64) {
+	if mask == nil {
+		return
+	}
+	var d types.Dict
+	var sd *types.StreamDict
+	switch v := deref(in.r.xRefTable, p.pattern).(type) {
+	case types.Dict:
+		d = v
+	case types.StreamDict:
+		d, sd = v.Dict, &v
+	default:
+		return
+	}
+	m := pdfcontent.Identity
+	if pm, ok := pdfcontent.MatrixFrom(objects(numberArray(in.r.xRefTable, d["Matrix"]))); ok {
+		m = pm
+	}
+	m = m.Multiply(in.base)
+
+	switch intValue(in.r.xRefTable, d["PatternType"], 0) {
+	case 2:
+		if s := in.r.loadShading(d["Shading"], in.resources); s != nil {
+			in.paintShading(s, m, mask, alpha)
+		}
+	case 1:
+		if sd != nil {
+			in.paintTiles(sd, m, p, mask, alpha)
+		}
+	}
+}
+
+// paintTiles renders one cell of a tiling pattern and repeats it over mask
+func (in *interp) paintTiles(sd *types.StreamDict, m pdfcontent.Matrix, p paint, mask *image.Alpha, alpha float64) {
+	if in.depth >= maxDepth || sd.Decode() != nil {
+		return
+	}
+	xRefTable := in.r.xRefTable
+	bbox := numberArray(xRefTable, sd.Dict["BBox"])
+	xStep := math.Abs(numberValue(xRefTable, sd.Dict["XStep"], 0))
+	yStep := math.Abs(numberValue(xRefTable, sd.Dict["YStep"], 0))
+	if len(bbox) < 4 || xStep == 0 || yStep == 0 {
+		return
+	}
+	toTile, ok := invert(m)
+	if !ok {
+		return
+	}
+
+	// Tiles are rendered at device resolution where possible
+	scale := math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+	scale = math.Min(scale, maxTileSize/math.Max(xStep, yStep))
+	tw, th := int(math.Ceil(xStep*scale)), int(math.Ceil(yStep*scale))
+	if tw <= 0 || th <= 0 || scale <= 0 {
+		return
+	}
+	x0, y0 := math.Min(bbox[0], bbox[2]), math.Min(bbox[1], bbox[3])
+	cell := image.NewRGBA(image.Rect(0, 0, tw, th))
+	cellMatrix := pdfcontent.Matrix{scale, 0, 0, -scale, -x0 * scale, (y0 + yStep) * scale}
+
+	resources := in.resources
+	if res, ok := deref(xRefTable, sd.Dict["Resources"]).(types.Dict); ok {
+		resources = res
+	}
+	sub := in.sub(cell, cellMatrix)
+	// Uncoloured patterns paint in the colour given with the pattern
+	if intValue(xRefTable, sd.Dict["PaintType"], 1) == 2 {
+		under := paint{space: deviceRGB{}, comps: []float64{0, 0, 0}}
+		if ps, ok := p.space.(*patternSpace); ok && ps.base != nil {
+			under = paint{space: ps.base, comps: p.comps}
+		}
+		sub.gs.fill, sub.gs.stroke = under, under
+		sub.uncolored = true
+	}
+	var clip path
+	clip.rect(bbox[0], bbox[1], bbox[2]-bbox[0], bbox[3]-bbox[1], cellMatrix)
+	sub.gs.clip = rasterize(clip.flatten(), false, sub.bounds)
+	if sub.gs.clip == nil {
+		return
+	}
+	sub.run(sd.Content, resources)
+
+	r := mask.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cover := mask.Pix[mask.PixOffset(x, y)]
+			if cover == 0 {
+				continue
+			}
+			q := apply(toTile, point{float64(x) + 0.5, float64(y) + 0.5})
+			u := math.Mod(q.x-x0, xStep)
+			if u < 0 {
+				u += xStep
+			}
+			v := math.Mod(q.y-y0, yStep)
+			if v < 0 {
+				v += yStep
+			}
+			tx, ty := int(u*scale), int((yStep-v)*scale)
+			tx, ty = max(0, min(tx, tw-1)), max(0, min(ty, th-1))
+			i := cell.PixOffset(tx, ty)
+			a := cell.Pix[i+3]
+			if a == 0 {
+				continue
+			}
+			// Un-premultiply the tile colour before blending
+			c := color.NRGBA{
+				uint8(uint32(cell.Pix[i]) * 255 / uint32(a)),
+				uint8(uint32(cell.Pix[i+1]) * 255 / uint32(a)),
+				uint8(uint32(cell.Pix[i+2]) * 255 / uint32(a)),
+				uint8(float64(a) * alpha),
+			}
+			blend(in.canvas, x, y, c, cover)
+		}
+	}
+}
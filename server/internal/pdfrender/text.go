@@ -0,0 +1,368 @@
+package pdfrender
+
+import (
+	"encoding/binary"
+	"strings"
+	"sync"
+
+	"file-conv/internal/pdfcontent"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+// face draws the glyphs of a font resource. Exactly one of the font
+// programs is set; fonts that are not embedded, or whose program cannot be
+// read, are drawn in a Go font.
+type face struct {
+	trueType *trueTypeFont
+	cff      *cffFont
+	type1    *type1Font
+	fallback *sfnt.Font
+	buf      sfnt.Buffer
+
+	// Type 3 fonts draw glyphs with content streams
+	charProcs types.Dict
+	resources types.Dict
+	matrix    pdfcontent.Matrix
+
+	symbolic  bool
+	composite bool
+	cidToGID  []byte // CIDToGIDMap stream of CIDFontType2 fonts, nil for the identity
+
+	outlines map[uint32][]segment // by code, in text space for a font size of 1
+}
+
+// Font descriptor flags
+const (
+	flagFixedPitch = 1 << 0
+	flagSerif      = 1 << 1
+	flagSymbolic   = 1 << 2
+	flagItalic     = 1 << 6
+	flagForceBold  = 1 << 18
+)
+
+// face returns the face of a font resource, loading it on first use
+func (r *Renderer) face(o types.Object, font *pdfcontent.Font) *face {
+	if f, ok := r.faces[font]; ok {
+		return f
+	}
+	f := r.loadFace(o, font)
+	r.faces[font] = f
+	return f
+}
+
+func (r *Renderer) loadFace(o types.Object, font *pdfcontent.Font) *face {
+	xRefTable := r.xRefTable
+	f := &face{outlines: map[uint32][]segment{}}
+	d, _ := deref(xRefTable, o).(types.Dict)
+	subtype, _ := deref(xRefTable, d["Subtype"]).(types.Name)
+
+	if subtype == "Type3" {
+		f.charProcs, _ = deref(xRefTable, d["CharProcs"]).(types.Dict)
+		f.resources, _ = deref(xRefTable, d["Resources"]).(types.Dict)
+		f.matrix = pdfcontent.Matrix{0.001, 0, 0, 0.001, 0, 0}
+		if m, ok := pdfcontent.MatrixFrom(objects(numberArray(xRefTable, d["FontMatrix"]))); ok {
+			f.matrix = m
+		}
+		return f
+	}
+
+	// Composite fonts keep their program in the descendant font
+	if subtype == "Type0" {
+		f.composite = true
+		if a, ok := deref(xRefTable, d["DescendantFonts"]).(types.Array); ok && len(a) > 0 {
+			d, _ = deref(xRefTable, a[0]).(types.Dict)
+		}
+		if sd, _, err := xRefTable.DereferenceStreamDict(d["CIDToGIDMap"]); err == nil && sd != nil && sd.Decode() == nil {
+			f.cidToGID = sd.Content
+		}
+	}
+	fd, _ := deref(xRefTable, d["FontDescriptor"]).(types.Dict)
+	flags := intValue(xRefTable, fd["Flags"], 0)
+	f.symbolic = flags&flagSymbolic != 0
+
+	if !f.loadProgram(xRefTable, fd) {
+		f.fallback = fallbackFont(font.Name, flags)
+	}
+	return f
+}
+
+// loadProgram reads the embedded font program of a font descriptor
+func (f *face) loadProgram(xRefTable *model.XRefTable, fd types.Dict) bool {
+	for _, key := range []string{"FontFile2", "FontFile3", "FontFile"} {
+		sd, _, err := xRefTable.DereferenceStreamDict(fd[key])
+		if err != nil || sd == nil || sd.Decode() != nil {
+			continue
+		}
+		data := sd.Content
+		var subtype types.Name
+		if s := sd.Subtype(); s != nil {
+			subtype = types.Name(*s)
+		}
+		switch {
+		case key == "FontFile2" || subtype == "OpenType":
+			if tt, err := parseTrueType(data); err == nil {
+				f.trueType = tt
+				return true
+			}
+		case key == "FontFile3":
+			if c, err := parseCFF(data); err == nil {
+				f.cff = c
+				return true
+			}
+		default:
+			if t1, err := parseType1(data); err == nil {
+				f.type1 = t1
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Go fonts stand in for fonts that are not embedded
+var (
+	fallbackOnce  sync.Once
+	fallbackFonts map[string]*sfnt.Font
+)
+
+// fallbackFont picks the Go font closest to a font by name and flags
+func fallbackFont(name string, flags int) *sfnt.Font {
+	fallbackOnce.Do(func() {
+		fallbackFonts = map[string]*sfnt.Font{}
+		for key, ttf := range map[string][]byte{
+			"regular": goregular.TTF, "bold": gobold.TTF, "italic": goitalic.TTF, "bolditalic": gobolditalic.TTF,
+			"mono": gomono.TTF, "monobold": gomonobold.TTF, "monoitalic": gomonoitalic.TTF, "monobolditalic": gomonobolditalic.TTF,
+		} {
+			if font, err := sfnt.Parse(ttf); err == nil {
+				fallbackFonts[key] = font
+			}
+		}
+	})
+
+	lower := strings.ToLower(name)
+	key := ""
+	if flags&flagFixedPitch != 0 || strings.Contains(lower, "courier") || strings.Contains(lower, "mono") {
+		key = "mono"
+	}
+	if flags&flagForceBold != 0 || strings.Contains(lower, "bold") || strings.Contains(lower, "black") || strings.Contains(lower, "heavy") {
+		key += "bold"
+	}
+	if flags&flagItalic != 0 || strings.Contains(lower, "italic") || strings.Contains(lower, "oblique") {
+		key += "italic"
+	}
+	if key == "" {
+		key = "regular"
+	}
+	return fallbackFonts[key]
+}
+
+// glyph returns the outline of a glyph in text space for a font size of 1
+func (f *face) glyph(font *pdfcontent.Font, g pdfcontent.Glyph) []segment {
+	if segs, ok := f.outlines[g.Code]; ok {
+		return segs
+	}
+	var segs []segment
+	switch {
+	case f.trueType != nil:
+		segs = f.trueTypeGlyph(font, g)
+	case f.cff != nil:
+		segs = transformed(f.cffGlyph(f.cff, font, g), f.cff.matrix)
+	case f.type1 != nil:
+		name := font.GlyphName(g.Code)
+		if name == "" && g.Code < 256 {
+			name = f.type1.encoding[g.Code]
+		}
+		segs = transformed(f.type1.glyph(name), f.type1.matrix)
+	case f.fallback != nil:
+		if r := glyphRune(font, g); r != 0 {
+			if gid, err := f.fallback.GlyphIndex(&f.buf, r); err == nil && gid != 0 {
+				segs = loadOutline(f.fallback, &f.buf, gid)
+			}
+		}
+	}
+	f.outlines[g.Code] = segs
+	return segs
+}
+
+// trueTypeGlyph selects a glyph of a TrueType font: by CID for composite
+// fonts, otherwise through the cmap subtable that suits the encoding
+func (f *face) trueTypeGlyph(font *pdfcontent.Font, g pdfcontent.Glyph) []segment {
+	tt := f.trueType
+	if tt.cff != nil {
+		segs := f.cffGlyph(tt.cff, font, g)
+		var p path
+		p.appendTransformed(segs, tt.cff.matrix)
+		return p.segs
+	}
+	if f.composite {
+		gid := int(g.CID)
+		if f.cidToGID != nil {
+			i := 2 * int(g.CID)
+			if i+2 > len(f.cidToGID) {
+				return nil
+			}
+			gid = int(binary.BigEndian.Uint16(f.cidToGID[i:]))
+		}
+		return tt.glyph(gid)
+	}
+
+	name := font.GlyphName(g.Code)
+	if !f.symbolic || name != "" {
+		if gid, ok := tt.names[name]; ok && name != "" {
+			return tt.glyph(int(gid))
+		}
+		if m := tt.cmaps[cmapUnicode]; m != nil {
+			if r := glyphRune(font, g); r != 0 {
+				if gid, ok := m[uint32(r)]; ok {
+					return tt.glyph(int(gid))
+				}
+			}
+		}
+	}
+	// Symbolic fonts map codes directly, in the Microsoft symbol range
+	// or through a Macintosh subtable
+	if m := tt.cmaps[cmapSymbol]; m != nil {
+		for _, base := range []uint32{0, 0xf000, 0xf100, 0xf200} {
+			if gid, ok := m[base+g.Code]; ok {
+				return tt.glyph(int(gid))
+			}
+		}
+	}
+	if m := tt.cmaps[cmapMacRoman]; m != nil {
+		if gid, ok := m[g.Code]; ok {
+			return tt.glyph(int(gid))
+		}
+	}
+	for _, id := range []cmapID{cmapUnicode, cmapUnicodeFull} {
+		if m := tt.cmaps[id]; m != nil {
+			if gid, ok := m[g.Code]; ok {
+				return tt.glyph(int(gid))
+			}
+		}
+	}
+	return tt.glyph(int(g.Code))
+}
+
+// cffGlyph selects a glyph of a CFF font by CID, by the glyph name the
+// PDF encoding gives or by the font's built-in encoding
+func (f *face) cffGlyph(c *cffFont, font *pdfcontent.Font, g pdfcontent.Glyph) []segment {
+	if c.cidKeyed {
+		if gid, ok := c.cids[int(g.CID)]; ok {
+			return c.glyph(gid)
+		}
+		return nil
+	}
+	if f.composite {
+		return c.glyph(int(g.CID))
+	}
+	if name := font.GlyphName(g.Code); name != "" {
+		if gid, ok := c.names[name]; ok {
+			return c.glyph(gid)
+		}
+	}
+	if g.Code < 256 {
+		return c.glyph(c.encoding[g.Code])
+	}
+	return nil
+}
+
+// glyphRune returns the character a glyph stands for, or 0
+func glyphRune(font *pdfcontent.Font, g pdfcontent.Glyph) rune {
+	text := g.Text
+	if name := font.GlyphName(g.Code); name != "" {
+		if t := pdfcontent.GlyphText(name); t != "" {
+			text = t
+		}
+	}
+	for _, r := range text {
+		return r
+	}
+	if g.Code >= 32 && g.Code < 127 {
+		return rune(g.Code)
+	}
+	return 0
+}
+
+func transformed(segs []segment, m pdfcontent.Matrix) []segment {
+	var p path
+	p.appendTransformed(segs, m)
+	return p.segs
+}
+
+// Text rendering modes 4 to 7 add the glyphs to the clipping path
+const (
+	renderInvisible = 3
+	renderClip      = 4
+)
+
+// showText draws a string with the current font and advances the text
+// matrix past it
+func (in *interp) showText(s pdfcontent.String) {
+	ts := in.gs.text
+	if ts.Font == nil {
+		return
+	}
+	f := in.r.face(in.gs.fontObj, ts.Font)
+	mode := in.gs.render % renderClip
+	var p path
+	for _, g := range ts.Font.Glyphs(s) {
+		// The text rendering matrix maps text space to device space
+		trm := pdfcontent.Matrix{ts.Size * ts.Scale, 0, 0, ts.Size, 0, ts.Rise}.Multiply(in.tm).Multiply(in.gs.ctm)
+		if f.charProcs != nil {
+			if mode != renderInvisible {
+				in.drawType3Glyph(f, ts.Font, g, trm)
+			}
+		} else {
+			p.appendTransformed(f.glyph(ts.Font, g), trm)
+		}
+
+		tx := g.Width*ts.Size + ts.CharSpace
+		if g.Space {
+			tx += ts.WordSpace
+		}
+		in.tm = pdfcontent.Matrix{1, 0, 0, 1, tx * ts.Scale, 0}.Multiply(in.tm)
+	}
+	if len(p.segs) == 0 {
+		return
+	}
+
+	lines := p.flatten()
+	switch mode {
+	case 0:
+		in.fill(lines, false)
+	case 1:
+		in.strokeLines(lines)
+	case 2:
+		in.fill(lines, false)
+		in.strokeLines(lines)
+	}
+	if in.gs.render >= renderClip {
+		in.textClip = append(in.textClip, lines...)
+		in.textClipping = true
+	}
+}
+
+// drawType3Glyph runs the glyph procedure of a Type 3 font
+func (in *interp) drawType3Glyph(f *face, font *pdfcontent.Font, g pdfcontent.Glyph, trm pdfcontent.Matrix) {
+	name := font.GlyphName(g.Code)
+	sd, _, err := in.r.xRefTable.DereferenceStreamDict(f.charProcs[name])
+	if err != nil || sd == nil || sd.Decode() != nil {
+		return
+	}
+	resources := f.resources
+	if resources == nil {
+		resources = in.resources
+	}
+	in.runNested(sd.Content, resources, f.matrix.Multiply(trm))
+}
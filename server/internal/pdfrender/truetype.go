@@ -0,0 +1,373 @@
+package pdfrender
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// trueTypeFont is a TrueType or OpenType font program. Its cmap subtables
+// are read here, since sfnt only uses one of them. Outlines come from sfnt,
+// given a rebuilt font that leaves out the tables PDF subsets often lack
+// or damage; fonts with CFF outlines are drawn from their CFF table.
+type trueTypeFont struct {
+	font       *sfnt.Font
+	buf        sfnt.Buffer
+	unitsPerEm float64
+	numGlyphs  int
+	cmaps      map[cmapID]map[uint32]uint16
+	names      map[string]uint16 // glyph names of the post table
+	cff        *cffFont
+}
+
+// cmapID is the platform and encoding of a cmap subtable
+type cmapID struct {
+	platform, encoding uint16
+}
+
+var (
+	cmapUnicode     = cmapID{3, 1}
+	cmapSymbol      = cmapID{3, 0}
+	cmapMacRoman    = cmapID{1, 0}
+	cmapUnicodeFull = cmapID{3, 10}
+)
+
+// Glyphs are loaded at this size, which keeps their coordinates within
+// the range of 26.6 fixed point numbers
+const glyphPPEM = 256
+
+// tableDirectory returns the tables of an sfnt font by tag. The first font
+// of a collection is used.
+func tableDirectory(data []byte) map[string][]byte {
+	if len(data) < 12 {
+		return nil
+	}
+	offset := 0
+	if string(data[:4]) == "ttcf" && len(data) >= 16 {
+		offset = int(binary.BigEndian.Uint32(data[12:]))
+	}
+	if offset+12 > len(data) {
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(data[offset+4:]))
+	tables := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		rec := offset + 12 + 16*i
+		if rec+16 > len(data) {
+			break
+		}
+		start := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if start < 0 || length < 0 || start > len(data) {
+			continue
+		}
+		// Some subsets give lengths past the end of the font
+		end := min(start+length, len(data))
+		tables[string(data[rec:rec+4])] = data[start:end]
+	}
+	return tables
+}
+
+// parseTrueType reads a TrueType or OpenType font program
+func parseTrueType(data []byte) (*trueTypeFont, error) {
+	tables := tableDirectory(data)
+	if tables == nil {
+		return nil, errInvalidFont
+	}
+	f := &trueTypeFont{cmaps: readCmaps(tables["cmap"])}
+
+	if cff, ok := tables["CFF "]; ok {
+		c, err := parseCFF(cff)
+		if err != nil {
+			return nil, err
+		}
+		f.cff = c
+		f.numGlyphs = len(c.charStrings)
+		return f, nil
+	}
+
+	head, loca, glyf := tables["head"], tables["loca"], tables["glyf"]
+	if len(head) < 54 || loca == nil || glyf == nil {
+		return nil, errInvalidFont
+	}
+	head = append([]byte(nil), head[:54]...)
+	upem := binary.BigEndian.Uint16(head[18:])
+	if upem < 16 {
+		upem = 1000
+		binary.BigEndian.PutUint16(head[18:], upem)
+	}
+	f.unitsPerEm = float64(upem)
+
+	entry := 2
+	if binary.BigEndian.Uint16(head[50:]) != 0 {
+		entry = 4
+	}
+	f.numGlyphs = len(loca)/entry - 1
+	if maxp := tables["maxp"]; len(maxp) >= 6 {
+		f.numGlyphs = min(f.numGlyphs, int(binary.BigEndian.Uint16(maxp[4:])))
+	}
+	if f.numGlyphs <= 0 {
+		return nil, errInvalidFont
+	}
+	loca = loca[:(f.numGlyphs+1)*entry]
+	f.names = postNames(tables["post"], f.numGlyphs)
+
+	font, err := sfnt.Parse(rebuildTrueType(head, loca, glyf, f.numGlyphs))
+	if err != nil {
+		return nil, err
+	}
+	f.font = font
+	return f, nil
+}
+
+// rebuildTrueType writes a font with the glyph tables of a TrueType font
+// and minimal versions of the other tables sfnt requires
+func rebuildTrueType(head, loca, glyf []byte, numGlyphs int) []byte {
+	maxp := make([]byte, 32)
+	binary.BigEndian.PutUint32(maxp, 0x00010000)
+	binary.BigEndian.PutUint16(maxp[4:], uint16(numGlyphs))
+
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint32(hhea, 0x00010000)
+	binary.BigEndian.PutUint16(hhea[34:], 1)
+
+	// A Windows Unicode cmap with only the final segment maps nothing
+	cmap := []byte{
+		0, 0, 0, 1, 0, 3, 0, 1, 0, 0, 0, 12,
+		0, 4, 0, 24, 0, 0, 0, 2, 0, 2, 0, 0, 0, 0,
+		0xff, 0xff, 0, 0, 0xff, 0xff, 0, 1, 0, 0,
+	}
+	post := make([]byte, 32)
+	binary.BigEndian.PutUint32(post, 0x00030000)
+
+	return writeSfnt(map[string][]byte{
+		"cmap": cmap, "glyf": glyf, "head": head, "hhea": hhea,
+		"hmtx": make([]byte, 4), "loca": loca, "maxp": maxp, "post": post,
+	})
+}
+
+// writeSfnt lays out tables after a table directory sorted by tag
+func writeSfnt(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	out := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(out, 0x00010000)
+	binary.BigEndian.PutUint16(out[4:], uint16(len(tags)))
+	for i, tag := range tags {
+		t := tables[tag]
+		rec := out[12+16*i:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(t)))
+		out = append(out, t...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// readCmaps reads the subtables of a cmap table in formats 0, 4, 6 and 12
+func readCmaps(cmap []byte) map[cmapID]map[uint32]uint16 {
+	cmaps := map[cmapID]map[uint32]uint16{}
+	if len(cmap) < 4 {
+		return cmaps
+	}
+	n := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < n && 4+8*i+8 <= len(cmap); i++ {
+		rec := cmap[4+8*i:]
+		id := cmapID{binary.BigEndian.Uint16(rec), binary.BigEndian.Uint16(rec[2:])}
+		offset := int(binary.BigEndian.Uint32(rec[4:]))
+		if offset < 0 || offset+4 > len(cmap) {
+			continue
+		}
+		if m := readCmapSubtable(cmap[offset:]); len(m) > 0 {
+			if _, ok := cmaps[id]; !ok {
+				cmaps[id] = m
+			}
+		}
+	}
+	return cmaps
+}
+
+func readCmapSubtable(t []byte) map[uint32]uint16 {
+	u16 := func(i int) int {
+		if i+2 > len(t) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(t[i:]))
+	}
+	u32 := func(i int) uint32 {
+		if i+4 > len(t) {
+			return 0
+		}
+		return binary.BigEndian.Uint32(t[i:])
+	}
+	m := map[uint32]uint16{}
+	switch u16(0) {
+	case 0:
+		for code := 0; code < 256 && 6+code < len(t); code++ {
+			if gid := t[6+code]; gid != 0 {
+				m[uint32(code)] = uint16(gid)
+			}
+		}
+	case 4:
+		segs := u16(6) / 2
+		ends, starts, deltas, ranges := 14, 16+2*segs, 16+4*segs, 16+6*segs
+		for s := 0; s < segs; s++ {
+			end, start := u16(ends+2*s), u16(starts+2*s)
+			delta, rangeOffset := u16(deltas+2*s), u16(ranges+2*s)
+			for c := start; c <= end && c < 0xffff; c++ {
+				gid := 0
+				if rangeOffset == 0 {
+					gid = (c + delta) & 0xffff
+				} else if g := u16(ranges + 2*s + rangeOffset + 2*(c-start)); g != 0 {
+					gid = (g + delta) & 0xffff
+				}
+				if gid != 0 {
+					m[uint32(c)] = uint16(gid)
+				}
+			}
+		}
+	case 6:
+		first, count := u16(6), u16(8)
+		for i := 0; i < count; i++ {
+			if gid := u16(10 + 2*i); gid != 0 {
+				m[uint32(first+i)] = uint16(gid)
+			}
+		}
+	case 12:
+		groups := int(u32(12))
+		for i := 0; i < groups && 16+12*i+12 <= len(t); i++ {
+			start, end, gid := u32(16+12*i), u32(20+12*i), u32(24+12*i)
+			for c := start; c <= end && c-start < 0x10000; c++ {
+				m[c] = uint16(gid + c - start)
+			}
+		}
+	}
+	return m
+}
+
+// postNames reads the glyph names of a version 2 post table
+func postNames(post []byte, numGlyphs int) map[string]uint16 {
+	if len(post) < 34 || binary.BigEndian.Uint32(post) != 0x00020000 {
+		return nil
+	}
+	n := min(int(binary.BigEndian.Uint16(post[32:])), numGlyphs)
+	if 34+2*n > len(post) {
+		return nil
+	}
+	// Names past the standard Macintosh ones are Pascal strings after the
+	// glyph name indexes
+	var extra []string
+	for p := 34 + 2*int(binary.BigEndian.Uint16(post[32:])); p < len(post); {
+		l := int(post[p])
+		if p+1+l > len(post) {
+			break
+		}
+		extra = append(extra, string(post[p+1:p+1+l]))
+		p += 1 + l
+	}
+	names := make(map[string]uint16, n)
+	for gid := 0; gid < n; gid++ {
+		i := int(binary.BigEndian.Uint16(post[34+2*gid:]))
+		name := ""
+		if i < len(macGlyphNames) {
+			name = macGlyphNames[i]
+		} else if i-len(macGlyphNames) < len(extra) {
+			name = extra[i-len(macGlyphNames)]
+		}
+		if _, ok := names[name]; name != "" && !ok {
+			names[name] = uint16(gid)
+		}
+	}
+	return names
+}
+
+// glyph returns the outline of a glyph in text space for a font size of 1
+func (f *trueTypeFont) glyph(gid int) []segment {
+	if f.cff != nil {
+		segs := f.cff.glyph(gid)
+		// CFF outlines of OpenType fonts are in units of the font matrix
+		var p path
+		p.appendTransformed(segs, f.cff.matrix)
+		return p.segs
+	}
+	if gid <= 0 || gid >= f.numGlyphs {
+		return nil
+	}
+	return loadOutline(f.font, &f.buf, sfnt.GlyphIndex(gid))
+}
+
+// loadOutline returns the outline of a glyph of an sfnt font in glyph
+// space, where the em square is one unit
+func loadOutline(font *sfnt.Font, buf *sfnt.Buffer, gid sfnt.GlyphIndex) []segment {
+	raw, err := font.LoadGlyph(buf, gid, fixed.I(glyphPPEM), nil)
+	if err != nil {
+		return nil
+	}
+	const unit = 64 * glyphPPEM
+	pt := func(p fixed.Point26_6) point {
+		return point{float64(p.X) / unit, -float64(p.Y) / unit}
+	}
+	var p path
+	for _, s := range raw {
+		switch s.Op {
+		case sfnt.SegmentOpMoveTo:
+			p.close()
+			p.moveTo(pt(s.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			p.lineTo(pt(s.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			// Quadratic curves are raised to cubic ones
+			q, end := pt(s.Args[0]), pt(s.Args[1])
+			start := p.cur
+			p.cubeTo(start.add(q.sub(start).scale(2.0/3)), end.add(q.sub(end).scale(2.0/3)), end)
+		case sfnt.SegmentOpCubeTo:
+			p.cubeTo(pt(s.Args[0]), pt(s.Args[1]), pt(s.Args[2]))
+		}
+	}
+	p.close()
+	return p.segs
+}
+
+// The standard Macintosh glyph order that post table names index into
+var macGlyphNames = []string{
+	".notdef", ".null", "nonmarkingreturn", "space", "exclam", "quotedbl", "numbersign",
+	"dollar", "percent", "ampersand", "quotesingle", "parenleft", "parenright", "asterisk",
+	"plus", "comma", "hyphen", "period", "slash", "zero", "one", "two", "three", "four",
+	"five", "six", "seven", "eight", "nine", "colon", "semicolon", "less", "equal",
+	"greater", "question", "at", "A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L",
+	"M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z", "bracketleft",
+	"backslash", "bracketright", "asciicircum", "underscore", "grave", "a", "b", "c", "d",
+	"e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u", "v",
+	"w", "x", "y", "z", "braceleft", "bar", "braceright", "asciitilde", "Adieresis",
+	"Aring", "Ccedilla", "Eacute", "Ntilde", "Odieresis", "Udieresis", "aacute", "agrave",
+	"acircumflex", "adieresis", "atilde", "aring", "ccedilla", "eacute", "egrave",
+	"ecircumflex", "edieresis", "iacute", "igrave", "icircumflex", "idieresis", "ntilde",
+	"oacute", "ograve", "ocircumflex", "odieresis", "otilde", "uacute", "ugrave",
+	"ucircumflex", "udieresis", "dagger", "degree", "cent", "sterling", "section",
+	"bullet", "paragraph", "germandbls", "registered", "copyright", "trademark", "acute",
+	"dieresis", "notequal", "AE", "Oslash", "infinity", "plusminus", "lessequal",
+	"greaterequal", "yen", "mu", "partialdiff", "summation", "product", "pi", "integral",
+	"ordfeminine", "ordmasculine", "Omega", "ae", "oslash", "questiondown", "exclamdown",
+	"logicalnot", "radical", "florin", "approxequal", "Delta", "guillemotleft",
+	"guillemotright", "ellipsis", "nonbreakingspace", "Agrave", "Atilde", "Otilde", "OE",
+	"oe", "endash", "emdash", "quotedblleft", "quotedblright", "quoteleft", "quoteright",
+	"divide", "lozenge", "ydieresis", "Ydieresis", "fraction", "currency", "guilsinglleft",
+	"guilsinglright", "fi", "fl", "daggerdbl", "periodcentered", "quotesinglbase",
+	"quotedblbase", "perthousand", "Acircumflex", "Ecircumflex", "Aacute", "Edieresis",
+	"Egrave", "Iacute", "Icircumflex", "Idieresis", "Igrave", "Oacute", "Ocircumflex",
+	"apple", "Ograve", "Uacute", "Ucircumflex", "Ugrave", "dotlessi", "circumflex", "tilde",
+	"macron", "breve", "dotaccent", "ring", "cedilla", "hungarumlaut", "ogonek", "caron",
+	"Lslash", "lslash", "Scaron", "scaron", "Zcaron", "zcaron", "brokenbar", "Eth", "eth",
+	"Yacute", "yacute", "Thorn", "thorn", "minus", "multiply", "onesuperior", "twosuperior",
+	"threesuperior", "onehalf", "onequarter", "threequarters", "franc", "Gbreve", "gbreve",
+	"Idotaccent", "Scedilla", "scedilla", "Cacute", "cacute", "Ccaron", "ccaron", "dcroat",
+}
@@ -0,0 +1,486 @@
+package pdfrender
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+
+	"file-conv/internal/pdfcontent"
+)
+
+// type1Font is a Type 1 font program embedded as FontFile
+type type1Font struct {
+	charStrings map[string][]byte
+	subrs       [][]byte
+	encoding    [256]string // built-in encoding, glyph name by code
+	matrix      pdfcontent.Matrix
+}
+
+// parseType1 reads a Type 1 font program: the clear text part gives the
+// encoding and font matrix, the eexec encrypted part the glyphs
+func parseType1(data []byte) (*type1Font, error) {
+	i := bytes.Index(data, []byte("eexec"))
+	if i < 0 {
+		return nil, errInvalidFont
+	}
+	clear, encrypted := data[:i], data[i+5:]
+	encrypted = bytes.TrimLeft(encrypted, " \t\r\n")
+
+	f := &type1Font{matrix: pdfcontent.Matrix{0.001, 0, 0, 0.001, 0, 0}}
+	f.readClearText(clear)
+
+	// The encrypted part is binary or, if it starts with hex digits, hex
+	if len(encrypted) >= 4 && isHex(encrypted[:4]) {
+		encrypted = decodeHex(encrypted)
+	}
+	private := decrypt(encrypted, 55665, 4)
+	if !f.readPrivate(private) {
+		return nil, errInvalidFont
+	}
+	return f, nil
+}
+
+func isHex(b []byte) bool {
+	for _, c := range b {
+		if !isHexDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// decodeHex decodes hex digits, skipping whitespace, up to the first other
+// character
+func decodeHex(b []byte) []byte {
+	digits := make([]byte, 0, len(b))
+	for _, c := range b {
+		if isHexDigit(c) {
+			digits = append(digits, c)
+		} else if !isSpace(c) {
+			break
+		}
+	}
+	out := make([]byte, len(digits)/2)
+	hex.Decode(out, digits[:len(out)*2])
+	return out
+}
+
+// decrypt undoes eexec or charstring encryption and drops the leading
+// random bytes
+func decrypt(b []byte, key uint16, skip int) []byte {
+	out := make([]byte, len(b))
+	r := key
+	for i, c := range b {
+		out[i] = c ^ byte(r>>8)
+		r = (uint16(c)+r)*52845 + 22719
+	}
+	if skip > len(out) {
+		return nil
+	}
+	return out[skip:]
+}
+
+// readClearText reads the font matrix and encoding
+func (f *type1Font) readClearText(b []byte) {
+	if i := bytes.Index(b, []byte("/FontMatrix")); i >= 0 {
+		t := &tokenizer{data: b, pos: i + len("/FontMatrix")}
+		var m []float64
+		for tok := t.next(); tok != "" && tok != "]" && len(m) < 6; tok = t.next() {
+			tok = string(bytes.Trim([]byte(tok), "[{}"))
+			if v, err := strconv.ParseFloat(tok, 64); err == nil {
+				m = append(m, v)
+			}
+		}
+		if len(m) == 6 {
+			copy(f.matrix[:], m)
+		}
+	}
+
+	i := bytes.Index(b, []byte("/Encoding"))
+	if i < 0 {
+		return
+	}
+	t := &tokenizer{data: b, pos: i + len("/Encoding")}
+	if t.next() == "StandardEncoding" {
+		for code, sid := range standardEncoding {
+			if sid != 0 {
+				f.encoding[code] = cffStandardStrings[sid]
+			}
+		}
+		return
+	}
+	// Entries are "dup code /name put", up to "readonly def" or "def"
+	for tok := t.next(); tok != "" && tok != "def"; tok = t.next() {
+		if tok != "dup" {
+			continue
+		}
+		code, err := strconv.Atoi(t.next())
+		name := t.next()
+		if err == nil && code >= 0 && code < 256 && len(name) > 1 && name[0] == '/' {
+			f.encoding[code] = name[1:]
+		}
+	}
+}
+
+// readPrivate reads the subroutines and charstrings of the decrypted part
+func (f *type1Font) readPrivate(b []byte) bool {
+	lenIV := 4
+	if i := bytes.Index(b, []byte("/lenIV")); i >= 0 {
+		t := &tokenizer{data: b, pos: i + len("/lenIV")}
+		if v, err := strconv.Atoi(t.next()); err == nil {
+			lenIV = v
+		}
+	}
+	charString := func(data []byte) []byte {
+		if lenIV < 0 {
+			return data
+		}
+		return decrypt(data, 4330, lenIV)
+	}
+
+	// Subrs are "dup index length RD <binary> NP"
+	if i := bytes.Index(b, []byte("/Subrs")); i >= 0 {
+		t := &tokenizer{data: b, pos: i + len("/Subrs")}
+		count, _ := strconv.Atoi(t.next())
+		if count > 0 && count < 1<<16 {
+			f.subrs = make([][]byte, count)
+		}
+		for tok := t.next(); tok != ""; tok = t.next() {
+			if tok == "dup" {
+				index, _ := strconv.Atoi(t.next())
+				data := t.binary()
+				if data == nil {
+					break
+				}
+				if index >= 0 && index < len(f.subrs) {
+					f.subrs[index] = charString(data)
+				}
+			} else if tok != "array" && tok != "NP" && tok != "|" && tok != "noaccess" && tok != "put" && tok != "readonly" {
+				break
+			}
+		}
+	}
+
+	// CharStrings are "/name length RD <binary> ND"
+	i := bytes.Index(b, []byte("/CharStrings"))
+	if i < 0 {
+		return false
+	}
+	f.charStrings = map[string][]byte{}
+	t := &tokenizer{data: b, pos: i + len("/CharStrings")}
+	for tok := t.next(); tok != "" && tok != "end"; tok = t.next() {
+		if len(tok) < 2 || tok[0] != '/' {
+			continue
+		}
+		data := t.binary()
+		if data == nil {
+			break
+		}
+		f.charStrings[tok[1:]] = charString(data)
+	}
+	return len(f.charStrings) > 0
+}
+
+// tokenizer splits the PostScript of a Type 1 font at whitespace
+type tokenizer struct {
+	data []byte
+	pos  int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func (t *tokenizer) next() string {
+	for t.pos < len(t.data) && isSpace(t.data[t.pos]) {
+		t.pos++
+	}
+	start := t.pos
+	for t.pos < len(t.data) && !isSpace(t.data[t.pos]) {
+		t.pos++
+		// Brackets and names end where another one starts
+		if c := t.data[t.pos-1]; c == '[' || c == ']' {
+			break
+		}
+		if t.pos < len(t.data) && (t.data[t.pos] == '/' || t.data[t.pos] == '[' || t.data[t.pos] == ']') {
+			break
+		}
+	}
+	return string(t.data[start:t.pos])
+}
+
+// binary reads "length RD " followed by that many bytes
+func (t *tokenizer) binary() []byte {
+	n, err := strconv.Atoi(t.next())
+	if err != nil || n < 0 {
+		return nil
+	}
+	t.next() // RD or -|
+	t.pos++  // the single space before the data
+	if t.pos+n > len(t.data) {
+		return nil
+	}
+	data := t.data[t.pos : t.pos+n]
+	t.pos += n
+	return data
+}
+
+// glyph returns the outline of a named glyph in glyph space
+func (f *type1Font) glyph(name string) []segment {
+	return f.outline(name, true)
+}
+
+// outline runs the charstring of a glyph. The parts of accented glyphs may
+// not be accented themselves.
+func (f *type1Font) outline(name string, accented bool) []segment {
+	code, ok := f.charStrings[name]
+	if !ok {
+		return nil
+	}
+	t := &type1Interp{font: f}
+	t.run(code, 0)
+	t.p.close()
+	if t.seac != nil {
+		if !accented {
+			return nil
+		}
+		return f.accented(t.seac, t.sbx)
+	}
+	return t.p.segs
+}
+
+// accented draws the base and accent glyphs of seac. The accent is placed
+// by the difference between its side bearing and that of the base.
+func (f *type1Font) accented(args []float64, sbx float64) []segment {
+	asb, adx, ady, bchar, achar := args[0], args[1], args[2], int(args[3]), int(args[4])
+	if bchar < 0 || bchar > 255 || achar < 0 || achar > 255 {
+		return nil
+	}
+	var p path
+	p.appendTransformed(f.outline(cffStandardStrings[standardEncoding[bchar]], false), pdfcontent.Identity)
+	p.appendTransformed(f.outline(cffStandardStrings[standardEncoding[achar]], false), pdfcontent.Matrix{1, 0, 0, 1, adx + sbx - asb, ady})
+	return p.segs
+}
+
+// type1Interp runs Type 1 charstrings
+type type1Interp struct {
+	font    *type1Font
+	p       path
+	cur     point // differs from the path's during flex
+	sbx     float64
+	stack   []float64
+	ps      []float64 // results of othersubrs, taken by pop
+	flexing bool
+	flexPts []point
+	seac    []float64
+	ended   bool
+}
+
+func (t *type1Interp) moveBy(dx, dy float64) {
+	t.cur = point{t.cur.x + dx, t.cur.y + dy}
+	if t.flexing {
+		t.flexPts = append(t.flexPts, t.cur)
+		return
+	}
+	t.p.close()
+	t.p.moveTo(t.cur)
+}
+
+func (t *type1Interp) lineBy(dx, dy float64) {
+	t.cur = point{t.cur.x + dx, t.cur.y + dy}
+	t.p.lineTo(t.cur)
+}
+
+func (t *type1Interp) curveBy(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	c1 := point{t.cur.x + dx1, t.cur.y + dy1}
+	c2 := point{c1.x + dx2, c1.y + dy2}
+	t.cur = point{c2.x + dx3, c2.y + dy3}
+	t.p.cubeTo(c1, c2, t.cur)
+}
+
+func (t *type1Interp) run(code []byte, depth int) {
+	if depth > maxSubrDepth {
+		return
+	}
+	for i := 0; i < len(code) && !t.ended; {
+		b := code[i]
+		i++
+		switch {
+		case b >= 32 && b <= 246:
+			t.stack = append(t.stack, float64(int(b)-139))
+			continue
+		case b >= 247 && b <= 250:
+			if i >= len(code) {
+				return
+			}
+			t.stack = append(t.stack, float64((int(b)-247)*256+int(code[i])+108))
+			i++
+			continue
+		case b >= 251 && b <= 254:
+			if i >= len(code) {
+				return
+			}
+			t.stack = append(t.stack, float64(-(int(b)-251)*256-int(code[i])-108))
+			i++
+			continue
+		case b == 255:
+			if i+3 >= len(code) {
+				return
+			}
+			v := int32(uint32(code[i])<<24 | uint32(code[i+1])<<16 | uint32(code[i+2])<<8 | uint32(code[i+3]))
+			t.stack = append(t.stack, float64(v))
+			i += 4
+			continue
+		}
+
+		s := t.stack
+		switch b {
+		case 13: // hsbw
+			if len(s) >= 2 {
+				t.sbx = s[0]
+				t.cur = point{s[0], 0}
+			}
+		case 21: // rmoveto
+			if len(s) >= 2 {
+				t.moveBy(s[0], s[1])
+			}
+		case 22: // hmoveto
+			if len(s) >= 1 {
+				t.moveBy(s[0], 0)
+			}
+		case 4: // vmoveto
+			if len(s) >= 1 {
+				t.moveBy(0, s[0])
+			}
+		case 5: // rlineto
+			if len(s) >= 2 {
+				t.lineBy(s[0], s[1])
+			}
+		case 6: // hlineto
+			if len(s) >= 1 {
+				t.lineBy(s[0], 0)
+			}
+		case 7: // vlineto
+			if len(s) >= 1 {
+				t.lineBy(0, s[0])
+			}
+		case 8: // rrcurveto
+			if len(s) >= 6 {
+				t.curveBy(s[0], s[1], s[2], s[3], s[4], s[5])
+			}
+		case 30: // vhcurveto
+			if len(s) >= 4 {
+				t.curveBy(0, s[0], s[1], s[2], s[3], 0)
+			}
+		case 31: // hvcurveto
+			if len(s) >= 4 {
+				t.curveBy(s[0], 0, s[1], s[2], 0, s[3])
+			}
+		case 9: // closepath
+			t.p.close()
+		case 10: // callsubr
+			if len(s) == 0 {
+				return
+			}
+			n := int(s[len(s)-1])
+			t.stack = s[:len(s)-1]
+			if n >= 0 && n < len(t.font.subrs) {
+				t.run(t.font.subrs[n], depth+1)
+			}
+			continue
+		case 11: // return
+			return
+		case 14: // endchar
+			t.ended = true
+			return
+		case 12:
+			if i >= len(code) {
+				return
+			}
+			esc := code[i]
+			i++
+			if t.escape(esc) {
+				continue
+			}
+		}
+		t.stack = t.stack[:0]
+	}
+}
+
+// escape runs a two-byte operator, reporting whether it leaves the stack
+func (t *type1Interp) escape(esc byte) bool {
+	s := t.stack
+	n := len(s)
+	switch esc {
+	case 6: // seac
+		if n >= 5 {
+			t.seac = append([]float64(nil), s[n-5:]...)
+			t.ended = true
+		}
+	case 7: // sbw
+		if n >= 4 {
+			t.sbx = s[0]
+			t.cur = point{s[0], s[1]}
+		}
+	case 12: // div
+		if n >= 2 && s[n-1] != 0 {
+			t.stack = append(s[:n-2], s[n-2]/s[n-1])
+		}
+		return true
+	case 16: // callothersubr
+		if n < 2 {
+			return false
+		}
+		other, count := int(s[n-1]), int(s[n-2])
+		if count < 0 || count > n-2 {
+			return false
+		}
+		args := s[n-2-count : n-2]
+		t.stack = s[:n-2-count]
+		t.othersubr(other, args)
+		return true
+	case 17: // pop
+		if len(t.ps) > 0 {
+			t.stack = append(t.stack, t.ps[len(t.ps)-1])
+			t.ps = t.ps[:len(t.ps)-1]
+		}
+		return true
+	case 33: // setcurrentpoint
+		if n >= 2 {
+			t.cur = point{s[0], s[1]}
+		}
+	}
+	return false
+}
+
+// othersubr runs the standard othersubrs for flex and hint replacement.
+// Results are left for pop in the order it takes them.
+func (t *type1Interp) othersubr(other int, args []float64) {
+	t.ps = t.ps[:0]
+	switch other {
+	case 1: // start of flex
+		t.flexing = true
+		t.flexPts = t.flexPts[:0]
+	case 0: // end of flex
+		t.flexing = false
+		if pts := t.flexPts; len(pts) >= 7 {
+			t.p.cubeTo(pts[1], pts[2], pts[3])
+			t.p.cubeTo(pts[4], pts[5], pts[6])
+			t.cur = pts[6]
+		}
+		if len(args) >= 3 {
+			t.ps = append(t.ps, args[2], args[1])
+		}
+	case 2: // flex point, added by the rmoveto that follows
+	case 3: // hint replacement calls subroutine 3, which only holds hints
+		t.ps = append(t.ps, 3)
+	default:
+		for i := len(args) - 1; i >= 0; i-- {
+			t.ps = append(t.ps, args[i])
+		}
+	}
+}
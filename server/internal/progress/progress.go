@@ -0,0 +1,50 @@
+// Package progress lets handlers report how far a conversion has got. The
+// reporter travels in the request context, so reporting is a no-op for
+// ordinary synchronous requests and feeds the event stream of async jobs.
+package progress
+
+import "context"
+
+// Event is one progress update
+type Event struct {
+	Stage   string `json:"stage"`
+	Current int    `json:"current,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Stages reported by the handlers
+const (
+	StageUploaded   = "uploaded"
+	StageParsing    = "parsing"
+	StageConverting = "converting"
+	StagePage       = "page"
+	StageEncoding   = "encoding"
+	StageZipping    = "zipping"
+	StageDone       = "done"
+	StageError      = "error"
+)
+
+// Reporter receives progress events
+type Reporter func(Event)
+
+type reporterKey struct{}
+
+// WithReporter returns a context that delivers events to fn
+func WithReporter(ctx context.Context, fn Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, fn)
+}
+
+// Report sends an event to the reporter in ctx, if there is one
+func Report(ctx context.Context, stage string, current, total int) {
+	if fn, ok := ctx.Value(reporterKey{}).(Reporter); ok {
+		fn(Event{Stage: stage, Current: current, Total: total})
+	}
+}
+
+// ReportMessage sends an event with a free-form message
+func ReportMessage(ctx context.Context, stage, message string) {
+	if fn, ok := ctx.Value(reporterKey{}).(Reporter); ok {
+		fn(Event{Stage: stage, Message: message})
+	}
+}
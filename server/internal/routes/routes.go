@@ -1,10 +1,14 @@
 package routes
 
 import (
+	"file-conv/internal/converters"
 	"file-conv/internal/handlers"
+	"file-conv/internal/jobs"
 	"file-conv/internal/middleware"
 	"fmt"
 	"net/http"
+	"runtime"
+	"time"
 
 	"github.com/rs/cors"
 )
@@ -20,19 +24,51 @@ func NewApiServer(addr string) *ApiServer {
 func (s *ApiServer) Run() error {
 	router := http.NewServeMux()
 
-	router.HandleFunc("POST /convert/jpg-to-png", handlers.ConvertJPGToPNG)
-	router.HandleFunc("POST /convert/png-to-jpg", handlers.ConvertPNGToJPG)
+	// Registered converters are served under /convert/{name}
+	converters.Default.Mount(router)
 	router.HandleFunc("POST /convert/to-pdf", handlers.ConvertToPDF)
+	router.HandleFunc("POST /convert/text-to-pdf", handlers.TextToPDF)
+	router.HandleFunc("POST /convert/markdown-to-pdf", handlers.MarkdownToPDF)
 
-	router.HandleFunc("POST /compress", handlers.CompressImage)
-	router.HandleFunc("POST /resize", handlers.ResizeImage)
-	router.HandleFunc("POST /transparent", handlers.BackgroundTransparent)
+	// Original image endpoints, kept for existing clients
+	router.HandleFunc("POST /compress", converters.Default.LenientHandler("compress"))
+	router.HandleFunc("POST /resize", converters.Default.LenientHandler("resize"))
+	router.HandleFunc("POST /transparent", converters.Default.Handler("transparent"))
 
 	router.HandleFunc("POST /merge-pdfs", handlers.MergePDFs)
 	router.HandleFunc("POST /split-pdf", handlers.SplitPDF)
+	router.HandleFunc("POST /pdf/nup", handlers.NUpPDF)
+	router.HandleFunc("POST /pdf/booklet", handlers.BookletPDF)
 	router.HandleFunc("POST /compress-pdf", handlers.CompressPDFHandler)
+	router.HandleFunc("POST /pdf/encrypt", handlers.EncryptPDF)
+	router.HandleFunc("POST /pdf/decrypt", handlers.DecryptPDF)
+	router.HandleFunc("POST /pdf/watermark", handlers.WatermarkPDF)
+	router.HandleFunc("POST /pdf/number", handlers.NumberPDF)
+	router.HandleFunc("POST /pdf/organize", handlers.OrganizePDF)
+	router.HandleFunc("POST /pdf/extract-images", handlers.ExtractImagesPDF)
+	router.HandleFunc("POST /pdf/extract-text", handlers.ExtractTextPDF)
+	router.HandleFunc("POST /pdf/info", handlers.InfoPDF)
+	router.HandleFunc("POST /pdf/metadata", handlers.MetadataPDF)
+	router.HandleFunc("POST /pdf/attachments/add", handlers.AddAttachmentsPDF)
+	router.HandleFunc("POST /pdf/attachments/list", handlers.ListAttachmentsPDF)
+	router.HandleFunc("POST /pdf/attachments/extract", handlers.ExtractAttachmentsPDF)
+	router.HandleFunc("POST /pdf/form/fields", handlers.FormFieldsPDF)
+	router.HandleFunc("POST /pdf/form/fill", handlers.FillFormPDF)
+	router.HandleFunc("POST /pdf/validate", handlers.ValidatePDF)
+	router.HandleFunc("POST /pdf/repair", handlers.RepairPDF)
+	router.HandleFunc("POST /pdf/to-images", handlers.PDFToImages)
 	// Add code here
 
+	// Any POST endpoint above can also run asynchronously as a job
+	jobManager, err := jobs.NewManager(router, runtime.NumCPU(), 100, time.Hour)
+	if err != nil {
+		return err
+	}
+	router.HandleFunc("POST /jobs", jobManager.CreateJob)
+	router.HandleFunc("GET /jobs/{id}", jobManager.JobStatus)
+	router.HandleFunc("GET /jobs/{id}/result", jobManager.JobResult)
+	router.HandleFunc("GET /jobs/{id}/events", jobManager.JobEvents)
+
 	stack := middleware.MiddlewareChain(middleware.Logger, middleware.RecoveryMiddleware)
 
 	corsHandler := cors.New(cors.Options{
@@ -45,6 +81,7 @@ func (s *ApiServer) Run() error {
 			"Accept",
 			"Origin",
 			"X-Requested-With"},
+		ExposedHeaders: []string{"X-Original-Size", "X-Compressed-Size"},
 	}).Handler(stack(router))
 
 	server := http.Server{
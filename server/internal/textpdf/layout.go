@@ -0,0 +1,781 @@
+package textpdf
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"file-conv/internal/utils"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Font programs by family and gofpdf style
+var fonts = map[string]map[string][]byte{
+	"sans": {"": goregular.TTF, "B": gobold.TTF, "I": goitalic.TTF, "BI": gobolditalic.TTF},
+	"mono": {"": gomono.TTF, "B": gomonobold.TTF, "I": gomonoitalic.TTF, "BI": gomonobolditalic.TTF},
+}
+
+const (
+	ptToMM      = 25.4 / 72
+	lineSpacing = 1.4 // line height as a multiple of the font size
+)
+
+type color [3]int
+
+var (
+	textColor        = color{33, 33, 33}
+	quoteTextColor   = color{100, 100, 100}
+	linkColor        = color{25, 90, 180}
+	ruleColor        = color{200, 200, 200}
+	codeBackground   = color{244, 244, 244}
+	headerBackground = color{232, 232, 232}
+)
+
+// Bullets of nested list levels, and the boxes of open and done tasks
+var (
+	bullets   = []string{"•", "◦", "▪"}
+	taskBoxes = map[bool]string{false: "□", true: "■"}
+)
+
+// Heading sizes relative to the body text, by level
+var headingScales = []float64{1.9, 1.5, 1.25, 1.1, 1, 0.9}
+
+// writer lays out blocks on pages from top to bottom. Page breaks are
+// taken whenever the next line does not fit.
+type writer struct {
+	pdf    *gofpdf.Fpdf
+	opts   Options
+	images map[string][]byte
+	placed map[string][2]float64 // registered images by name, with their size
+	loaded map[string]bool       // fonts added to the document
+
+	top, bottom float64 // vertical limits of the text area
+	left, right float64 // current column
+	y           float64
+	color       color
+
+	quoteBars []float64 // positions of the bars of enclosing block quotes
+	marker    *marker   // list marker waiting for the first line of its item
+	lists     int       // depth of enclosing lists, whose blocks are spaced closely
+}
+
+// marker is the bullet or number of a list item
+type marker struct {
+	text, family string
+	x            float64
+}
+
+// textStyle is the base style of a block of inline text
+type textStyle struct {
+	size float64 // in points
+	bold bool
+}
+
+// piece is a run of text on a line in the style of its span
+type piece struct {
+	span
+	width float64
+}
+
+// word is a run of pieces that is not broken between lines unless it is
+// wider than a line, with the space before it
+type word struct {
+	gap    *piece // nil at the start of a line
+	pieces []piece
+	width  float64
+	brk    bool // a line break instead of a word
+}
+
+func newWriter(opts Options, images map[string][]byte) *writer {
+	orientation := "P"
+	if opts.Orientation == "landscape" {
+		orientation = "L"
+	}
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{OrientationStr: orientation, UnitStr: "mm", Size: utils.PageSizes[opts.PageSize]})
+	pdf.SetMargins(opts.Margin, opts.Margin, opts.Margin)
+	pdf.SetAutoPageBreak(false, 0)
+	if opts.Title != "" {
+		pdf.SetTitle(opts.Title, true)
+	}
+	pageW, pageH := pdf.GetPageSize()
+
+	w := &writer{
+		pdf:    pdf,
+		opts:   opts,
+		images: images,
+		placed: map[string][2]float64{},
+		loaded: map[string]bool{},
+		top:    opts.Margin,
+		bottom: pageH - opts.Margin,
+		left:   opts.Margin,
+		right:  pageW - opts.Margin,
+		color:  textColor,
+	}
+	w.newPage()
+	return w
+}
+
+func (w *writer) output(out io.Writer) error {
+	if err := w.pdf.Error(); err != nil {
+		return err
+	}
+	return w.pdf.Output(out)
+}
+
+func (w *writer) newPage() {
+	w.pdf.AddPage()
+	w.y = w.top
+}
+
+// useFont selects a font, adding it to the document on first use
+func (w *writer) useFont(family, style string, size float64) {
+	if !w.loaded[family+style] {
+		w.pdf.AddUTF8FontFromBytes(family, style, fonts[family][style])
+		w.loaded[family+style] = true
+	}
+	w.pdf.SetFont(family, style, size)
+}
+
+// setFont selects the font of a span and returns its size in points
+func (w *writer) setFont(s span, ts textStyle) float64 {
+	family, size := w.opts.Font, ts.size
+	if s.code {
+		if family != "mono" {
+			size *= 0.9
+		}
+		family = "mono"
+	}
+	style := ""
+	if s.bold || ts.bold {
+		style += "B"
+	}
+	if s.italic {
+		style += "I"
+	}
+	w.useFont(family, style, size)
+	return size
+}
+
+func setTextColor(pdf *gofpdf.Fpdf, c color) { pdf.SetTextColor(c[0], c[1], c[2]) }
+func setDrawColor(pdf *gofpdf.Fpdf, c color) { pdf.SetDrawColor(c[0], c[1], c[2]) }
+func setFillColor(pdf *gofpdf.Fpdf, c color) { pdf.SetFillColor(c[0], c[1], c[2]) }
+
+// lineHeight returns the height in millimetres of a line of type in size
+// points
+func lineHeight(size float64) float64 {
+	return size * ptToMM * lineSpacing
+}
+
+// baseline returns the offset of the baseline from the top of a line of
+// type in size points, centring capitals on the line
+func baseline(size float64) float64 {
+	return lineHeight(size)/2 + size*ptToMM*0.35
+}
+
+// newLine reserves a line of height h, starting a new page when it does
+// not fit, and returns its top. The bars of enclosing quotes and a pending
+// list marker, on the given baseline, are drawn along with it.
+func (w *writer) newLine(h, base float64) float64 {
+	if w.y+h > w.bottom && w.y > w.top {
+		w.newPage()
+	}
+	top := w.y
+	w.bars(top, h)
+	if w.marker != nil {
+		w.useFont(w.marker.family, "", w.opts.FontSize)
+		setTextColor(w.pdf, w.color)
+		w.pdf.Text(w.marker.x, top+base, w.marker.text)
+		w.marker = nil
+	}
+	w.y += h
+	return top
+}
+
+// space adds vertical space, unless at the top of a page
+func (w *writer) space(h float64) {
+	if w.y <= w.top || h == 0 {
+		return
+	}
+	if w.y+h > w.bottom {
+		w.newPage()
+		return
+	}
+	w.bars(w.y, h)
+	w.y += h
+}
+
+// bars draws the bars of enclosing block quotes next to a line
+func (w *writer) bars(top, h float64) {
+	setFillColor(w.pdf, ruleColor)
+	for _, x := range w.quoteBars {
+		w.pdf.Rect(x, top, 0.8, h, "F")
+	}
+}
+
+// gap returns the space between two consecutive blocks
+func (w *writer) gap(prev, next block) float64 {
+	lh := lineHeight(w.opts.FontSize)
+	switch next.(type) {
+	case textLine, pageBreak:
+		return 0
+	case heading:
+		return lh * 1.1
+	}
+	if _, ok := prev.(heading); ok {
+		return lh * 0.4
+	}
+	if w.lists > 0 {
+		return lh * 0.3
+	}
+	return lh * 0.7
+}
+
+func (w *writer) blocks(blocks []block) error {
+	body := textStyle{size: w.opts.FontSize}
+	for i, b := range blocks {
+		if i > 0 {
+			w.space(w.gap(blocks[i-1], b))
+		}
+		switch b := b.(type) {
+		case heading:
+			w.heading(b)
+		case paragraph:
+			w.paragraph(b.text, body)
+		case textLine:
+			w.textLine(b.text)
+		case list:
+			if err := w.list(b); err != nil {
+				return err
+			}
+		case codeBlock:
+			w.code(b)
+		case table:
+			w.table(b)
+		case imageBlock:
+			if err := w.image(b); err != nil {
+				return err
+			}
+		case quote:
+			left, c := w.left, w.color
+			w.quoteBars = append(w.quoteBars, w.left)
+			w.left += w.opts.FontSize * ptToMM * 1.1
+			w.color = quoteTextColor
+			err := w.blocks(b.blocks)
+			w.quoteBars = w.quoteBars[:len(w.quoteBars)-1]
+			w.left, w.color = left, c
+			if err != nil {
+				return err
+			}
+		case rule:
+			h := lineHeight(w.opts.FontSize)
+			top := w.newLine(h, baseline(w.opts.FontSize))
+			setDrawColor(w.pdf, ruleColor)
+			w.pdf.SetLineWidth(0.3)
+			w.pdf.Line(w.left, top+h/2, w.right, top+h/2)
+		case pageBreak:
+			if w.y > w.top {
+				w.newPage()
+			}
+		}
+	}
+	return nil
+}
+
+func (w *writer) heading(h heading) {
+	ts := textStyle{size: w.opts.FontSize * headingScales[h.level-1], bold: true}
+	lh := lineHeight(ts.size)
+	lines := w.wrap(h.text, ts, w.right-w.left)
+
+	// Keep the heading with the first lines of what follows
+	if w.y+float64(len(lines))*lh+2*lineHeight(w.opts.FontSize) > w.bottom && w.y > w.top {
+		w.newPage()
+	}
+	for _, line := range lines {
+		top := w.newLine(lh, baseline(ts.size))
+		w.drawLine(line, w.left, top+baseline(ts.size), ts)
+	}
+	if h.level <= 2 {
+		setDrawColor(w.pdf, ruleColor)
+		w.pdf.SetLineWidth(0.3)
+		w.pdf.Line(w.left, w.y+0.5, w.right, w.y+0.5)
+		w.y += 1
+	}
+}
+
+func (w *writer) paragraph(spans []span, ts textStyle) {
+	lh, base := lineHeight(ts.size), baseline(ts.size)
+	for _, line := range w.wrap(spans, ts, w.right-w.left) {
+		top := w.newLine(lh, base)
+		w.drawLine(line, w.left, top+base, ts)
+	}
+}
+
+// textLine lays out a line of plain text, wrapping it at spaces where
+// possible
+func (w *writer) textLine(text string) {
+	size := w.opts.FontSize
+	lh, base := lineHeight(size), baseline(size)
+	w.useFont(w.opts.Font, "", size)
+	for _, line := range w.wrapRunes(text, w.right-w.left, true) {
+		top := w.newLine(lh, base)
+		setTextColor(w.pdf, w.color)
+		w.pdf.Text(w.left, top+base, line)
+	}
+}
+
+func (w *writer) list(l list) error {
+	depth := w.lists
+	w.lists++
+	size := w.opts.FontSize
+	s := size * ptToMM
+
+	// Numbers are right aligned in the indentation
+	indent := s * 2
+	if l.ordered {
+		w.useFont(w.opts.Font, "", size)
+		widest := w.pdf.GetStringWidth(strconv.Itoa(l.start+len(l.items)-1) + ".")
+		indent = max(indent, widest+s*0.6)
+	}
+	left := w.left
+	w.left += indent
+
+	var err error
+	for i, item := range l.items {
+		if i > 0 {
+			w.space(lineHeight(size) * 0.3)
+		}
+		m := &marker{text: bullets[depth%len(bullets)], family: "sans"}
+		switch {
+		case item.task:
+			m.text = taskBoxes[item.done]
+		case l.ordered:
+			m.text, m.family = fmt.Sprintf("%d.", l.start+i), w.opts.Font
+		}
+		w.useFont(m.family, "", size)
+		m.x = w.left - s*0.6 - w.pdf.GetStringWidth(m.text)
+		w.marker = m
+
+		if len(item.blocks) == 0 {
+			w.newLine(lineHeight(size), baseline(size))
+		} else if err = w.blocks(item.blocks); err != nil {
+			break
+		}
+		w.marker = nil
+	}
+	w.left = left
+	w.lists--
+	return err
+}
+
+// code lays out a code block on a shaded background, wrapping long lines
+// between characters
+func (w *writer) code(c codeBlock) {
+	size := w.opts.FontSize
+	if w.opts.Font != "mono" {
+		size *= 0.9
+	}
+	s := size * ptToMM
+	lh, pad := lineHeight(size), s*0.6
+	w.useFont("mono", "", size)
+
+	var lines []string
+	for _, line := range c.lines {
+		lines = append(lines, w.wrapRunes(line, w.right-w.left-2*pad, false)...)
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+
+	// The padding above and below belongs to the first and last line
+	for i, line := range lines {
+		h, base := lh, baseline(size)
+		if i == 0 {
+			h, base = h+pad, base+pad
+		}
+		if i == len(lines)-1 {
+			h += pad
+		}
+		top := w.newLine(h, base)
+		setFillColor(w.pdf, codeBackground)
+		w.pdf.Rect(w.left, top, w.right-w.left, h, "F")
+		w.useFont("mono", "", size)
+		setTextColor(w.pdf, w.color)
+		w.pdf.Text(w.left+pad, top+base, line)
+	}
+}
+
+// tableRow is a table row broken into lines per cell
+type tableRow struct {
+	cells  [][][]piece
+	height float64
+}
+
+// table lays out a table with columns as wide as their content where the
+// page allows. The header row is repeated after a page break.
+func (w *writer) table(t table) {
+	body := textStyle{size: w.opts.FontSize}
+	head := textStyle{size: w.opts.FontSize, bold: true}
+	s := body.size * ptToMM
+	padX, padY := s*0.5, s*0.25
+	lh := lineHeight(body.size)
+
+	// Columns shrink from their natural width down to their longest word
+	n := len(t.header)
+	lo, hi := make([]float64, n), make([]float64, n)
+	measure := func(j int, cell []span, ts textStyle) {
+		natural, longest := w.measure(cell, ts)
+		lo[j] = max(lo[j], longest+2*padX)
+		hi[j] = max(hi[j], natural+2*padX)
+	}
+	for j, cell := range t.header {
+		measure(j, cell, head)
+	}
+	for _, row := range t.rows {
+		for j, cell := range row {
+			measure(j, cell, body)
+		}
+	}
+	widths := columnWidths(lo, hi, w.right-w.left)
+
+	layout := func(cells [][]span, ts textStyle) tableRow {
+		row := tableRow{cells: make([][][]piece, n)}
+		lines := 1
+		for j, cell := range cells {
+			row.cells[j] = w.wrap(cell, ts, widths[j]-2*padX)
+			lines = max(lines, len(row.cells[j]))
+		}
+		row.height = float64(lines)*lh + 2*padY
+		return row
+	}
+	draw := func(row tableRow, ts textStyle, shade bool) {
+		top := w.newLine(row.height, padY+baseline(ts.size))
+		x := w.left
+		for j, width := range widths {
+			if shade {
+				setFillColor(w.pdf, headerBackground)
+				w.pdf.Rect(x, top, width, row.height, "F")
+			}
+			setDrawColor(w.pdf, ruleColor)
+			w.pdf.SetLineWidth(0.2)
+			w.pdf.Rect(x, top, width, row.height, "D")
+			for k, line := range row.cells[j] {
+				lineW := 0.0
+				for _, p := range line {
+					lineW += p.width
+				}
+				lx := x + padX
+				switch t.align[j] {
+				case "center":
+					lx = x + (width-lineW)/2
+				case "right":
+					lx = x + width - padX - lineW
+				}
+				w.drawLine(line, lx, top+padY+float64(k)*lh+baseline(ts.size), ts)
+			}
+			x += width
+		}
+	}
+
+	header := layout(t.header, head)
+	rows := make([]tableRow, len(t.rows))
+	for i, cells := range t.rows {
+		rows[i] = layout(cells, body)
+	}
+
+	// Keep the header with the first row
+	first := header.height
+	if len(rows) > 0 {
+		first += rows[0].height
+	}
+	if w.y+first > w.bottom && w.y > w.top {
+		w.newPage()
+	}
+	draw(header, head, true)
+	for _, row := range rows {
+		if w.y+row.height > w.bottom && w.y > w.top {
+			w.newPage()
+			draw(header, head, true)
+		}
+		draw(row, body, false)
+	}
+}
+
+// columnWidths fits columns with the given least and natural widths into
+// width. Columns narrower than an equal share of the room keep their
+// natural width; the others share what is left beyond their least widths
+// in proportion to what each is short of.
+func columnWidths(lo, hi []float64, width float64) []float64 {
+	widths := make([]float64, len(lo))
+	open := len(lo)
+	for changed := true; changed && open > 0; {
+		changed = false
+		share := width / float64(open)
+		for j := range widths {
+			if widths[j] == 0 && hi[j] <= share {
+				widths[j] = hi[j]
+				width -= hi[j]
+				open--
+				changed = true
+			}
+		}
+	}
+
+	var sumLo, sumHi float64
+	for j := range widths {
+		if widths[j] == 0 {
+			sumLo += lo[j]
+			sumHi += hi[j]
+		}
+	}
+	for j := range widths {
+		switch {
+		case widths[j] > 0:
+		case sumLo >= width:
+			// Even the longest words do not fit and are broken
+			widths[j] = lo[j] * width / sumLo
+		default:
+			widths[j] = lo[j] + (width-sumLo)*(hi[j]-lo[j])/(sumHi-sumLo)
+		}
+	}
+	return widths
+}
+
+// image places an uploaded image, scaled down to fit the column and page.
+// Images on the web are not fetched; their alternative text is shown.
+func (w *writer) image(img imageBlock) error {
+	if strings.Contains(img.src, "://") {
+		alt := img.alt
+		if alt == "" {
+			alt = img.src
+		}
+		w.paragraph([]span{{text: alt, italic: true, link: img.src}}, textStyle{size: w.opts.FontSize})
+		return nil
+	}
+
+	name := path.Base(img.src)
+	size, ok := w.placed[name]
+	if !ok {
+		data, ok := w.images[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrMissingImage, img.src)
+		}
+		imgW, imgH, err := utils.RegisterImage(w.pdf, "image:"+name, data, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		size = [2]float64{imgW, imgH}
+		w.placed[name] = size
+	}
+
+	scale := min(1, (w.right-w.left)/size[0], (w.bottom-w.top)/size[1])
+	imgW, imgH := size[0]*scale, size[1]*scale
+	top := w.newLine(imgH, baseline(w.opts.FontSize))
+	w.pdf.ImageOptions("image:"+name, w.left, top, imgW, imgH, false, gofpdf.ImageOptions{}, 0, "")
+	return nil
+}
+
+// words splits spans into words. Spaces in code spans are kept, others
+// collapse.
+func (w *writer) words(spans []span, ts textStyle) []word {
+	var words []word
+	var cur word
+	var gap *piece
+	flush := func() {
+		if len(cur.pieces) > 0 {
+			cur.gap = gap
+			words = append(words, cur)
+			gap = nil
+		}
+		cur = word{}
+	}
+
+	for _, s := range spans {
+		if s.image != nil {
+			// Images in headings and table cells show as their text
+			s = span{text: s.image.alt, italic: true, link: s.link}
+		}
+		if s.text == "\n" {
+			flush()
+			words = append(words, word{brk: true})
+			gap = nil
+			continue
+		}
+		w.setFont(s, ts)
+		spaceW := w.pdf.GetStringWidth(" ")
+		for i, part := range strings.Split(s.text, " ") {
+			if i > 0 {
+				flush()
+				switch {
+				case gap == nil:
+					space := s
+					space.text = " "
+					gap = &piece{span: space, width: spaceW}
+				case s.code:
+					gap.text += " "
+					gap.width += spaceW
+				}
+			}
+			if part != "" {
+				p := piece{span: s, width: w.pdf.GetStringWidth(part)}
+				p.text = part
+				cur.pieces = append(cur.pieces, p)
+				cur.width += p.width
+			}
+		}
+	}
+	flush()
+	return words
+}
+
+// measure returns the width of the widest line of spans laid out without
+// wrapping, and the width of their longest word
+func (w *writer) measure(spans []span, ts textStyle) (natural, longest float64) {
+	var lineW float64
+	for _, wd := range w.words(spans, ts) {
+		if wd.brk {
+			natural, lineW = max(natural, lineW), 0
+			continue
+		}
+		if lineW > 0 && wd.gap != nil {
+			lineW += wd.gap.width
+		}
+		lineW += wd.width
+		longest = max(longest, wd.width)
+	}
+	return max(natural, lineW), longest
+}
+
+// wrap breaks spans into lines no wider than width
+func (w *writer) wrap(spans []span, ts textStyle, width float64) [][]piece {
+	var lines [][]piece
+	var line []piece
+	var lineW float64
+	newLine := func() {
+		lines = append(lines, line)
+		line, lineW = nil, 0
+	}
+	// Text measured to fit exactly must not be broken by rounding
+	width += 1e-6
+
+	for _, wd := range w.words(spans, ts) {
+		if wd.brk {
+			newLine()
+			continue
+		}
+		var gapW float64
+		if len(line) > 0 && wd.gap != nil {
+			gapW = wd.gap.width
+		}
+		if len(line) > 0 && lineW+gapW+wd.width > width {
+			newLine()
+			gapW = 0
+		}
+		if gapW > 0 {
+			line = append(line, *wd.gap)
+			lineW += gapW
+		}
+		if lineW+wd.width <= width {
+			line = append(line, wd.pieces...)
+			lineW += wd.width
+			continue
+		}
+
+		// Words wider than a line are broken between characters
+		for _, p := range wd.pieces {
+			w.setFont(p.span, ts)
+			start := 0
+			for i, r := range p.text {
+				runeW := w.pdf.GetStringWidth(string(r))
+				if lineW+runeW > width && (len(line) > 0 || i > start) {
+					if i > start {
+						q := p
+						q.text = p.text[start:i]
+						q.width = w.pdf.GetStringWidth(q.text)
+						line = append(line, q)
+					}
+					newLine()
+					start = i
+				}
+				lineW += runeW
+			}
+			q := p
+			q.text = p.text[start:]
+			q.width = w.pdf.GetStringWidth(q.text)
+			line = append(line, q)
+		}
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		newLine()
+	}
+	return lines
+}
+
+// wrapRunes breaks a line of text in the current font into lines no wider
+// than width, after the last space that fits if atSpaces is set and
+// otherwise between any two characters
+func (w *writer) wrapRunes(text string, width float64, atSpaces bool) []string {
+	var lines []string
+	start, lastSpace := 0, -1
+	var lineW float64
+	for i, r := range text {
+		runeW := w.pdf.GetStringWidth(string(r))
+		if lineW+runeW > width && i > start {
+			end := i
+			if atSpaces && lastSpace > start {
+				end = lastSpace
+			}
+			lines = append(lines, strings.TrimRight(text[start:end], " "))
+			start, lastSpace = end, -1
+			lineW = w.pdf.GetStringWidth(text[start:i])
+		}
+		if atSpaces && r == ' ' && i == start && len(lines) > 0 {
+			// Spaces at a break are dropped with it
+			start++
+			continue
+		}
+		lineW += runeW
+		if r == ' ' {
+			lastSpace = i + 1
+		}
+	}
+	return append(lines, text[start:])
+}
+
+// drawLine draws a line of pieces from x on the given baseline
+func (w *writer) drawLine(line []piece, x, base float64, ts textStyle) {
+	for _, p := range line {
+		s := w.setFont(p.span, ts) * ptToMM
+		c := w.color
+		if p.link != "" {
+			c = linkColor
+		}
+		if p.code && strings.TrimSpace(p.text) != "" {
+			setFillColor(w.pdf, codeBackground)
+			w.pdf.Rect(x, base-s*0.85, p.width, s*1.1, "F")
+		}
+		setTextColor(w.pdf, c)
+		w.pdf.Text(x, base, p.text)
+
+		setDrawColor(w.pdf, c)
+		w.pdf.SetLineWidth(s * 0.06)
+		if p.link != "" {
+			w.pdf.Line(x, base+s*0.15, x+p.width, base+s*0.15)
+			w.pdf.LinkString(x, base-s*0.85, p.width, s*1.1, p.link)
+		}
+		if p.strike {
+			w.pdf.Line(x, base-s*0.3, x+p.width, base-s*0.3)
+		}
+		x += p.width
+	}
+}
@@ -0,0 +1,615 @@
+package textpdf
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Blocks of a document
+type (
+	heading struct {
+		level int
+		text  []span
+	}
+	paragraph struct {
+		text []span
+	}
+	list struct {
+		ordered bool
+		start   int
+		items   []listItem
+	}
+	listItem struct {
+		task, done bool
+		blocks     []block
+	}
+	codeBlock struct {
+		lines []string
+	}
+	table struct {
+		align  []string // left, center or right per column
+		header [][]span
+		rows   [][][]span
+	}
+	imageBlock struct {
+		alt, src string
+	}
+	quote struct {
+		blocks []block
+	}
+	rule      struct{}
+	pageBreak struct{}
+
+	// textLine is a line of plain text, wrapped but otherwise kept as is
+	textLine struct {
+		text string
+	}
+)
+
+type block any
+
+// span is a run of text in one style. A span with text "\n" is a line
+// break, one with an image is an image in running text.
+type span struct {
+	text                       string
+	bold, italic, code, strike bool
+	link                       string
+	image                      *imageBlock
+}
+
+var (
+	fenceRe     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	headingRe   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleRe      = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	quoteRe     = regexp.MustCompile(`^ {0,3}> ?`)
+	listItemRe  = regexp.MustCompile(`^( {0,3})([-*+]|(\d{1,9})[.)])(?:( +)(.*))?$`)
+	taskRe      = regexp.MustCompile(`^\[([ xX])\](?: +|$)`)
+	delimRowRe  = regexp.MustCompile(`^ {0,3}\|?(?:[ \t]*:?-+:?[ \t]*\|)*[ \t]*:?-+:?[ \t]*\|?[ \t]*$`)
+	setextRe    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	autolinkRe  = regexp.MustCompile(`^<((?:https?|ftp|mailto):[^\s<>]+)>`)
+	linkTailRe  = regexp.MustCompile(`^\(\s*<?([^\s()<>]*(?:\([^\s()]*\)[^\s()<>]*)*)>?(?:\s+(?:"[^"]*"|'[^']*'))?\s*\)`)
+	markdownEsc = "\\`*_{}[]()#+-.!|>~<\""
+)
+
+// parseMarkdown parses the block structure of a Markdown document:
+// headings, paragraphs, nested lists with task items, fenced and indented
+// code blocks, tables, block quotes, rules and images
+func parseMarkdown(src string) []block {
+	return parseBlocks(splitLines(src))
+}
+
+// splitLines splits text into lines with tabs expanded
+func splitLines(src string) []string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	lines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	return lines
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of four
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+func parseBlocks(lines []string) []block {
+	var blocks []block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case fenceRe.MatchString(line):
+			var code codeBlock
+			code, i = parseFence(lines, i)
+			blocks = append(blocks, code)
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			blocks = append(blocks, heading{level: len(m[1]), text: parseInline(m[2])})
+			i++
+		case ruleRe.MatchString(line):
+			blocks = append(blocks, rule{})
+			i++
+		case quoteRe.MatchString(line):
+			var inner []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				inner = append(inner, quoteRe.ReplaceAllString(lines[i], ""))
+			}
+			blocks = append(blocks, quote{blocks: parseBlocks(inner)})
+		case listItemRe.MatchString(line):
+			var l list
+			l, i = parseList(lines, i)
+			blocks = append(blocks, l)
+		case indent(line) >= 4:
+			var code codeBlock
+			for ; i < len(lines) && (indent(lines[i]) >= 4 || strings.TrimSpace(lines[i]) == ""); i++ {
+				code.lines = append(code.lines, strings.TrimPrefix(lines[i], "    "))
+			}
+			// Trailing blank lines belong between blocks
+			for len(code.lines) > 0 && strings.TrimSpace(code.lines[len(code.lines)-1]) == "" {
+				code.lines = code.lines[:len(code.lines)-1]
+			}
+			blocks = append(blocks, code)
+		case i+1 < len(lines) && strings.Contains(line, "|") && delimRowRe.MatchString(lines[i+1]) &&
+			len(splitRow(line)) == len(splitRow(lines[i+1])):
+			var t table
+			t, i = parseTable(lines, i)
+			blocks = append(blocks, t)
+		default:
+			var b []block
+			b, i = parseParagraph(lines, i)
+			blocks = append(blocks, b...)
+		}
+	}
+	return blocks
+}
+
+// indent returns the number of leading spaces of a line
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// startsBlock reports whether a line interrupts a paragraph
+func startsBlock(line string) bool {
+	if m := listItemRe.FindStringSubmatch(line); m != nil {
+		// Only lists starting at 1 interrupt a paragraph, so that a line
+		// starting with a year does not become a list
+		return m[5] != "" && (m[3] == "" || m[3] == "1")
+	}
+	return fenceRe.MatchString(line) || headingRe.MatchString(line) ||
+		ruleRe.MatchString(line) || quoteRe.MatchString(line)
+}
+
+func parseFence(lines []string, i int) (codeBlock, int) {
+	m := fenceRe.FindStringSubmatch(lines[i])
+	fence, pad := m[1], indent(lines[i])
+	var code codeBlock
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" && indent(line) < 4 {
+			return code, i + 1
+		}
+		// Content is unindented by up to the indentation of the fence
+		code.lines = append(code.lines, line[min(pad, indent(line)):])
+	}
+	return code, i
+}
+
+func parseList(lines []string, i int) (list, int) {
+	first := listItemRe.FindStringSubmatch(lines[i])
+	l := list{ordered: first[3] != "", start: 1}
+	if l.ordered {
+		l.start, _ = strconv.Atoi(first[3])
+	}
+	marker := first[2][len(first[2])-1:]
+
+	for i < len(lines) {
+		m := listItemRe.FindStringSubmatch(lines[i])
+		if m == nil || (m[3] != "") != l.ordered || m[2][len(m[2])-1:] != marker {
+			break
+		}
+		// Content is indented to the text after the marker
+		contentIndent := len(m[1]) + len(m[2]) + 1
+		if len(m[4]) > 1 && len(m[4]) <= 4 {
+			contentIndent += len(m[4]) - 1
+		}
+		item := listItem{}
+		text := m[5]
+		if t := taskRe.FindStringSubmatch(text); t != nil {
+			item.task, item.done = true, t[1] != " "
+			text = text[len(t[0]):]
+		}
+		content := []string{text}
+
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line ends the item unless indented content follows
+				j := i + 1
+				for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				if j < len(lines) && indent(lines[j]) >= contentIndent {
+					content = append(content, "")
+					continue
+				}
+				break
+			}
+			if indent(line) >= contentIndent {
+				content = append(content, line[contentIndent:])
+				continue
+			}
+			if listItemRe.MatchString(line) || startsBlock(line) {
+				break
+			}
+			// Lazy continuation of the item's paragraph
+			content = append(content, strings.TrimLeft(line, " "))
+		}
+		item.blocks = parseBlocks(content)
+		l.items = append(l.items, item)
+
+		// Blank lines between items keep the list going
+		j := i
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j < len(lines) && listItemRe.MatchString(lines[j]) && indent(lines[j]) < contentIndent {
+			i = j
+		}
+	}
+	return l, i
+}
+
+func parseTable(lines []string, i int) (table, int) {
+	header := splitRow(lines[i])
+	var t table
+	for _, cell := range splitRow(lines[i+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			t.align = append(t.align, "center")
+		case strings.HasSuffix(cell, ":"):
+			t.align = append(t.align, "right")
+		default:
+			t.align = append(t.align, "left")
+		}
+	}
+	for _, cell := range header {
+		t.header = append(t.header, parseInline(cell))
+	}
+	for i += 2; i < len(lines) && strings.TrimSpace(lines[i]) != "" && !startsBlock(lines[i]); i++ {
+		cells := splitRow(lines[i])
+		row := make([][]span, len(header))
+		for j := range row {
+			if j < len(cells) {
+				row[j] = parseInline(cells[j])
+			}
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t, i
+}
+
+// splitRow splits a table row into its trimmed cells. Escaped pipes and
+// pipes in code spans do not separate cells.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			inCode = !inCode
+			cell.WriteByte(c)
+		case c == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// parseParagraph reads a paragraph, or a setext heading, starting at line
+// i. Images in the paragraph are split off as blocks of their own.
+func parseParagraph(lines []string, i int) ([]block, int) {
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" || (len(text) > 0 && startsBlock(line)) {
+			break
+		}
+		if len(text) > 0 && setextRe.MatchString(line) {
+			level := 1
+			if strings.TrimSpace(line)[0] == '-' {
+				level = 2
+			}
+			return []block{heading{level: level, text: parseInline(strings.Join(text, "\n"))}}, i + 1
+		}
+		if i+1 < len(lines) && strings.Contains(lines[i+1], "|") && delimRowRe.MatchString(lines[i+1]) &&
+			strings.Contains(line, "|") && len(text) > 0 {
+			break
+		}
+		text = append(text, line)
+	}
+
+	// Lines end in a hard break with two trailing spaces or a backslash
+	var src strings.Builder
+	for j, line := range text {
+		line = strings.TrimLeft(line, " ")
+		if j < len(text)-1 {
+			switch {
+			case strings.HasSuffix(line, "  "):
+				line = strings.TrimRight(line, " ") + "\x00"
+			case strings.HasSuffix(line, "\\"):
+				line = strings.TrimSuffix(line, "\\") + "\x00"
+			default:
+				line = strings.TrimRight(line, " ") + " "
+			}
+		}
+		src.WriteString(line)
+	}
+
+	var blocks []block
+	var spans []span
+	for _, s := range parseInline(strings.TrimSpace(src.String())) {
+		if s.image == nil {
+			spans = append(spans, s)
+			continue
+		}
+		if trimSpans(spans) != nil {
+			blocks = append(blocks, paragraph{text: trimSpans(spans)})
+		}
+		blocks = append(blocks, *s.image)
+		spans = nil
+	}
+	if trimSpans(spans) != nil {
+		blocks = append(blocks, paragraph{text: trimSpans(spans)})
+	}
+	return blocks, i
+}
+
+// trimSpans drops leading and trailing white space, or returns nil if
+// nothing else is left
+func trimSpans(spans []span) []span {
+	for len(spans) > 0 && strings.TrimSpace(spans[0].text) == "" {
+		spans = spans[1:]
+	}
+	for len(spans) > 0 && strings.TrimSpace(spans[len(spans)-1].text) == "" {
+		spans = spans[:len(spans)-1]
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	spans[0].text = strings.TrimLeft(spans[0].text, " ")
+	spans[len(spans)-1].text = strings.TrimRight(spans[len(spans)-1].text, " ")
+	return spans
+}
+
+// parseInline parses emphasis, strong emphasis, strikethrough, code spans,
+// links, autolinks, images and backslash escapes. A "\x00" in s marks a
+// hard line break.
+func parseInline(s string) []span {
+	p := inlineParser{}
+	p.parse(s, span{})
+	p.flush()
+	return p.spans
+}
+
+type inlineParser struct {
+	spans []span
+	cur   span
+	text  strings.Builder
+}
+
+// flush ends the current run of text
+func (p *inlineParser) flush() {
+	if p.text.Len() > 0 {
+		s := p.cur
+		s.text = p.text.String()
+		p.spans = append(p.spans, s)
+		p.text.Reset()
+	}
+}
+
+// setStyle starts a new run of text in style s
+func (p *inlineParser) setStyle(s span) {
+	p.flush()
+	p.cur = s
+}
+
+func (p *inlineParser) parse(s string, style span) {
+	p.setStyle(style)
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+		switch {
+		case c == 0:
+			p.flush()
+			p.spans = append(p.spans, span{text: "\n"})
+			i++
+			continue
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(markdownEsc, s[i+1]) >= 0:
+			p.text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := len(rest) - len(strings.TrimLeft(rest, "`"))
+			ticks := rest[:n]
+			if end := strings.Index(rest[n:], ticks); end >= 0 {
+				code := strings.ReplaceAll(rest[n:n+end], "\x00", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				saved := p.cur
+				styled := saved
+				styled.code = true
+				p.setStyle(styled)
+				p.text.WriteString(code)
+				p.setStyle(saved)
+				i += n + end + n
+				continue
+			}
+			p.text.WriteString(ticks)
+			i += n
+			continue
+		case c == '!' && strings.HasPrefix(rest, "!["):
+			if alt, src, n, ok := parseLink(rest[1:]); ok {
+				p.flush()
+				p.spans = append(p.spans, span{image: &imageBlock{alt: plainText(alt), src: src}})
+				i += 1 + n
+				continue
+			}
+		case c == '[':
+			if text, url, n, ok := parseLink(rest); ok {
+				saved := p.cur
+				linked := saved
+				linked.link = url
+				p.parse(text, linked)
+				p.setStyle(saved)
+				i += n
+				continue
+			}
+		case c == '<':
+			if m := autolinkRe.FindStringSubmatch(rest); m != nil {
+				saved := p.cur
+				linked := saved
+				linked.link = m[1]
+				p.setStyle(linked)
+				p.text.WriteString(strings.TrimPrefix(m[1], "mailto:"))
+				p.setStyle(saved)
+				i += len(m[0])
+				continue
+			}
+		case c == '*' || c == '_' || c == '~':
+			n := len(rest) - len(strings.TrimLeft(rest, string(c)))
+			run := rest[:n]
+			if p.delimiter(s, i, run) {
+				i += n
+				continue
+			}
+			p.text.WriteString(run)
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		p.text.WriteString(rest[:size])
+		i += size
+	}
+}
+
+// delimiter toggles the styles of an emphasis or strikethrough run at s[i:]
+// and reports whether it did
+func (p *inlineParser) delimiter(s string, i int, run string) bool {
+	before, after := ' ', ' '
+	if i > 0 {
+		before, _ = utf8.DecodeLastRuneInString(s[:i])
+	}
+	if i+len(run) < len(s) {
+		after, _ = utf8.DecodeRuneInString(s[i+len(run):])
+	}
+	opening := !unicode.IsSpace(after)
+	closing := !unicode.IsSpace(before)
+	if run[0] == '_' && unicode.IsLetter(before) && unicode.IsLetter(after) {
+		// snake_case words keep their underscores
+		return false
+	}
+
+	style := p.cur
+	switch run {
+	case "~~":
+		if style.strike && closing {
+			style.strike = false
+		} else if opening && strings.Contains(s[i+2:], run) {
+			style.strike = true
+		} else {
+			return false
+		}
+	case "*", "_":
+		if style.italic && closing {
+			style.italic = false
+		} else if opening && strings.Contains(s[i+1:], run) {
+			style.italic = true
+		} else {
+			return false
+		}
+	case "**", "__":
+		if style.bold && closing {
+			style.bold = false
+		} else if opening && strings.Contains(s[i+2:], run) {
+			style.bold = true
+		} else {
+			return false
+		}
+	case "***", "___":
+		if style.bold && style.italic && closing {
+			style.bold, style.italic = false, false
+		} else if opening && strings.Contains(s[i+3:], run) {
+			style.bold, style.italic = true, true
+		} else {
+			return false
+		}
+	default:
+		return false
+	}
+	p.setStyle(style)
+	return true
+}
+
+// parseLink parses "[text](url)" at the start of s and returns the length
+// it takes up
+func parseLink(s string) (text, url string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				m := linkTailRe.FindStringSubmatch(s[i+1:])
+				if m == nil {
+					return "", "", 0, false
+				}
+				return s[1:i], m[1], i + 1 + len(m[0]), true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// plainText returns the text of inline Markdown without its markup
+func plainText(s string) string {
+	var b strings.Builder
+	for _, sp := range parseInline(s) {
+		b.WriteString(sp.text)
+	}
+	return b.String()
+}
+
+// parseText turns plain text into lines, with form feeds as page breaks
+func parseText(src string) []block {
+	var blocks []block
+	for _, line := range splitLines(src) {
+		for j, part := range strings.Split(line, "\f") {
+			if j > 0 {
+				blocks = append(blocks, pageBreak{})
+			}
+			if j == 0 || part != "" {
+				blocks = append(blocks, textLine{text: strings.TrimRight(part, " ")})
+			}
+		}
+	}
+	return blocks
+}
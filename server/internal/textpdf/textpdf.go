@@ -0,0 +1,105 @@
+// Package textpdf lays out plain text and Markdown documents as PDF.
+package textpdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"file-conv/internal/progress"
+	"file-conv/internal/utils"
+)
+
+// ErrMissingImage is returned for an image a Markdown document refers to
+// that was not uploaded
+var ErrMissingImage = errors.New("image was not uploaded")
+
+// Options controls the page and type of a document
+type Options struct {
+	PageSize    string  // a3, a4, a5, letter or legal
+	Orientation string  // portrait or landscape
+	Margin      float64 // in millimetres
+	Font        string  // sans or mono
+	FontSize    float64 // in points
+	Title       string  // document title, for Markdown the first heading takes precedence
+}
+
+// ParseOptions reads the layout options from form values, applying the
+// defaults of A4 portrait, 20mm margins and 11pt type in defaultFont
+func ParseOptions(value func(string) string, defaultFont string) (Options, error) {
+	opts := Options{PageSize: "a4", Orientation: "portrait", Margin: 20, Font: defaultFont, FontSize: 11}
+
+	if v := strings.ToLower(value("pageSize")); v != "" {
+		if _, ok := utils.PageSizes[v]; !ok {
+			return opts, fmt.Errorf("invalid page size %q", v)
+		}
+		opts.PageSize = v
+	}
+	if v := strings.ToLower(value("orientation")); v != "" {
+		if v != "portrait" && v != "landscape" {
+			return opts, fmt.Errorf("invalid orientation %q", v)
+		}
+		opts.Orientation = v
+	}
+	if v := value("margin"); v != "" {
+		margin, err := strconv.ParseFloat(v, 64)
+		if err != nil || margin < 0 || margin > 50 {
+			return opts, fmt.Errorf("invalid margin %q", v)
+		}
+		opts.Margin = margin
+	}
+	if v := strings.ToLower(value("font")); v != "" {
+		if _, ok := fonts[v]; !ok {
+			return opts, fmt.Errorf("invalid font %q", v)
+		}
+		opts.Font = v
+	}
+	if v := value("fontSize"); v != "" {
+		size, err := strconv.ParseFloat(v, 64)
+		if err != nil || size < 6 || size > 36 {
+			return opts, fmt.Errorf("invalid font size %q", v)
+		}
+		opts.FontSize = size
+	}
+	return opts, nil
+}
+
+// TextToPDF writes plain text to w as a PDF. Lines and spaces are kept,
+// long lines wrap and a form feed starts a new page.
+func TextToPDF(ctx context.Context, w io.Writer, src string, opts Options) error {
+	progress.Report(ctx, progress.StageConverting, 0, 0)
+	doc := newWriter(opts, nil)
+	if err := doc.blocks(parseText(src)); err != nil {
+		return err
+	}
+	progress.Report(ctx, progress.StageEncoding, 0, 0)
+	return doc.output(w)
+}
+
+// MarkdownToPDF writes a Markdown document to w as a PDF. Images are taken
+// from images by the base name of their path; images on the web are
+// replaced by their alternative text.
+func MarkdownToPDF(ctx context.Context, w io.Writer, src string, images map[string][]byte, opts Options) error {
+	progress.Report(ctx, progress.StageConverting, 0, 0)
+	blocks := parseMarkdown(src)
+	for _, b := range blocks {
+		if h, ok := b.(heading); ok && h.level == 1 {
+			var title strings.Builder
+			for _, s := range h.text {
+				title.WriteString(s.text)
+			}
+			opts.Title = title.String()
+			break
+		}
+	}
+
+	doc := newWriter(opts, images)
+	if err := doc.blocks(blocks); err != nil {
+		return err
+	}
+	progress.Report(ctx, progress.StageEncoding, 0, 0)
+	return doc.output(w)
+}
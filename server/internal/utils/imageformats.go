@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"file-conv/internal/webp"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp" // registers the WebP decoder with image.Decode
+)
+
+// ImageFormat describes an output format the image handlers can encode to
+type ImageFormat struct {
+	Name        string
+	ContentType string
+	Extension   string
+}
+
+var imageFormats = map[string]ImageFormat{
+	"png":  {Name: "png", ContentType: "image/png", Extension: "png"},
+	"jpeg": {Name: "jpeg", ContentType: "image/jpeg", Extension: "jpg"},
+	"gif":  {Name: "gif", ContentType: "image/gif", Extension: "gif"},
+	"bmp":  {Name: "bmp", ContentType: "image/bmp", Extension: "bmp"},
+	"tiff": {Name: "tiff", ContentType: "image/tiff", Extension: "tiff"},
+	"webp": {Name: "webp", ContentType: "image/webp", Extension: "webp"},
+}
+
+// LookupImageFormat resolves a user supplied format name such as "jpg" or "TIF"
+func LookupImageFormat(name string) (ImageFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "jpg":
+		name = "jpeg"
+	case "tif":
+		name = "tiff"
+	}
+	f, ok := imageFormats[name]
+	if !ok {
+		return ImageFormat{}, fmt.Errorf("unsupported output format %q", name)
+	}
+	return f, nil
+}
+
+// EncodeImage writes img to w in the given format. Quality is only used by
+// lossy encoders and falls back to the encoder default when it is 0.
+func EncodeImage(w io.Writer, img image.Image, format ImageFormat, quality int) error {
+	switch format.Name {
+	case "png":
+		return png.Encode(w, img)
+	case "jpeg":
+		var opts *jpeg.Options
+		if quality > 0 {
+			opts = &jpeg.Options{Quality: quality}
+		}
+		return jpeg.Encode(w, img, opts)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	case "bmp":
+		return bmp.Encode(w, img)
+	case "tiff":
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+	case "webp":
+		return webp.Encode(w, img)
+	}
+	return fmt.Errorf("unsupported output format %q", format.Name)
+}
+
+// ImageFormatNames returns the canonical names of the supported formats
+func ImageFormatNames() []string {
+	names := make([]string, 0, len(imageFormats))
+	for name := range imageFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ImageContentTypes returns the MIME types of the supported formats
+func ImageContentTypes() []string {
+	var types []string
+	for _, name := range ImageFormatNames() {
+		types = append(types, imageFormats[name].ContentType)
+	}
+	return types
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"file-conv/internal/progress"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Images are laid out at 96 pixels per inch
+const pixelsPerMM = 96 / 25.4
+
+// ErrInvalidImage is returned for uploaded data that is not an image
+var ErrInvalidImage = errors.New("failed to decode image")
+
+// PageSizes are the named page sizes in millimetres, portrait
+var PageSizes = map[string]gofpdf.SizeType{
+	"a3":     {Wd: 297, Ht: 420},
+	"a4":     {Wd: 210, Ht: 297},
+	"a5":     {Wd: 148, Ht: 210},
+	"letter": {Wd: 215.9, Ht: 279.4},
+	"legal":  {Wd: 215.9, Ht: 355.6},
+}
+
+// PageLayout controls how images are placed on PDF pages
+type PageLayout struct {
+	Size        string  // a3, a4, a5, letter, legal or fit (page sized to the image)
+	Orientation string  // auto, portrait or landscape
+	Margin      float64 // in millimetres
+	Placement   string  // fit, fill or center
+	JPEGQuality int     // when set, every image is re-encoded as JPEG at this quality
+}
+
+// ParsePageLayout reads the page layout options from form values, applying
+// the defaults of A4, automatic orientation, 10mm margins and fit placement
+func ParsePageLayout(value func(string) string) (PageLayout, error) {
+	layout := PageLayout{Size: "a4", Orientation: "auto", Margin: 10, Placement: "fit"}
+
+	if v := strings.ToLower(value("pageSize")); v != "" {
+		if _, ok := PageSizes[v]; !ok && v != "fit" {
+			return layout, fmt.Errorf("invalid page size %q", v)
+		}
+		layout.Size = v
+	}
+	if v := strings.ToLower(value("orientation")); v != "" {
+		if v != "auto" && v != "portrait" && v != "landscape" {
+			return layout, fmt.Errorf("invalid orientation %q", v)
+		}
+		layout.Orientation = v
+	}
+	if v := value("margin"); v != "" {
+		margin, err := strconv.ParseFloat(v, 64)
+		if err != nil || margin < 0 || margin > 100 {
+			return layout, fmt.Errorf("invalid margin %q", v)
+		}
+		layout.Margin = margin
+	}
+	if v := strings.ToLower(value("placement")); v != "" {
+		if v != "fit" && v != "fill" && v != "center" {
+			return layout, fmt.Errorf("invalid placement %q", v)
+		}
+		layout.Placement = v
+	}
+	if v := value("jpegQuality"); v != "" {
+		quality, err := strconv.Atoi(v)
+		if err != nil || quality < 1 || quality > 100 {
+			return layout, fmt.Errorf("invalid JPEG quality %q", v)
+		}
+		layout.JPEGQuality = quality
+	}
+	return layout, nil
+}
+
+// ImageSource is an uploaded image waiting to be placed on a page
+type ImageSource struct {
+	Name string
+	Data []byte
+}
+
+// ImagesToPDF writes a PDF with one page per image to w
+func ImagesToPDF(ctx context.Context, w io.Writer, images []ImageSource, layout PageLayout) error {
+	// gofpdf omits the MediaBox of pages matching the default size, which
+	// some readers (pdfcpu included) then take from the previous page. A
+	// default no page uses makes every page carry its own MediaBox.
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{UnitStr: "mm", Size: gofpdf.SizeType{Wd: 1, Ht: 1}})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+
+	for i, src := range images {
+		progress.Report(ctx, progress.StagePage, i+1, len(images))
+		if err := addImagePage(pdf, fmt.Sprintf("image%d", i), src, layout); err != nil {
+			return fmt.Errorf("%s: %w", src.Name, err)
+		}
+	}
+	progress.Report(ctx, progress.StageEncoding, 0, 0)
+	return pdf.Output(w)
+}
+
+func addImagePage(pdf *gofpdf.Fpdf, id string, src ImageSource, layout PageLayout) error {
+	imgW, imgH, err := RegisterImage(pdf, id, src.Data, layout.JPEGQuality)
+	if err != nil {
+		return err
+	}
+	placeImage(pdf, id, imgW, imgH, layout)
+	return pdf.Error()
+}
+
+// RegisterImage adds an image to pdf under id, re-encoded as JPEG when
+// jpegQuality is set, and returns its natural size in millimetres. Data
+// that is not an image is reported as ErrInvalidImage.
+func RegisterImage(pdf *gofpdf.Fpdf, id string, data []byte, jpegQuality int) (float64, float64, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, ErrInvalidImage
+	}
+
+	var imgBuf bytes.Buffer
+	var imgType string
+	switch {
+	case jpegQuality > 0:
+		// Flatten transparency onto white, JPEG has no alpha channel
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&imgBuf, flat, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return 0, 0, fmt.Errorf("failed to encode image")
+		}
+		imgType = "JPG"
+	case format == "jpeg":
+		// JPEG data is embedded as is, without another lossy round trip
+		imgBuf.Write(data)
+		imgType = "JPG"
+	default:
+		// Everything else is embedded losslessly as an 8-bit PNG, which
+		// gofpdf stores with its alpha channel as a soft mask
+		nrgba := image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		if err := png.Encode(&imgBuf, nrgba); err != nil {
+			return 0, 0, fmt.Errorf("failed to encode image")
+		}
+		imgType = "PNG"
+	}
+	pdf.RegisterImageOptionsReader(id, gofpdf.ImageOptions{ImageType: imgType}, &imgBuf)
+	if err := pdf.Error(); err != nil {
+		return 0, 0, err
+	}
+
+	imgW := float64(img.Bounds().Dx()) / pixelsPerMM
+	imgH := float64(img.Bounds().Dy()) / pixelsPerMM
+	return imgW, imgH, nil
+}
+
+// placeImage adds a page for an image of the given natural size in
+// millimetres and draws it according to the layout
+func placeImage(pdf *gofpdf.Fpdf, id string, imgW, imgH float64, layout PageLayout) {
+	m := layout.Margin
+
+	var page gofpdf.SizeType
+	if layout.Size == "fit" {
+		page = gofpdf.SizeType{Wd: imgW + 2*m, Ht: imgH + 2*m}
+	} else {
+		page = PageSizes[layout.Size]
+		landscape := layout.Orientation == "landscape" ||
+			(layout.Orientation == "auto" && imgW > imgH)
+		if landscape {
+			page.Wd, page.Ht = page.Ht, page.Wd
+		}
+	}
+	orientation := "P"
+	if page.Wd > page.Ht {
+		orientation = "L"
+		page.Wd, page.Ht = page.Ht, page.Wd
+	}
+	pdf.AddPageFormat(orientation, page)
+	pageW, pageH := pdf.GetPageSize()
+
+	boxW, boxH := pageW-2*m, pageH-2*m
+	scale := 1.0
+	switch layout.Placement {
+	case "fit":
+		scale = min(boxW/imgW, boxH/imgH)
+	case "fill":
+		scale = max(boxW/imgW, boxH/imgH)
+	case "center":
+		// Natural size, shrunk only when it would not fit
+		scale = min(1, boxW/imgW, boxH/imgH)
+	}
+	w, h := imgW*scale, imgH*scale
+	x, y := m+(boxW-w)/2, m+(boxH-h)/2
+
+	if layout.Placement == "fill" {
+		pdf.ClipRect(m, m, boxW, boxH, false)
+		defer pdf.ClipEnd()
+	}
+	pdf.ImageOptions(id, x, y, w, h, false, gofpdf.ImageOptions{}, 0, "")
+}
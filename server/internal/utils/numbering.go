@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NumberTemplate is a parsed page numbering template. Placeholders are
+// written in braces and may carry a printf-style width:
+//
+//	{n}       the running number, counting from the start number
+//	{total}   the last running number
+//	{page}    the physical page number
+//	{pages}   the page count of the document
+//	{prefix}  the prefix form field
+//
+// "{prefix}-{n:06d}" gives Bates numbers such as ACME-000042, and
+// "Page {page} of {pages}" a plain footer.
+type NumberTemplate struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+	field   string // empty for literal text
+	verb    string // e.g. "%06d", unused for the prefix
+}
+
+var templateFields = map[string]bool{"n": true, "total": true, "page": true, "pages": true, "prefix": true}
+
+// NumberValues are the values substituted into a NumberTemplate
+type NumberValues struct {
+	N, Total    int
+	Page, Pages int
+	Prefix      string
+}
+
+// ParseNumberTemplate parses a page numbering template
+func ParseNumberTemplate(tmpl string) (NumberTemplate, error) {
+	var t NumberTemplate
+	rest := tmpl
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return t, fmt.Errorf("unmatched '}' in template %q", tmpl)
+		}
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return t, fmt.Errorf("unmatched '{' in template %q", tmpl)
+		}
+		part, err := parseTemplateField(rest[open+1 : open+end])
+		if err != nil {
+			return t, err
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[open+end+1:]
+	}
+	if len(t.parts) == 0 {
+		return t, fmt.Errorf("empty template")
+	}
+	return t, nil
+}
+
+func parseTemplateField(s string) (templatePart, error) {
+	name, spec, hasSpec := strings.Cut(strings.TrimSpace(s), ":")
+	if !templateFields[name] {
+		return templatePart{}, fmt.Errorf("unknown template field {%s}", s)
+	}
+	part := templatePart{field: name, verb: "%d"}
+	if !hasSpec {
+		return part, nil
+	}
+
+	// Only widths are accepted, e.g. "6d" or "06d"
+	width, ok := strings.CutSuffix(spec, "d")
+	if name == "prefix" || !ok || width == "" {
+		return part, fmt.Errorf("invalid format %q in template field {%s}", spec, s)
+	}
+	if n, err := strconv.Atoi(width); err != nil || n < 1 || n > 20 || strings.HasPrefix(width, "-") {
+		return part, fmt.Errorf("invalid format %q in template field {%s}", spec, s)
+	}
+	part.verb = "%" + width + "d"
+	return part, nil
+}
+
+// Format expands the template with the given values
+func (t NumberTemplate) Format(v NumberValues) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case "n":
+			fmt.Fprintf(&b, p.verb, v.N)
+		case "total":
+			fmt.Fprintf(&b, p.verb, v.Total)
+		case "page":
+			fmt.Fprintf(&b, p.verb, v.Page)
+		case "pages":
+			fmt.Fprintf(&b, p.verb, v.Pages)
+		case "prefix":
+			b.WriteString(v.Prefix)
+		}
+	}
+	return b.String()
+}
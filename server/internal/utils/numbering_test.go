@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNumberTemplateFormat(t *testing.T) {
+	values := NumberValues{N: 42, Total: 120, Page: 3, Pages: 10, Prefix: "ACME"}
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"{prefix}-{n:06d}", "ACME-000042"},
+		{"Page {page} of {pages}", "Page 3 of 10"},
+		{"{n}/{total}", "42/120"},
+		{"{ n }", "42"},
+		{"{page:4d}", "   3"},
+		{"no fields", "no fields"},
+		{"{prefix}{prefix}", "ACMEACME"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseNumberTemplate(tt.tmpl)
+		if err != nil {
+			t.Errorf("ParseNumberTemplate(%q): %v", tt.tmpl, err)
+			continue
+		}
+		if got := tmpl.Format(values); got != tt.want {
+			t.Errorf("%q.Format = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestParseNumberTemplateErrors(t *testing.T) {
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"", "empty template"},
+		{"Page }", "unmatched '}'"},
+		{"} {n}", "unmatched '}'"},
+		{"Page {n", "unmatched '{'"},
+		{"{date}", "unknown template field"},
+		{"{}", "unknown template field"},
+		{"{prefix:6d}", "invalid format"},
+		{"{n:6}", "invalid format"},
+		{"{n:d}", "invalid format"},
+		{"{n:0d}", "invalid format"},
+		{"{n:21d}", "invalid format"},
+		{"{n:-6d}", "invalid format"},
+		{"{n:x6d}", "invalid format"},
+	}
+	for _, tt := range tests {
+		_, err := ParseNumberTemplate(tt.tmpl)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseNumberTemplate(%q) error = %v, want %q", tt.tmpl, err, tt.want)
+		}
+	}
+}
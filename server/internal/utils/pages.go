@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageSelection is a parsed page selection expression. The grammar is a
+// comma-separated list of terms:
+//
+//	7        a single page
+//	2-5      an inclusive range
+//	10-      page 10 to the last page
+//	-3       the first page to page 3
+//	odd      odd pages, likewise even
+//	last     the last page, also usable as a range bound ("5-last")
+//	!3, !2-4 removes pages from every other term
+//
+// A selection made only of negations starts from all pages.
+type PageSelection struct {
+	groups   []pageTerm
+	excluded []pageTerm
+}
+
+type pageTerm struct {
+	text string
+	// from and to are 1-based page numbers; 0 means the document start or
+	// end, and -1 stands for "last"
+	from, to int
+	parity   int // 1 for odd, 2 for even
+}
+
+// PageRangeError reports a selection that does not fit the document
+type PageRangeError struct {
+	Page      int
+	PageCount int
+}
+
+func (e *PageRangeError) Error() string {
+	return fmt.Sprintf("page %d is out of range, the document has %d pages", e.Page, e.PageCount)
+}
+
+// ParsePageSelection parses a page selection expression
+func ParsePageSelection(expr string) (PageSelection, error) {
+	var sel PageSelection
+	for _, raw := range strings.Split(expr, ",") {
+		text := strings.ToLower(strings.TrimSpace(raw))
+		if text == "" {
+			continue
+		}
+		negate := strings.HasPrefix(text, "!")
+		term, err := parsePageTerm(strings.TrimSpace(strings.TrimPrefix(text, "!")))
+		if err != nil {
+			return sel, err
+		}
+		term.text = text
+		if negate {
+			sel.excluded = append(sel.excluded, term)
+		} else {
+			sel.groups = append(sel.groups, term)
+		}
+	}
+	if len(sel.groups) == 0 && len(sel.excluded) == 0 {
+		return sel, fmt.Errorf("empty page selection")
+	}
+	if len(sel.groups) == 0 {
+		sel.groups = []pageTerm{{text: "all"}}
+	}
+	return sel, nil
+}
+
+func parsePageTerm(text string) (pageTerm, error) {
+	switch text {
+	case "odd":
+		return pageTerm{parity: 1}, nil
+	case "even":
+		return pageTerm{parity: 2}, nil
+	case "all":
+		return pageTerm{}, nil
+	}
+
+	from, to, isRange := strings.Cut(text, "-")
+	if !isRange {
+		to = from
+	}
+	var term pageTerm
+	var err error
+	if term.from, err = parsePageBound(from, isRange); err != nil {
+		return term, fmt.Errorf("invalid page selection %q", text)
+	}
+	if term.to, err = parsePageBound(to, isRange); err != nil {
+		return term, fmt.Errorf("invalid page selection %q", text)
+	}
+	if term.from == 0 && term.to == 0 {
+		return term, fmt.Errorf("invalid page selection %q", text)
+	}
+	if term.from > 0 && term.to > 0 && term.from > term.to {
+		return term, fmt.Errorf("invalid page range %q, the start is after the end", text)
+	}
+	return term, nil
+}
+
+func parsePageBound(s string, open bool) (int, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "" && open:
+		return 0, nil
+	case s == "last":
+		return -1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid page number %q", s)
+	}
+	return n, nil
+}
+
+// pages expands the term for a document with pageCount pages
+func (t pageTerm) pages(pageCount int) ([]int, error) {
+	from, to := t.from, t.to
+	if from == 0 {
+		from = 1
+	}
+	if to == 0 {
+		to = pageCount
+	}
+	if from == -1 {
+		from = pageCount
+	}
+	if to == -1 {
+		to = pageCount
+	}
+	for _, p := range []int{from, to} {
+		if p > pageCount {
+			return nil, &PageRangeError{Page: p, PageCount: pageCount}
+		}
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid page range %q, the start is after the end", t.text)
+	}
+
+	var pages []int
+	for p := from; p <= to; p++ {
+		if t.parity == 0 || (p%2 == 1) == (t.parity == 1) {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
+
+// Groups resolves every positive term into its own list of pages, with the
+// negated pages removed. Groups left empty are dropped.
+func (s PageSelection) Groups(pageCount int) ([]PageGroup, error) {
+	excluded := map[int]bool{}
+	for _, t := range s.excluded {
+		pages, err := t.pages(pageCount)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pages {
+			excluded[p] = true
+		}
+	}
+
+	var groups []PageGroup
+	for _, t := range s.groups {
+		pages, err := t.pages(pageCount)
+		if err != nil {
+			return nil, err
+		}
+		group := PageGroup{Label: t.text}
+		for _, p := range pages {
+			if !excluded[p] {
+				group.Pages = append(group.Pages, p)
+			}
+		}
+		if len(group.Pages) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// Pages resolves the selection into a sorted list of distinct pages
+func (s PageSelection) Pages(pageCount int) ([]int, error) {
+	groups, err := s.Groups(pageCount)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]bool, pageCount+1)
+	for _, g := range groups {
+		for _, p := range g.Pages {
+			selected[p] = true
+		}
+	}
+	var pages []int
+	for p := 1; p <= pageCount; p++ {
+		if selected[p] {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
+
+// PageGroup is the pages selected by one term of a selection
+type PageGroup struct {
+	Label string
+	Pages []int
+}
+
+// PageStrings formats the pages the way pdfcpu's page selection expects
+func (g PageGroup) PageStrings() []string {
+	s := make([]string, len(g.Pages))
+	for i, p := range g.Pages {
+		s[i] = strconv.Itoa(p)
+	}
+	return s
+}
+
+// MergeTerm selects pages of one input of a merge
+type MergeTerm struct {
+	File      int // 0-based index of the input
+	Selection PageSelection
+}
+
+// ParseMergeSelection parses per-input page selections such as
+// "file1:1-3, file2:all, file1:4-", where fileN is the Nth uploaded file.
+// Terms without a file prefix belong to the file named before them.
+func ParseMergeSelection(expr string, fileCount int) ([]MergeTerm, error) {
+	var terms []MergeTerm
+	var texts [][]string
+	for _, raw := range strings.Split(expr, ",") {
+		text := strings.ToLower(strings.TrimSpace(raw))
+		if text == "" {
+			continue
+		}
+		if name, sel, found := strings.Cut(text, ":"); found {
+			name = strings.TrimSpace(name)
+			n, err := strconv.Atoi(strings.TrimPrefix(name, "file"))
+			if !strings.HasPrefix(name, "file") || err != nil {
+				return nil, fmt.Errorf("invalid file reference %q, use file1 to file%d", name, fileCount)
+			}
+			if n < 1 || n > fileCount {
+				return nil, fmt.Errorf("file%d does not exist, %d files were uploaded", n, fileCount)
+			}
+			terms = append(terms, MergeTerm{File: n - 1})
+			texts = append(texts, nil)
+			text = sel
+		}
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("page selection %q does not name a file, e.g. file1:%s", text, text)
+		}
+		texts[len(texts)-1] = append(texts[len(texts)-1], text)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty page selection")
+	}
+
+	for i := range terms {
+		sel, err := ParsePageSelection(strings.Join(texts[i], ","))
+		if err != nil {
+			return nil, fmt.Errorf("file%d: %w", terms[i].File+1, err)
+		}
+		terms[i].Selection = sel
+	}
+	return terms, nil
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPageSelectionPages(t *testing.T) {
+	tests := []struct {
+		expr  string
+		count int
+		want  []int
+	}{
+		{"7", 10, []int{7}},
+		{"2-5", 10, []int{2, 3, 4, 5}},
+		{"8-", 10, []int{8, 9, 10}},
+		{"-3", 10, []int{1, 2, 3}},
+		{"odd", 6, []int{1, 3, 5}},
+		{"even", 6, []int{2, 4, 6}},
+		{"last", 10, []int{10}},
+		{"5-last", 7, []int{5, 6, 7}},
+		{"all", 3, []int{1, 2, 3}},
+		{"3,1,3", 5, []int{1, 3}},
+		{" 1 , 4-5 ", 5, []int{1, 4, 5}},
+		{"1-10,!3,!5-6", 10, []int{1, 2, 4, 7, 8, 9, 10}},
+		{"!2", 4, []int{1, 3, 4}},
+		{"!odd", 5, []int{2, 4}},
+		{"ODD", 3, []int{1, 3}},
+		{"1-3,!1-3", 5, nil},
+	}
+	for _, tt := range tests {
+		sel, err := ParsePageSelection(tt.expr)
+		if err != nil {
+			t.Errorf("ParsePageSelection(%q): %v", tt.expr, err)
+			continue
+		}
+		got, err := sel.Pages(tt.count)
+		if err != nil {
+			t.Errorf("%q.Pages(%d): %v", tt.expr, tt.count, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q.Pages(%d) = %v, want %v", tt.expr, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestParsePageSelectionErrors(t *testing.T) {
+	for _, expr := range []string{"", " , ", "0", "x", "3-1", "1-2-3", "-", "1.5", "!", "-0"} {
+		if _, err := ParsePageSelection(expr); err == nil {
+			t.Errorf("ParsePageSelection(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestPageSelectionOutOfRange(t *testing.T) {
+	tests := []struct {
+		expr  string
+		count int
+		page  int
+	}{
+		{"12", 10, 12},
+		{"5-12", 10, 12},
+		{"11-", 10, 11},
+		{"1,!20", 10, 20},
+	}
+	for _, tt := range tests {
+		sel, err := ParsePageSelection(tt.expr)
+		if err != nil {
+			t.Fatalf("ParsePageSelection(%q): %v", tt.expr, err)
+		}
+		_, err = sel.Pages(tt.count)
+		var rangeErr *PageRangeError
+		if !errors.As(err, &rangeErr) || rangeErr.Page != tt.page || rangeErr.PageCount != tt.count {
+			t.Errorf("%q.Pages(%d) error = %v, want page %d out of range", tt.expr, tt.count, err, tt.page)
+		}
+	}
+
+	// "last-" starts after a range ending below it once the count is known
+	sel, err := ParsePageSelection("last-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sel.Pages(5); err == nil {
+		t.Error(`"last-2".Pages(5) succeeded, want an error`)
+	}
+}
+
+func TestPageSelectionGroups(t *testing.T) {
+	sel, err := ParsePageSelection("2-5, 7, 10-, !4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := sel.Groups(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PageGroup{
+		{Label: "2-5", Pages: []int{2, 3, 5}},
+		{Label: "7", Pages: []int{7}},
+		{Label: "10-", Pages: []int{10, 11}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups = %v, want %v", got, want)
+	}
+
+	// Groups emptied by negations are dropped
+	sel, _ = ParsePageSelection("1,2,!2")
+	if got, _ := sel.Groups(3); len(got) != 1 || got[0].Label != "1" {
+		t.Errorf("Groups = %v, want only the group of page 1", got)
+	}
+}
+
+func TestParseMergeSelection(t *testing.T) {
+	terms, err := ParseMergeSelection("file1:1-3, file2:all, 5, file1:4-", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []int{0, 1, 0}
+	wantPages := [][]int{{1, 2, 3}, {1, 2, 3, 4, 5}, {4, 5}}
+	if len(terms) != len(wantFiles) {
+		t.Fatalf("got %d terms, want %d", len(terms), len(wantFiles))
+	}
+	for i, term := range terms {
+		pages, err := term.Selection.Pages(5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if term.File != wantFiles[i] || !reflect.DeepEqual(pages, wantPages[i]) {
+			t.Errorf("term %d = file %d pages %v, want file %d pages %v", i, term.File, pages, wantFiles[i], wantPages[i])
+		}
+	}
+}
+
+func TestParseMergeSelectionErrors(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"", "empty page selection"},
+		{"1-3", "does not name a file"},
+		{"doc1:1", "invalid file reference"},
+		{"file3:1", "file3 does not exist"},
+		{"file0:1", "file0 does not exist"},
+		{"file1:x", "file1: invalid page selection"},
+	}
+	for _, tt := range tests {
+		_, err := ParseMergeSelection(tt.expr, 2)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseMergeSelection(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/color"
@@ -8,8 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
+	"unicode"
 )
 
 func DetectBackgroundColor(img image.Image) color.Color {
@@ -76,49 +76,97 @@ func AbsDiff(a, b uint32) uint32 {
 	return b - a
 }
 
-func ProcessUploadedFiles(r *http.Request, tempDir string) ([]string, error) {
-	var files []string
+// UploadedFile is an input of a merge saved to disk
+type UploadedFile struct {
+	Path string
+	Name string // filename given by the client
+}
+
+// ProcessUploadedFiles saves the files of the "pdfs" and "files" fields for
+// merging, in upload order. Images are converted into one-page PDFs laid out
+// as layout describes.
+func ProcessUploadedFiles(r *http.Request, tempDir string, layout PageLayout) ([]UploadedFile, error) {
+	var files []UploadedFile
 
-	// Get all files from the "pdfs" form field
-	pdfFiles := r.MultipartForm.File["pdfs"]
-	if len(pdfFiles) < 2 {
-		return nil, fmt.Errorf("at least two PDF files are required")
+	fileHeaders := append(r.MultipartForm.File["pdfs"], r.MultipartForm.File["files"]...)
+	if len(fileHeaders) < 2 {
+		return nil, fmt.Errorf("at least two files are required")
 	}
 
-	for _, fileHeader := range pdfFiles {
+	for i, fileHeader := range fileHeaders {
 		file, err := fileHeader.Open()
 		if err != nil {
 			return nil, fmt.Errorf("error opening uploaded file: %v", err)
 		}
-		defer file.Close()
-
-		tempPath := filepath.Join(tempDir, filepath.Base(fileHeader.Filename))
-		outFile, err := os.Create(tempPath)
+		data, err := io.ReadAll(file)
+		file.Close()
 		if err != nil {
-			return nil, fmt.Errorf("error creating temporary file: %v", err)
+			return nil, fmt.Errorf("error reading uploaded file: %v", err)
 		}
-		defer outFile.Close()
 
-		if _, err := io.Copy(outFile, file); err != nil {
+		// Uploads may share a filename, so each gets its own prefix
+		name := filepath.Base(fileHeader.Filename)
+		tempPath := filepath.Join(tempDir, fmt.Sprintf("%03d_%s.pdf", i+1, SafeFilename(name)))
+		switch {
+		case isPDF(data):
+			err = os.WriteFile(tempPath, data, 0o644)
+		default:
+			if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+				return nil, fmt.Errorf("%s is neither a PDF nor a supported image", name)
+			}
+			var buf bytes.Buffer
+			if err := ImagesToPDF(r.Context(), &buf, []ImageSource{{Name: name, Data: data}}, layout); err != nil {
+				return nil, fmt.Errorf("error converting image: %v", err)
+			}
+			err = os.WriteFile(tempPath, buf.Bytes(), 0o644)
+		}
+		if err != nil {
 			return nil, fmt.Errorf("error saving uploaded file: %v", err)
 		}
 
-		files = append(files, tempPath)
+		files = append(files, UploadedFile{Path: tempPath, Name: name})
 	}
 
 	return files, nil
 }
 
-// parsePageRanges converts a comma-separated string of page numbers into a slice of integers
-func ParsePageRanges(pageRanges string) ([]int, error) {
-	var pages []int
-	ranges := strings.Split(pageRanges, ",")
-	for _, r := range ranges {
-		page, err := strconv.Atoi(strings.TrimSpace(r))
-		if err != nil {
-			return nil, err
+// isPDF reports whether data starts with a PDF header, which readers accept
+// anywhere in the first kilobyte
+func isPDF(data []byte) bool {
+	return bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-"))
+}
+
+// SafeFilename replaces everything but letters, digits, dots, dashes and
+// underscores so the result can be used as a file or zip entry name
+func SafeFilename(name string) string {
+	safe := []rune(name)
+	for i, r := range safe {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_') {
+			safe[i] = '_'
 		}
-		pages = append(pages, page)
 	}
-	return pages, nil
+	return string(safe)
+}
+
+// SaveUploadedFile stores the file of the given form field in dir and
+// returns its path and the uploaded filename
+func SaveUploadedFile(r *http.Request, field, dir string) (string, string, error) {
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get uploaded file")
+	}
+	defer file.Close()
+
+	name := filepath.Base(header.Filename)
+	path := filepath.Join(dir, name)
+	outFile, err := os.Create(path)
+	if err != nil {
+		return "", "", fmt.Errorf("error saving uploaded file: %v", err)
+	}
+	defer outFile.Close()
+
+	if _, err := io.Copy(outFile, file); err != nil {
+		return "", "", fmt.Errorf("error saving uploaded file: %v", err)
+	}
+	return path, name, nil
 }
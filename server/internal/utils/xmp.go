@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	nsRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsPDF = "http://ns.adobe.com/pdf/1.3/"
+	nsXMP = "http://ns.adobe.com/xap/1.0/"
+)
+
+type xmpProperty struct {
+	space, local string
+}
+
+// XMP properties holding each info dictionary entry
+var xmpProperties = map[string][]xmpProperty{
+	"Title":    {{nsDC, "title"}},
+	"Author":   {{nsDC, "creator"}},
+	"Subject":  {{nsDC, "description"}},
+	"Keywords": {{nsPDF, "Keywords"}, {nsDC, "subject"}},
+	"Creator":  {{nsXMP, "CreatorTool"}},
+}
+
+// Dates that change with every edit
+var xmpDates = []xmpProperty{{nsXMP, "ModifyDate"}, {nsXMP, "MetadataDate"}}
+
+// NewXMP returns an XMP packet holding the given info dictionary entries.
+// Entries with empty values are left out.
+func NewXMP(props map[string]string, now time.Time) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"" + nsRDF + "\">\n")
+	b.WriteString(xmpDescription(props, now))
+	b.WriteString("</rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+// UpdateXMP replaces the properties of the given info dictionary entries in
+// an XMP packet and refreshes its dates. Everything else in the packet,
+// such as PDF/A identification, is kept as it is.
+func UpdateXMP(packet []byte, props map[string]string, now time.Time) ([]byte, error) {
+	managed := map[xmpProperty]bool{}
+	for key := range props {
+		for _, p := range xmpProperties[key] {
+			managed[p] = true
+		}
+	}
+	for _, p := range xmpDates {
+		managed[p] = true
+	}
+
+	type edit struct {
+		start, end int64
+		text       string
+	}
+	var edits []edit
+	insertAt := int64(-1)
+
+	d := xml.NewDecoder(bytes.NewReader(packet))
+	scopes := []map[string]string{{"xml": "http://www.w3.org/XML/1998/namespace"}}
+	resolve := func(prefix string) string {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if uri, ok := scopes[i][prefix]; ok {
+				return uri
+			}
+		}
+		return ""
+	}
+
+	for {
+		start := d.InputOffset()
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XMP metadata: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			scope := map[string]string{}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					scope[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					scope[""] = a.Value
+				}
+			}
+			scopes = append(scopes, scope)
+			name := xmpProperty{resolve(t.Name.Space), t.Name.Local}
+
+			if managed[name] {
+				if err := skipElement(d); err != nil {
+					return nil, fmt.Errorf("invalid XMP metadata: %w", err)
+				}
+				start, end := wholeLines(packet, start, d.InputOffset())
+				edits = append(edits, edit{start, end, ""})
+				scopes = scopes[:len(scopes)-1]
+				continue
+			}
+
+			// Simple properties may also be written as attributes
+			if name == (xmpProperty{nsRDF, "Description"}) {
+				tag := string(packet[start:d.InputOffset()])
+				changed := tag
+				for _, a := range t.Attr {
+					if a.Name.Space != "" && a.Name.Space != "xmlns" && managed[xmpProperty{resolve(a.Name.Space), a.Name.Local}] {
+						attr := regexp.MustCompile(`\s+` + regexp.QuoteMeta(a.Name.Space+":"+a.Name.Local) + `\s*=\s*("[^"]*"|'[^']*')`)
+						changed = attr.ReplaceAllString(changed, "")
+					}
+				}
+				if changed != tag {
+					edits = append(edits, edit{start, d.InputOffset(), changed})
+				}
+			}
+
+		case xml.EndElement:
+			if resolve(t.Name.Space) == nsRDF && t.Name.Local == "RDF" {
+				insertAt = start
+			}
+			if len(scopes) > 1 {
+				scopes = scopes[:len(scopes)-1]
+			}
+		}
+	}
+	if insertAt < 0 {
+		return nil, fmt.Errorf("invalid XMP metadata: no rdf:RDF element")
+	}
+
+	var out bytes.Buffer
+	pos := int64(0)
+	for _, e := range edits {
+		if e.start > insertAt {
+			break
+		}
+		out.Write(packet[pos:e.start])
+		out.WriteString(e.text)
+		pos = e.end
+	}
+	out.Write(packet[pos:insertAt])
+	out.WriteString(xmpDescription(props, now))
+	out.Write(packet[insertAt:])
+	return out.Bytes(), nil
+}
+
+// wholeLines widens a removed range to the lines it covers when nothing else
+// is on them, so that removed elements leave no blank lines behind
+func wholeLines(packet []byte, start, end int64) (int64, int64) {
+	lineStart := start
+	for lineStart > 0 && (packet[lineStart-1] == ' ' || packet[lineStart-1] == '\t') {
+		lineStart--
+	}
+	lineEnd := end
+	for lineEnd < int64(len(packet)) && (packet[lineEnd] == ' ' || packet[lineEnd] == '\t' || packet[lineEnd] == '\r') {
+		lineEnd++
+	}
+	if (lineStart == 0 || packet[lineStart-1] == '\n') && lineEnd < int64(len(packet)) && packet[lineEnd] == '\n' {
+		return lineStart, lineEnd + 1
+	}
+	return start, end
+}
+
+// skipElement reads up to the end of the element whose start was just read
+func skipElement(d *xml.Decoder) error {
+	for depth := 1; depth > 0; {
+		tok, err := d.RawToken()
+		if err != nil {
+			return err
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+// xmpDescription writes the non-empty entries as an rdf:Description
+func xmpDescription(props map[string]string, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:rdf=\"" + nsRDF + "\"")
+	b.WriteString(" xmlns:dc=\"" + nsDC + "\" xmlns:pdf=\"" + nsPDF + "\" xmlns:xmp=\"" + nsXMP + "\">\n")
+
+	if v := props["Title"]; v != "" {
+		b.WriteString("<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">" + xmlText(v) + "</rdf:li></rdf:Alt></dc:title>\n")
+	}
+	if v := props["Author"]; v != "" {
+		b.WriteString("<dc:creator><rdf:Seq><rdf:li>" + xmlText(v) + "</rdf:li></rdf:Seq></dc:creator>\n")
+	}
+	if v := props["Subject"]; v != "" {
+		b.WriteString("<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">" + xmlText(v) + "</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	if v := props["Keywords"]; v != "" {
+		b.WriteString("<pdf:Keywords>" + xmlText(v) + "</pdf:Keywords>\n")
+		b.WriteString("<dc:subject><rdf:Bag>")
+		for _, kw := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			if kw = strings.TrimSpace(kw); kw != "" {
+				b.WriteString("<rdf:li>" + xmlText(kw) + "</rdf:li>")
+			}
+		}
+		b.WriteString("</rdf:Bag></dc:subject>\n")
+	}
+	if v := props["Creator"]; v != "" {
+		b.WriteString("<xmp:CreatorTool>" + xmlText(v) + "</xmp:CreatorTool>\n")
+	}
+
+	date := now.UTC().Format(time.RFC3339)
+	b.WriteString("<xmp:ModifyDate>" + date + "</xmp:ModifyDate>\n")
+	b.WriteString("<xmp:MetadataDate>" + date + "</xmp:MetadataDate>\n")
+	b.WriteString("</rdf:Description>\n")
+	return b.String()
+}
+
+func xmlText(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,543 @@
+// Package webp implements a lossless WebP (VP8L) encoder. Decoding is left to
+// golang.org/x/image/webp, which registers itself with image.Decode.
+package webp
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+const (
+	maxDimension = 1 << 14
+
+	// Symbols 0-255 of the green alphabet are literals, 256-279 are
+	// backward reference length prefixes
+	numLiteralCodes = 256
+	numLengthCodes  = 24
+	numDistCodes    = 40
+	greenAlphabet   = numLiteralCodes + numLengthCodes
+
+	maxCodeLength       = 15
+	maxCodeLengthLength = 7
+	maxMatchLength      = 4096
+	minMatchLength      = 3
+
+	// Every tile of the predictor transform uses the Select predictor
+	predictorBits = 9
+	predictorMode = 11
+)
+
+var errTooLarge = errors.New("webp: image dimensions exceed 16384 pixels")
+
+// Order in which the code length code lengths are written (spec 5.2.2)
+var codeLengthCodeOrder = [19]int{
+	17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// Encode writes img to w as a lossless WebP image
+func Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return errTooLarge
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	argb := make([]uint32, width*height)
+	hasAlpha := false
+	for i := range argb {
+		p := nrgba.Pix[4*i : 4*i+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		if p[3] != 0xff {
+			hasAlpha = true
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.writeBits(0x2f, 8) // VP8L signature
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if hasAlpha {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(0, 3) // version
+
+	// Subtract green transform
+	bw.writeBits(1, 1)
+	bw.writeBits(2, 2)
+	subtractGreen(argb)
+
+	// Predictor transform
+	bw.writeBits(1, 1)
+	bw.writeBits(0, 2)
+	bw.writeBits(predictorBits-2, 3)
+	tilesX, tilesY := subSampleSize(width, predictorBits), subSampleSize(height, predictorBits)
+	modes := make([]uint32, tilesX*tilesY)
+	for i := range modes {
+		modes[i] = 0xff000000 | predictorMode<<8
+	}
+	writeEntropyImage(bw, modes, tilesX, false)
+	argb = predictResiduals(argb, width, height)
+
+	bw.writeBits(0, 1) // no more transforms
+	writeEntropyImage(bw, argb, width, true)
+	data := bw.bytes()
+
+	chunkSize := len(data)
+	padded := chunkSize + chunkSize&1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+padded))
+	copy(header[8:], "WEBP")
+	copy(header[12:], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunkSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if padded != chunkSize {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func subSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predictResiduals returns the residuals of the predictor transform where
+// every tile uses predictorMode
+func predictResiduals(argb []uint32, width, height int) []uint32 {
+	out := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xff000000
+			case y == 0:
+				pred = argb[i-1]
+			case x == 0:
+				pred = argb[i-width]
+			default:
+				pred = selectPredictor(argb[i-1], argb[i-width], argb[i-width-1])
+			}
+			out[i] = subPixels(argb[i], pred)
+		}
+	}
+	return out
+}
+
+func selectPredictor(left, top, topLeft uint32) uint32 {
+	// Manhattan distances to the gradient estimate, per the spec's Select
+	pl, pt := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		l := int(left>>shift) & 0xff
+		t := int(top>>shift) & 0xff
+		tl := int(topLeft>>shift) & 0xff
+		pl += abs(tl - t)
+		pt += abs(tl - l)
+	}
+	if pl < pt {
+		return left
+	}
+	return top
+}
+
+func subPixels(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		out |= (((a >> shift) - (b >> shift)) & 0xff) << shift
+	}
+	return out
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// token is either a literal ARGB pixel or a backward reference
+type token struct {
+	literal  uint32
+	length   int
+	distCode int
+}
+
+// findMatches performs a cheap LZ77 pass that only considers the previous
+// pixel and the pixel directly above, which covers flat areas and vertically
+// repeated rows
+func findMatches(argb []uint32, width int) []token {
+	var tokens []token
+	for i := 0; i < len(argb); {
+		bestLen, bestCode := 0, 0
+		// Plane codes 1 and 2 map to the pixel above and to the left
+		for _, c := range [2]struct{ dist, code int }{{1, 2}, {width, 1}} {
+			if c.dist > i {
+				continue
+			}
+			n := 0
+			for i+n < len(argb) && n < maxMatchLength && argb[i+n] == argb[i+n-c.dist] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestCode = n, c.code
+			}
+		}
+		if bestLen >= minMatchLength {
+			tokens = append(tokens, token{length: bestLen, distCode: bestCode})
+			i += bestLen
+			continue
+		}
+		tokens = append(tokens, token{literal: argb[i]})
+		i++
+	}
+	return tokens
+}
+
+// prefixEncode splits a length or distance value into its prefix symbol and
+// extra bits
+func prefixEncode(v int) (prefix, extraBits, extra int) {
+	if v <= 4 {
+		return v - 1, 0, 0
+	}
+	n := v - 1
+	h := 0
+	for n>>(h+1) != 0 {
+		h++
+	}
+	second := (n >> (h - 1)) & 1
+	extraBits = h - 1
+	return 2*h + second, extraBits, n & (1<<extraBits - 1)
+}
+
+func writeEntropyImage(bw *bitWriter, argb []uint32, width int, topLevel bool) {
+	bw.writeBits(0, 1) // no color cache
+	if topLevel {
+		bw.writeBits(0, 1) // single prefix code group
+	}
+
+	tokens := findMatches(argb, width)
+	green := make([]int, greenAlphabet)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	dist := make([]int, numDistCodes)
+	for _, t := range tokens {
+		if t.length > 0 {
+			p, _, _ := prefixEncode(t.length)
+			green[numLiteralCodes+p]++
+			p, _, _ = prefixEncode(t.distCode)
+			dist[p]++
+			continue
+		}
+		green[(t.literal>>8)&0xff]++
+		red[(t.literal>>16)&0xff]++
+		blue[t.literal&0xff]++
+		alpha[t.literal>>24]++
+	}
+
+	codes := [5]*prefixCode{}
+	for i, h := range [5][]int{green, red, blue, alpha, dist} {
+		codes[i] = writePrefixCode(bw, h)
+	}
+
+	for _, t := range tokens {
+		if t.length > 0 {
+			p, nb, extra := prefixEncode(t.length)
+			codes[0].write(bw, numLiteralCodes+p)
+			bw.writeBits(uint32(extra), uint(nb))
+			p, nb, extra = prefixEncode(t.distCode)
+			codes[4].write(bw, p)
+			bw.writeBits(uint32(extra), uint(nb))
+			continue
+		}
+		codes[0].write(bw, int((t.literal>>8)&0xff))
+		codes[1].write(bw, int((t.literal>>16)&0xff))
+		codes[2].write(bw, int(t.literal&0xff))
+		codes[3].write(bw, int(t.literal>>24))
+	}
+}
+
+// prefixCode holds the canonical Huffman codes of one alphabet, already
+// bit-reversed for the LSB-first bit writer
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (c *prefixCode) write(bw *bitWriter, symbol int) {
+	bw.writeBits(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writePrefixCode picks the smallest representation for the histogram,
+// writes it and returns the code used for the symbols
+func writePrefixCode(bw *bitWriter, histogram []int) *prefixCode {
+	var used []int
+	for s, n := range histogram {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+	code := &prefixCode{lengths: make([]int, len(histogram)), codes: make([]uint32, len(histogram))}
+
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		// Simple code: one symbol costs zero bits, two cost one bit each
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(used[0]), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.writeBits(uint32(used[1]), 8)
+			code.lengths[used[0]] = 1
+			code.lengths[used[1]] = 1
+			code.codes[used[1]] = 1
+		}
+		return code
+	}
+
+	lengths := huffmanLengths(histogram, maxCodeLength)
+	if len(used) == 1 {
+		// A lone symbol is transmitted with a length but decoded in zero bits
+		lengths[used[0]] = 1
+		bw.writeBits(0, 1)
+		writeCodeLengths(bw, lengths)
+		return code
+	}
+
+	bw.writeBits(0, 1)
+	writeCodeLengths(bw, lengths)
+	code.lengths = lengths
+	code.codes = canonicalCodes(lengths)
+	return code
+}
+
+// writeCodeLengths run-length encodes the code lengths with the code length
+// alphabet and writes both
+func writeCodeLengths(bw *bitWriter, lengths []int) {
+	type clToken struct{ symbol, extra, extraBits int }
+	var tokens []clToken
+	prev := 8
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		switch {
+		case l == 0 && run >= 11:
+			n := min(run, 138)
+			tokens = append(tokens, clToken{18, n - 11, 7})
+			i += n
+		case l == 0 && run >= 3:
+			n := min(run, 10)
+			tokens = append(tokens, clToken{17, n - 3, 3})
+			i += n
+		case l != 0 && l == prev && run >= 3:
+			n := min(run, 6)
+			tokens = append(tokens, clToken{16, n - 3, 2})
+			i += n
+		default:
+			tokens = append(tokens, clToken{l, 0, 0})
+			if l != 0 {
+				prev = l
+			}
+			i++
+		}
+	}
+
+	histogram := make([]int, len(codeLengthCodeOrder))
+	for _, t := range tokens {
+		histogram[t.symbol]++
+	}
+	clLengths := huffmanLengths(histogram, maxCodeLengthLength)
+	clCodes := canonicalCodes(clLengths)
+	lone := -1
+	if nonZero(clLengths) == 1 {
+		for s, l := range clLengths {
+			if l > 0 {
+				lone = s
+			}
+		}
+	}
+
+	n := len(codeLengthCodeOrder)
+	for n > 4 && clLengths[codeLengthCodeOrder[n-1]] == 0 {
+		n--
+	}
+	bw.writeBits(uint32(n-4), 4)
+	for i := 0; i < n; i++ {
+		bw.writeBits(uint32(clLengths[codeLengthCodeOrder[i]]), 3)
+	}
+
+	bw.writeBits(0, 1) // max_symbol is the alphabet size
+	for _, t := range tokens {
+		if t.symbol != lone {
+			bw.writeBits(clCodes[t.symbol], uint(clLengths[t.symbol]))
+		}
+		bw.writeBits(uint32(t.extra), uint(t.extraBits))
+	}
+}
+
+func nonZero(lengths []int) int {
+	n := 0
+	for _, l := range lengths {
+		if l > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// huffmanLengths builds code lengths no longer than limit for the histogram.
+// Frequencies are flattened until the tree fits, which is simpler than
+// package-merge and close enough for our alphabet sizes.
+func huffmanLengths(histogram []int, limit int) []int {
+	freq := make([]int, len(histogram))
+	copy(freq, histogram)
+	for {
+		lengths := buildLengths(freq)
+		longest := 0
+		for _, l := range lengths {
+			longest = max(longest, l)
+		}
+		if longest <= limit {
+			return lengths
+		}
+		for i, f := range freq {
+			if f > 0 {
+				freq[i] = (f + 1) / 2
+			}
+		}
+	}
+}
+
+func buildLengths(freq []int) []int {
+	type node struct {
+		weight      int
+		symbol      int
+		left, right *node
+	}
+	var nodes []*node
+	for s, f := range freq {
+		if f > 0 {
+			nodes = append(nodes, &node{weight: f, symbol: s})
+		}
+	}
+	lengths := make([]int, len(freq))
+	if len(nodes) == 1 {
+		lengths[nodes[0].symbol] = 1
+		return lengths
+	}
+
+	// Repeatedly merge the two lightest nodes; alphabets are at most 280
+	// symbols so a linear scan is fine
+	popMin := func() *node {
+		best := 0
+		for i, n := range nodes {
+			if n.weight < nodes[best].weight {
+				best = i
+			}
+		}
+		n := nodes[best]
+		nodes = append(nodes[:best], nodes[best+1:]...)
+		return n
+	}
+	for len(nodes) > 1 {
+		a, b := popMin(), popMin()
+		nodes = append(nodes, &node{weight: a.weight + b.weight, symbol: -1, left: a, right: b})
+	}
+
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		if n.left == nil {
+			lengths[n.symbol] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(nodes[0], 0)
+	return lengths
+}
+
+// canonicalCodes assigns canonical Huffman codes to the lengths and reverses
+// them, since the decoder reads codes MSB first from an LSB-first stream
+func canonicalCodes(lengths []int) []uint32 {
+	var count [maxCodeLength + 1]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [maxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		var rev uint32
+		for i := 0; i < l; i++ {
+			rev = rev<<1 | (c>>i)&1
+		}
+		codes[s] = rev
+	}
+	return codes
+}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
@@ -0,0 +1,89 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name          string
+		width, height int
+		pixel         func(x, y int) color.NRGBA
+	}{
+		{"opaque gradient", 300, 200, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255}
+		}},
+		{"opaque noise", 64, 64, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256)), 255}
+		}},
+		{"transparent", 128, 96, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 2), 40, uint8(y * 2), uint8(r.Intn(256))}
+		}},
+		{"transparent stripes", 50, 40, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x / 10 * 30), uint8(r.Intn(3)), 0, uint8(y % 2 * 255)}
+		}},
+		{"single color", 100, 100, func(x, y int) color.NRGBA {
+			return color.NRGBA{10, 20, 30, 255}
+		}},
+		{"single pixel", 1, 1, func(x, y int) color.NRGBA {
+			return color.NRGBA{200, 100, 50, 128}
+		}},
+		{"odd size", 13, 9, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 19), uint8(y * 27), 7, 255}
+		}},
+		{"odd size across predictor tiles", 700, 513, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x ^ y), uint8(x / 3), uint8(y / 5), 255}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					img.SetNRGBA(x, y, tt.pixel(x, y))
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := Encode(&buf, img); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			out, err := xwebp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got := out.Bounds(); got != img.Bounds() {
+				t.Fatalf("bounds = %v, want %v", got, img.Bounds())
+			}
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					want := img.NRGBAAt(x, y)
+					got := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA)
+					// The colour of fully transparent pixels is not kept
+					if got != want && !(got.A == 0 && want.A == 0) {
+						t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeTooLarge(t *testing.T) {
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 0, 10),
+		image.Rect(0, 0, maxDimension+1, 1),
+	} {
+		if err := Encode(&bytes.Buffer{}, image.NewNRGBA(r)); err != errTooLarge {
+			t.Errorf("Encode(%v) = %v, want %v", r, err, errTooLarge)
+		}
+	}
+}